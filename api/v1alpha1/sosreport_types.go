@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,26 +31,434 @@ type SosreportSpec struct {
 	// For example, in order to generate Sosreports on all master nodes, use
 	// node-role.kubernetes.io/master: ""
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// NodeLabelSelector selects nodes by label expressions. It is combined with NodeSelector, i.e. a node must match
+	// both.
+	// +optional
+	NodeLabelSelector *metav1.LabelSelector `json:"nodeLabelSelector,omitempty"`
+	// NodeNames restricts the Sosreport to the nodes with these names
+	// +optional
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// ExcludeNodeNames lists nodes which are never selected
+	// +optional
+	ExcludeNodeNames []string `json:"excludeNodeNames,omitempty"`
+	// Sample selects only a few of the eligible nodes, e.g. two nodes per machine pool
+	// +optional
+	Sample *SosreportNodeSample `json:"sample,omitempty"`
 	// Sosreport jobs will respect Node Taints. One can work around this by configuring tolerations.
 	Tolerations []corev1.Toleration `json:"tolerations,omitempty" protobuf:"bytes,22,opt,name=tolerations"`
+	// SkipUnschedulableNodes excludes cordoned nodes when the Sosreport's nodes are selected
+	// +optional
+	SkipUnschedulableNodes bool `json:"skipUnschedulableNodes,omitempty"`
+
+	// The following fields are passed to sos report. See sos-report(1) for details.
+
+	// OnlyPlugins restricts the collection to the listed plugins (sos report --only-plugins)
+	OnlyPlugins []string `json:"onlyPlugins,omitempty"`
+	// SkipPlugins disables the listed plugins (sos report --skip-plugins)
+	SkipPlugins []string `json:"skipPlugins,omitempty"`
+	// EnablePlugins enables the listed plugins, even if they would not be enabled otherwise (sos report --enable-plugins)
+	EnablePlugins []string `json:"enablePlugins,omitempty"`
+	// PluginOptions maps <plugin>.<option> to a value (sos report --plugin-option), e.g.
+	// crio.logs: "on". The defaults are crio.all=on and crio.logs=on.
+	PluginOptions map[string]string `json:"pluginOptions,omitempty"`
+	// Profiles enables the plugins of the listed profiles (sos report --profiles)
+	Profiles []string `json:"profiles,omitempty"`
+	// LogSize limits the size of collected logs in MiB (sos report --log-size)
+	// +kubebuilder:validation:Minimum=0
+	LogSize *int32 `json:"logSize,omitempty"`
+	// AllLogs collects all available logs regardless of their size (sos report --all-logs)
+	AllLogs bool `json:"allLogs,omitempty"`
+	// Since only collects logs which are newer than the given date, in the format YYYYMMDD[HHMMSS] (sos report --since)
+	// +kubebuilder:validation:Pattern=`^[0-9]{8}([0-9]{6})?$`
+	Since string `json:"since,omitempty"`
+
+	// Timeout limits how long the sosreport job of a node may run. It is applied as the job's activeDeadlineSeconds.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// PendingTimeout limits how long the pod of a sosreport job may be Pending, e.g. because it cannot be
+	// scheduled. The node is reported as TimedOut afterwards. Defaults to 10m.
+	// +optional
+	PendingTimeout *metav1.Duration `json:"pendingTimeout,omitempty"`
+	// UploadTimeout limits how long the upload job of an archive may run, including the time its pod is Pending.
+	// It is applied as the job's activeDeadlineSeconds. Defaults to 1h.
+	// +optional
+	UploadTimeout *metav1.Duration `json:"uploadTimeout,omitempty"`
+
+	// ConfigRef is the name of a SosreportConfig which overrides the configuration of this Sosreport
+	// +optional
+	ConfigRef string `json:"configRef,omitempty"`
+
+	// RetryPolicy controls if and when the sosreport job of a node is recreated after it failed.
+	// By default, failed nodes are not retried.
+	RetryPolicy *SosreportRetryPolicy `json:"retryPolicy,omitempty"`
+
+	// UploadTargets are the destinations which the archive of every node is uploaded to. They replace the upload
+	// method of the configuration. Each target is uploaded to by a job of its own and reported separately.
+	// +optional
+	UploadTargets []SosreportUploadTarget `json:"uploadTargets,omitempty"`
+
+	// Storage selects where the archives are stored. By default, every node gets a PVC of its own.
+	// +optional
+	Storage *SosreportStorage `json:"storage,omitempty"`
+
+	// TTLAfterFinished deletes the Sosreport this long after it finished. It can be changed at any time.
+	// +optional
+	TTLAfterFinished *metav1.Duration `json:"ttlAfterFinished,omitempty"`
+	// RetainPVCs keeps the PVCs with the archives when the Sosreport is deleted by its TTLAfterFinished or by the
+	// operator's retention policy. Only its jobs and their pods are removed. It can be changed at any time.
+	// +optional
+	RetainPVCs bool `json:"retainPVCs,omitempty"`
+
+	// DeletionPolicy controls what happens to running uploads and to the archives when the Sosreport is deleted.
+	// It can be changed at any time.
+	// +optional
+	DeletionPolicy *SosreportDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Cancel stops a Sosreport: running sosreport jobs are deleted and no further jobs are started.
+	// Unlike the rest of the spec, it can be set at any time.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// SosreportNodeSample selects a number of nodes out of each group of eligible nodes
+type SosreportNodeSample struct {
+	// Count is the number of nodes which are selected per group
+	// +kubebuilder:validation:Minimum=1
+	Count int32 `json:"count"`
+	// GroupByLabel is the label whose values group the eligible nodes, e.g. topology.kubernetes.io/zone.
+	// Nodes without the label form a group of their own. All eligible nodes form a single group if it is not set.
+	// +optional
+	GroupByLabel string `json:"groupByLabel,omitempty"`
+}
+
+// SosreportRetryPolicy controls the retries of failed sosreport jobs
+type SosreportRetryPolicy struct {
+	// MaxAttempts is the number of times that a sosreport job is run on a node, including the first attempt
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	MaxAttempts int32 `json:"maxAttempts"`
+	// Backoff is the time to wait before the second attempt. It doubles with every further attempt. Defaults to 30s.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+}
+
+// SosreportStorageMode selects how the archives of a Sosreport are stored
+// +kubebuilder:validation:Enum=PerNode;Shared
+type SosreportStorageMode string
+
+const (
+	// StorageModePerNode means that every sosreport job writes its archive to a PVC of its own
+	StorageModePerNode SosreportStorageMode = "PerNode"
+	// StorageModeShared means that every sosreport job writes its archive to a local volume and hands it off to a
+	// collector job, which stores the archives of all nodes on a single PVC
+	StorageModeShared SosreportStorageMode = "Shared"
+)
+
+// SosreportLocalVolume is the type of volume which sosreport jobs write their archives to in the Shared storage mode
+// +kubebuilder:validation:Enum=EmptyDir;HostPath
+type SosreportLocalVolume string
+
+const (
+	// LocalVolumeEmptyDir keeps the archive in an emptyDir, which is removed together with the job's pod
+	LocalVolumeEmptyDir SosreportLocalVolume = "EmptyDir"
+	// LocalVolumeHostPath keeps the archive in /var/tmp/sosreport-operator on the node until it was handed off
+	LocalVolumeHostPath SosreportLocalVolume = "HostPath"
+)
+
+// SosreportStorage configures where the archives of a Sosreport are stored
+type SosreportStorage struct {
+	// Mode is PerNode or Shared. Defaults to PerNode.
+	// +optional
+	Mode SosreportStorageMode `json:"mode,omitempty"`
+	// LocalVolume is the volume which sosreport jobs write to in the Shared mode. Defaults to EmptyDir.
+	// +optional
+	LocalVolume SosreportLocalVolume `json:"localVolume,omitempty"`
+	// AccessMode of the shared PVC. Defaults to ReadWriteMany. With ReadWriteOnce, the artifact server can only read
+	// the archives once the collector job is gone or if its reader pod lands on the collector's node.
+	// +kubebuilder:validation:Enum=ReadWriteMany;ReadWriteOnce
+	// +optional
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+	// Capacity of the shared PVC. Defaults to the configured PVC capacity.
+	// +optional
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+}
+
+// SosreportDeletionAction is what the operator does before it lets a Sosreport be deleted
+// +kubebuilder:validation:Enum=WaitForUploads;Export;None
+type SosreportDeletionAction string
+
+const (
+	// DeletionActionWaitForUploads waits for the running sosreport jobs and uploads their archives
+	DeletionActionWaitForUploads SosreportDeletionAction = "WaitForUploads"
+	// DeletionActionExport waits for the running sosreport jobs and copies all archives to the export PVC
+	DeletionActionExport SosreportDeletionAction = "Export"
+	// DeletionActionNone deletes the Sosreport right away
+	DeletionActionNone SosreportDeletionAction = "None"
+)
+
+// SosreportDeletionPolicy controls the deletion of a Sosreport
+type SosreportDeletionPolicy struct {
+	// Action is WaitForUploads, Export or None. Defaults to WaitForUploads.
+	// +optional
+	Action SosreportDeletionAction `json:"action,omitempty"`
+	// ExportPVCName is the PVC in the Sosreport's namespace which the Export action copies the archives to.
+	// The archives are stored in <namespace>/<sosreport>/<pvc> on it.
+	// +optional
+	ExportPVCName string `json:"exportPVCName,omitempty"`
+	// Timeout limits how long the deletion waits for uploads and exports. Defaults to 30m.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// SosreportPhase is a label for the state of a Sosreport run as a whole
+// +kubebuilder:validation:Enum=Pending;Scheduling;Running;Succeeded;PartiallyFailed;Failed
+type SosreportPhase string
+
+const (
+	// SosreportPhasePending means that the Sosreport was created but the controller has not yet looked at it
+	SosreportPhasePending SosreportPhase = "Pending"
+	// SosreportPhaseScheduling means that nodes were selected but no sosreport job has been started yet
+	SosreportPhaseScheduling SosreportPhase = "Scheduling"
+	// SosreportPhaseRunning means that at least one sosreport job was started and not all nodes are done
+	SosreportPhaseRunning SosreportPhase = "Running"
+	// SosreportPhaseSucceeded means that the sosreport jobs of all selected nodes completed successfully
+	SosreportPhaseSucceeded SosreportPhase = "Succeeded"
+	// SosreportPhasePartiallyFailed means that the sosreport jobs of some, but not all, selected nodes failed
+	SosreportPhasePartiallyFailed SosreportPhase = "PartiallyFailed"
+	// SosreportPhaseFailed means that no sosreport could be collected, e.g. because no node was eligible
+	// or because all sosreport jobs failed
+	SosreportPhaseFailed SosreportPhase = "Failed"
+)
+
+// Condition types which are maintained in SosreportStatus.Conditions
+const (
+	// ConditionNodesSelected is True once at least one eligible node was selected for this Sosreport
+	ConditionNodesSelected = "NodesSelected"
+	// ConditionJobsRunning is True while sosreport jobs are running or waiting to be run
+	ConditionJobsRunning = "JobsRunning"
+	// ConditionCollected is True once the sosreports of all selected nodes were collected successfully
+	ConditionCollected = "Collected"
+	// ConditionUploaded is True once the sosreports of all selected nodes were uploaded successfully
+	ConditionUploaded = "Uploaded"
+	// ConditionConfigurationValid is False if the configuration which applies to the Sosreport is invalid
+	ConditionConfigurationValid = "ConfigurationValid"
+)
+
+// SosreportNodeOutcome is the result of the sosreport job of a single node
+// +kubebuilder:validation:Enum=Succeeded;Failed;TimedOut;Skipped;NodeLost;Cancelled
+type SosreportNodeOutcome string
+
+const (
+	// NodeOutcomeSucceeded means that the node's sosreport job completed successfully
+	NodeOutcomeSucceeded SosreportNodeOutcome = "Succeeded"
+	// NodeOutcomeFailed means that the node's sosreport job failed
+	NodeOutcomeFailed SosreportNodeOutcome = "Failed"
+	// NodeOutcomeTimedOut means that the node's sosreport job exceeded its timeout or that its pod could not be
+	// scheduled in time
+	NodeOutcomeTimedOut SosreportNodeOutcome = "TimedOut"
+	// NodeOutcomeSkipped means that the node was deleted or became NotReady before its sosreport job was started
+	NodeOutcomeSkipped SosreportNodeOutcome = "Skipped"
+	// NodeOutcomeNodeLost means that the node was deleted or became NotReady while its sosreport job was running
+	NodeOutcomeNodeLost SosreportNodeOutcome = "NodeLost"
+	// NodeOutcomeCancelled means that the Sosreport was cancelled before the node's sosreport job finished
+	NodeOutcomeCancelled SosreportNodeOutcome = "Cancelled"
+)
+
+// SosreportNodeState is the position of a node in the Sosreport's run queue
+// +kubebuilder:validation:Enum=Outstanding;Queued;Running;Done
+type SosreportNodeState string
+
+const (
+	// NodeStateOutstanding means that the node was selected but its sosreport job was not started yet
+	NodeStateOutstanding SosreportNodeState = "Outstanding"
+	// NodeStateQueued means that the node's sosreport job waits for a slot of the cluster-wide or node-role concurrency limit
+	NodeStateQueued SosreportNodeState = "Queued"
+	// NodeStateRunning means that the node's sosreport job was started and is not done yet
+	NodeStateRunning SosreportNodeState = "Running"
+	// NodeStateDone means that the node's sosreport job completed or failed
+	NodeStateDone SosreportNodeState = "Done"
+)
+
+// SosreportUploadTarget is a destination which the archives of a Sosreport are uploaded to
+type SosreportUploadTarget struct {
+	// Name identifies the target in the status of the nodes
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// SosreportConfigUpload holds the method of the target, its options and the name of the Secret with its
+	// credentials, with the same fields as spec.upload of a SosreportConfig
+	SosreportConfigUpload `json:",inline"`
+}
+
+// RetryUploadsAnnotation on a Sosreport makes the operator retry the failed uploads of its nodes. The operator
+// removes the annotation once the uploads were retried.
+const RetryUploadsAnnotation = "support.openshift.io/retry-uploads"
+
+const (
+	// UploadResultPending means that the node's upload job was not started yet or waits for its next attempt
+	UploadResultPending = "Pending"
+	// UploadResultRunning means that the node's upload job was started and is not done yet
+	UploadResultRunning = "Running"
+	// UploadResultSucceeded means that the archive was uploaded
+	UploadResultSucceeded = "Succeeded"
+	// UploadResultFailed means that all attempts to upload the archive failed
+	UploadResultFailed = "Failed"
+	// UploadResultSkipped means that the Sosreport was cancelled before the archive was uploaded
+	UploadResultSkipped = "Skipped"
+)
+
+// SosreportUploadStatus reports the result of uploading a node's sosreport
+type SosreportUploadStatus struct {
+	// Target is the name of the upload target, or "default" for the upload method of the configuration
+	// +optional
+	Target string `json:"target,omitempty"`
+	// Method is the upload-method which was used, e.g. case, ftp, nfs or s3
+	Method string `json:"method,omitempty"`
+	// Result is one of Pending, Running, Succeeded, Failed or Skipped
+	Result string `json:"result,omitempty"`
+	// Message is a human readable explanation of the result
+	Message string `json:"message,omitempty"`
+	// Location is where the archive was uploaded to, e.g. s3://<bucket>/<key> with method s3
+	// +optional
+	Location string `json:"location,omitempty"`
+	// JobName is the name of the Job which uploads the archive
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// Attempts is the number of upload jobs which were started for this node
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// Size is the size of the uploaded archive in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// StartTime is the time when the latest upload job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time when the latest upload job was seen as complete or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// NextAttemptTime is the earliest time at which a failed upload is retried
+	// +optional
+	NextAttemptTime *metav1.Time `json:"nextAttemptTime,omitempty"`
+}
+
+// SosreportNodeStatus records the sosreport job of a single node
+type SosreportNodeStatus struct {
+	// NodeName is the name of the node which the sosreport is collected from
+	NodeName string `json:"nodeName"`
+	// State is the position of the node in the run queue
+	State SosreportNodeState `json:"state,omitempty"`
+	// JobName is the name of the Job which collects the sosreport
+	JobName string `json:"jobName,omitempty"`
+	// PVCName is the name of the PersistentVolumeClaim which the sosreport is stored on
+	PVCName string `json:"pvcName,omitempty"`
+	// StartTime is the time when the Job was created
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time when the Job was seen as complete or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Outcome is set once the Job is done
+	Outcome SosreportNodeOutcome `json:"outcome,omitempty"`
+	// Reason explains why the Job ended the way it did, e.g. BackoffLimitExceeded or Error (exit code 1)
+	Reason string `json:"reason,omitempty"`
+	// Attempts is the number of sosreport jobs which were started for this node
+	Attempts int32 `json:"attempts,omitempty"`
+	// NextAttemptTime is the earliest time at which a failed node is retried
+	NextAttemptTime *metav1.Time `json:"nextAttemptTime,omitempty"`
+	// Archive is the file name of the sosreport archive on the PersistentVolumeClaim
+	Archive string `json:"archive,omitempty"`
+	// ArchiveURL is the URL of the operator's artifact server which streams the archive
+	ArchiveURL string `json:"archiveURL,omitempty"`
+	// Upload is the result of the upload by sosreport jobs of older versions of this operator, which uploaded the
+	// archive themselves
+	// +optional
+	Upload *SosreportUploadStatus `json:"upload,omitempty"`
+	// Uploads are the results of the uploads of the archive, one per upload target
+	// +optional
+	Uploads []SosreportUploadStatus `json:"uploads,omitempty"`
+}
+
+// SosreportEffectiveConfiguration is the configuration which the jobs of a Sosreport are created with.
+// It is resolved from the SosreportConfigs or the configuration ConfigMaps once, when the Sosreport's nodes are
+// selected. Later changes of the configuration do not affect Sosreports which are already running.
+type SosreportEffectiveConfiguration struct {
+	// Image is the image of the sosreport jobs
+	Image string `json:"image"`
+	// Command is the command of the sosreport jobs
+	Command string `json:"command"`
+	// ImagePullPolicy is the image pull policy of the sosreport jobs
+	ImagePullPolicy string `json:"imagePullPolicy,omitempty"`
+	// Concurrency is the number of sosreport jobs which run at the same time
+	Concurrency int `json:"concurrency"`
+	// PVCStorageClass is the storage class of the PersistentVolumeClaims which the sosreports are stored on
+	PVCStorageClass string `json:"pvcStorageClass,omitempty"`
+	// PVCCapacity is the requested size of the PersistentVolumeClaims which the sosreports are stored on
+	PVCCapacity string `json:"pvcCapacity"`
+	// UploadSecret is the name of the Secret with the upload credentials
+	UploadSecret string `json:"uploadSecret,omitempty"`
+	// Sources lists where the configuration was read from, in the order of increasing precedence,
+	// e.g. SosreportConfig/default
+	Sources []string `json:"sources,omitempty"`
+	// Environment holds the environment variables of the sosreport jobs which are read from the configuration,
+	// e.g. UPLOAD_METHOD and CASE_NUMBER. Credentials are not recorded here.
+	Environment map[string]string `json:"environment,omitempty"`
 }
 
 // SosreportStatus defines the observed state of Sosreport
 type SosreportStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	Finished              bool     `json:"finished,omitempty"`
-	InProgress            bool     `json:"inprogress,omitempty"`
+
+	// Phase is a high level summary of where the Sosreport is in its lifecycle.
+	Phase SosreportPhase `json:"phase,omitempty"`
+	// Conditions represent the latest available observations of the Sosreport's state.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// CurrentlyRunningNodes lists the nodes in state Running. It is derived from Nodes.
 	CurrentlyRunningNodes []string `json:"currentlyrunningnodes,omitempty"`
-	OutstandingNodes      []string `json:"outstandingnodes,omitempty"`
+	// OutstandingNodes lists the nodes in state Outstanding. It is derived from Nodes.
+	OutstandingNodes []string `json:"outstandingnodes,omitempty"`
+	// QueuedNodes lists the nodes in state Queued. It is derived from Nodes.
+	QueuedNodes []string `json:"queuednodes,omitempty"`
+	// Nodes holds one record per selected node. It is the controller's run queue as well as
+	// the record of each node's result.
+	// +optional
+	Nodes []SosreportNodeStatus `json:"nodes,omitempty"`
+	// EffectiveConfiguration is the configuration which this Sosreport's jobs are created with
+	EffectiveConfiguration *SosreportEffectiveConfiguration `json:"effectiveConfiguration,omitempty"`
+	// ArtifactsURL is the URL of the operator's artifact server which lists the archives of this Sosreport
+	ArtifactsURL string `json:"artifactsURL,omitempty"`
+	// CompletionTime is the time when the Sosreport reached its terminal phase
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Finished was set by older versions of this operator. It is converted into the Phase and cleared.
+	// Deprecated: use Phase.
+	// +optional
+	Finished bool `json:"finished,omitempty"`
+	// InProgress was set by older versions of this operator. It is converted into the Phase and cleared.
+	// Deprecated: use Phase.
+	// +optional
+	InProgress bool `json:"inprogress,omitempty"`
+}
+
+// IsFinished returns true if the Sosreport reached one of its terminal phases
+func (s *SosreportStatus) IsFinished() bool {
+	return s.Phase == SosreportPhaseSucceeded ||
+		s.Phase == SosreportPhasePartiallyFailed ||
+		s.Phase == SosreportPhaseFailed
 }
 
 // +k8s:openapi-gen=true
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
-// +kubebuilder:printcolumn:name="Finished",type=boolean,JSONPath=`.status.finished`
-// +kubebuilder:printcolumn:name="In Progress",type=boolean,JSONPath=`.status.inprogress`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Collected",type=string,JSONPath=`.status.conditions[?(@.type=="Collected")].status`
+// +kubebuilder:printcolumn:name="Uploaded",type=string,JSONPath=`.status.conditions[?(@.type=="Uploaded")].status`
 // +kubebuilder:printcolumn:name="Currently Running Nodes",type=string,JSONPath=`.status.currentlyrunningnodes`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Sosreport is the Schema for the sosreports API
 type Sosreport struct {
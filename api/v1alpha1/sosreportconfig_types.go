@@ -0,0 +1,190 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultSosreportConfigName is the name of the SosreportConfig which applies to Sosreports in all namespaces
+	DefaultSosreportConfigName = "default"
+	// ConditionValid reports if a SosreportConfig, the configuration of a Sosreport or a SosreportSchedule is valid
+	ConditionValid = "Valid"
+)
+
+// SosreportConfigSpec defines the configuration of Sosreports. Unset fields are inherited from the configuration
+// with the next lower precedence.
+type SosreportConfigSpec struct {
+	// Namespaces lists the namespaces whose Sosreports this configuration applies to. It overrides the SosreportConfig
+	// named "default", which applies to all namespaces. A SosreportConfig without namespaces only applies to
+	// Sosreports which reference it via spec.configRef.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Concurrency is the number of sosreport jobs of a Sosreport which run at the same time
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Concurrency *int32 `json:"concurrency,omitempty"`
+	// Debug enables debug logging of the operator and verbose sos report output
+	// +optional
+	Debug *bool `json:"debug,omitempty"`
+
+	// PVCStorageClass is the storage class of the PersistentVolumeClaims which sosreports are stored on
+	// +optional
+	PVCStorageClass *string `json:"pvcStorageClass,omitempty"`
+	// PVCCapacity is the size of the PersistentVolumeClaims which sosreports are stored on
+	// +optional
+	PVCCapacity *resource.Quantity `json:"pvcCapacity,omitempty"`
+
+	// Image is the image of the sosreport jobs
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Image *string `json:"image,omitempty"`
+	// Command is the command of the sosreport jobs
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Command *string `json:"command,omitempty"`
+	// ImagePullPolicy is the image pull policy of the sosreport jobs
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy *corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// SimulationMode creates sosreports of the container instead of the host, e.g. for kind clusters
+	// +optional
+	SimulationMode *bool `json:"simulationMode,omitempty"`
+
+	// Upload configures where sosreports are uploaded to
+	// +optional
+	Upload *SosreportConfigUpload `json:"upload,omitempty"`
+}
+
+// SosreportConfigUpload configures the upload of sosreports
+type SosreportConfigUpload struct {
+	// Method is the upload method
+	// +kubebuilder:validation:Enum=none;case;ftp;nfs;s3;sftp;http
+	Method string `json:"method"`
+	// CaseNumber is the support case which sosreports are attached to with method case
+	// +optional
+	CaseNumber string `json:"caseNumber,omitempty"`
+	// Obfuscate runs sosreports through soscleaner before they are attached to a support case
+	// +optional
+	Obfuscate bool `json:"obfuscate,omitempty"`
+	// NFSShare is the share which sosreports are copied to with method nfs, e.g. 192.168.1.10:/nfs
+	// +optional
+	NFSShare string `json:"nfsShare,omitempty"`
+	// NFSOptions are the mount options of the NFS share
+	// +optional
+	NFSOptions string `json:"nfsOptions,omitempty"`
+	// FTPServer is the server which sosreports are uploaded to with method ftp
+	// +optional
+	FTPServer string `json:"ftpServer,omitempty"`
+	// S3Bucket is the bucket which sosreports are uploaded to with method s3
+	// +optional
+	S3Bucket string `json:"s3Bucket,omitempty"`
+	// S3Prefix is prepended to the object keys of the sosreports, e.g. cluster-a/
+	// +optional
+	S3Prefix string `json:"s3Prefix,omitempty"`
+	// S3Region is the region of the bucket
+	// +optional
+	S3Region string `json:"s3Region,omitempty"`
+	// S3Endpoint is the URL of an S3-compatible object storage, e.g. MinIO or Ceph RGW. Defaults to AWS S3.
+	// +optional
+	S3Endpoint string `json:"s3Endpoint,omitempty"`
+	// S3PartSize is the size of the parts of multipart uploads. Defaults to 64Mi.
+	// +optional
+	S3PartSize *resource.Quantity `json:"s3PartSize,omitempty"`
+	// SFTPServer is the server which sosreports are uploaded to with method sftp, e.g. sftp.example.com:2222
+	// +optional
+	SFTPServer string `json:"sftpServer,omitempty"`
+	// SFTPKnownHosts are the known_hosts entries of the SFTP server. The host key is never trusted on first use.
+	// +optional
+	SFTPKnownHosts string `json:"sftpKnownHosts,omitempty"`
+	// SFTPPath is the template of the remote directory. {{namespace}}, {{sosreport}} and {{node}} are replaced.
+	// Defaults to {{namespace}}/{{sosreport}}/{{node}}.
+	// +optional
+	SFTPPath string `json:"sftpPath,omitempty"`
+	// HTTPURL is the template of the URL which sosreports are uploaded to with method http.
+	// {{namespace}}, {{sosreport}}, {{node}} and {{archive}} are replaced.
+	// +optional
+	HTTPURL string `json:"httpURL,omitempty"`
+	// HTTPMethod is PUT, which sends the archive as the request body, or POST, which sends a multipart form.
+	// Defaults to PUT.
+	// +kubebuilder:validation:Enum=PUT;POST
+	// +optional
+	HTTPMethod string `json:"httpMethod,omitempty"`
+	// HTTPFormField is the name of the form field of the archive with method POST. Defaults to file.
+	// +optional
+	HTTPFormField string `json:"httpFormField,omitempty"`
+	// HTTPHeaders are added to the upload requests
+	// +optional
+	HTTPHeaders map[string]string `json:"httpHeaders,omitempty"`
+	// HTTPCABundle are the PEM encoded CA certificates which the server certificate is verified with
+	// +optional
+	HTTPCABundle string `json:"httpCABundle,omitempty"`
+	// HTTPExpectedStatusCodes are the status codes which mean that the upload succeeded. Defaults to 200, 201 and 204.
+	// +optional
+	HTTPExpectedStatusCodes []int32 `json:"httpExpectedStatusCodes,omitempty"`
+	// SecretName is the name of the Secret with the credentials for the upload, e.g. the username and password, the
+	// SSH private key, the S3 access keys or the bearer token and client certificate for method http. It is looked up in the
+	// namespace of each Sosreport. Defaults to sosreport-upload-secret.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// SosreportConfigStatus defines the observed state of SosreportConfig
+type SosreportConfigStatus struct {
+	// ObservedGeneration is the generation which was validated last
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions report if the configuration is valid
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+// +kubebuilder:printcolumn:name="Namespaces",type=string,JSONPath=`.spec.namespaces`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SosreportConfig is the Schema for the sosreportconfigs API
+type SosreportConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SosreportConfigSpec   `json:"spec,omitempty"`
+	Status SosreportConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SosreportConfigList contains a list of SosreportConfig
+type SosreportConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SosreportConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SosreportConfig{}, &SosreportConfigList{})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ScheduleLabel is the label with the name of the SosreportSchedule which created a Sosreport
+	ScheduleLabel = "support.openshift.io/sosreport-schedule"
+	// ScheduledTimeAnnotation is the annotation with the time which a Sosreport was scheduled for, in RFC 3339 format
+	ScheduledTimeAnnotation = "support.openshift.io/scheduled-at"
+)
+
+// SosreportScheduleConcurrencyPolicy describes how the Sosreports of a SosreportSchedule are run
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+type SosreportScheduleConcurrencyPolicy string
+
+const (
+	// ConcurrencyPolicyAllow creates Sosreports while earlier ones are still running
+	ConcurrencyPolicyAllow SosreportScheduleConcurrencyPolicy = "Allow"
+	// ConcurrencyPolicyForbid skips a run while an earlier Sosreport is still running
+	ConcurrencyPolicyForbid SosreportScheduleConcurrencyPolicy = "Forbid"
+	// ConcurrencyPolicyReplace deletes running Sosreports and creates a new one. The deleted Sosreports are removed
+	// once their deletionPolicy was carried out.
+	ConcurrencyPolicyReplace SosreportScheduleConcurrencyPolicy = "Replace"
+)
+
+// SosreportScheduleSpec defines when and how Sosreports are created
+type SosreportScheduleSpec struct {
+	// Schedule is a cron expression with the fields minute, hour, day of month, month and day of week, e.g.
+	// "0 3 * * 0". The macros @yearly, @monthly, @weekly, @daily and @hourly are supported as well.
+	// Times are in UTC.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// StartingDeadlineSeconds is the time after a scheduled run within which a missed run is still started, e.g.
+	// after a restart of the operator. Missed runs are always started if it is not set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// ConcurrencyPolicy is Allow, Forbid or Replace. Defaults to Forbid.
+	// +optional
+	ConcurrencyPolicy SosreportScheduleConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend stops the creation of further Sosreports. Running Sosreports are not affected.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// SosreportTemplate is the template of the Sosreports which are created
+	SosreportTemplate SosreportTemplateSpec `json:"sosreportTemplate"`
+
+	// SuccessfulSosreportsHistoryLimit is the number of Succeeded Sosreports which are kept. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SuccessfulSosreportsHistoryLimit *int32 `json:"successfulSosreportsHistoryLimit,omitempty"`
+
+	// FailedSosreportsHistoryLimit is the number of Failed and PartiallyFailed Sosreports which are kept.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FailedSosreportsHistoryLimit *int32 `json:"failedSosreportsHistoryLimit,omitempty"`
+}
+
+// SosreportTemplateSpec describes the Sosreports which a SosreportSchedule creates
+type SosreportTemplateSpec struct {
+	// Labels are added to the Sosreports
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the Sosreports
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec is the spec of the Sosreports
+	// +optional
+	Spec SosreportSpec `json:"spec,omitempty"`
+}
+
+// SosreportScheduleStatus defines the observed state of SosreportSchedule
+type SosreportScheduleStatus struct {
+	// Active lists the Sosreports of the schedule which did not finish, yet
+	// +optional
+	Active []corev1.ObjectReference `json:"active,omitempty"`
+	// LastScheduleTime is the time which the last Sosreport was scheduled for
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is the time which the last Succeeded Sosreport was scheduled for
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// Conditions report if Sosreports can be created from the schedule
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SosreportSchedule is the Schema for the sosreportschedules API
+type SosreportSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SosreportScheduleSpec   `json:"spec,omitempty"`
+	Status SosreportScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SosreportScheduleList contains a list of SosreportSchedule
+type SosreportScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SosreportSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SosreportSchedule{}, &SosreportScheduleList{})
+}
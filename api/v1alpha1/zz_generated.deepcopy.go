@@ -21,7 +21,8 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -52,6 +53,231 @@ func (in *Sosreport) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportConfig) DeepCopyInto(out *SosreportConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportConfig.
+func (in *SosreportConfig) DeepCopy() *SosreportConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SosreportConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportConfigList) DeepCopyInto(out *SosreportConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SosreportConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportConfigList.
+func (in *SosreportConfigList) DeepCopy() *SosreportConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SosreportConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportConfigSpec) DeepCopyInto(out *SosreportConfigSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Concurrency != nil {
+		in, out := &in.Concurrency, &out.Concurrency
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Debug != nil {
+		in, out := &in.Debug, &out.Debug
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PVCStorageClass != nil {
+		in, out := &in.PVCStorageClass, &out.PVCStorageClass
+		*out = new(string)
+		**out = **in
+	}
+	if in.PVCCapacity != nil {
+		in, out := &in.PVCCapacity, &out.PVCCapacity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(string)
+		**out = **in
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = new(string)
+		**out = **in
+	}
+	if in.ImagePullPolicy != nil {
+		in, out := &in.ImagePullPolicy, &out.ImagePullPolicy
+		*out = new(corev1.PullPolicy)
+		**out = **in
+	}
+	if in.SimulationMode != nil {
+		in, out := &in.SimulationMode, &out.SimulationMode
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Upload != nil {
+		in, out := &in.Upload, &out.Upload
+		*out = new(SosreportConfigUpload)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportConfigSpec.
+func (in *SosreportConfigSpec) DeepCopy() *SosreportConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportConfigStatus) DeepCopyInto(out *SosreportConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportConfigStatus.
+func (in *SosreportConfigStatus) DeepCopy() *SosreportConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportConfigUpload) DeepCopyInto(out *SosreportConfigUpload) {
+	*out = *in
+	if in.S3PartSize != nil {
+		in, out := &in.S3PartSize, &out.S3PartSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.HTTPHeaders != nil {
+		in, out := &in.HTTPHeaders, &out.HTTPHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HTTPExpectedStatusCodes != nil {
+		in, out := &in.HTTPExpectedStatusCodes, &out.HTTPExpectedStatusCodes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportConfigUpload.
+func (in *SosreportConfigUpload) DeepCopy() *SosreportConfigUpload {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportConfigUpload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportDeletionPolicy) DeepCopyInto(out *SosreportDeletionPolicy) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportDeletionPolicy.
+func (in *SosreportDeletionPolicy) DeepCopy() *SosreportDeletionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportDeletionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportEffectiveConfiguration) DeepCopyInto(out *SosreportEffectiveConfiguration) {
+	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Environment != nil {
+		in, out := &in.Environment, &out.Environment
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportEffectiveConfiguration.
+func (in *SosreportEffectiveConfiguration) DeepCopy() *SosreportEffectiveConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportEffectiveConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SosreportList) DeepCopyInto(out *SosreportList) {
 	*out = *in
@@ -84,6 +310,205 @@ func (in *SosreportList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportNodeSample) DeepCopyInto(out *SosreportNodeSample) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportNodeSample.
+func (in *SosreportNodeSample) DeepCopy() *SosreportNodeSample {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportNodeSample)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportNodeStatus) DeepCopyInto(out *SosreportNodeStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextAttemptTime != nil {
+		in, out := &in.NextAttemptTime, &out.NextAttemptTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Upload != nil {
+		in, out := &in.Upload, &out.Upload
+		*out = new(SosreportUploadStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Uploads != nil {
+		in, out := &in.Uploads, &out.Uploads
+		*out = make([]SosreportUploadStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportNodeStatus.
+func (in *SosreportNodeStatus) DeepCopy() *SosreportNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportRetryPolicy) DeepCopyInto(out *SosreportRetryPolicy) {
+	*out = *in
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportRetryPolicy.
+func (in *SosreportRetryPolicy) DeepCopy() *SosreportRetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportRetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportSchedule) DeepCopyInto(out *SosreportSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportSchedule.
+func (in *SosreportSchedule) DeepCopy() *SosreportSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SosreportSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportScheduleList) DeepCopyInto(out *SosreportScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SosreportSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportScheduleList.
+func (in *SosreportScheduleList) DeepCopy() *SosreportScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SosreportScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportScheduleSpec) DeepCopyInto(out *SosreportScheduleSpec) {
+	*out = *in
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	in.SosreportTemplate.DeepCopyInto(&out.SosreportTemplate)
+	if in.SuccessfulSosreportsHistoryLimit != nil {
+		in, out := &in.SuccessfulSosreportsHistoryLimit, &out.SuccessfulSosreportsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedSosreportsHistoryLimit != nil {
+		in, out := &in.FailedSosreportsHistoryLimit, &out.FailedSosreportsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportScheduleSpec.
+func (in *SosreportScheduleSpec) DeepCopy() *SosreportScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportScheduleStatus) DeepCopyInto(out *SosreportScheduleStatus) {
+	*out = *in
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = make([]corev1.ObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportScheduleStatus.
+func (in *SosreportScheduleStatus) DeepCopy() *SosreportScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SosreportSpec) DeepCopyInto(out *SosreportSpec) {
 	*out = *in
@@ -94,13 +519,107 @@ func (in *SosreportSpec) DeepCopyInto(out *SosreportSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.NodeLabelSelector != nil {
+		in, out := &in.NodeLabelSelector, &out.NodeLabelSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeNames != nil {
+		in, out := &in.NodeNames, &out.NodeNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeNodeNames != nil {
+		in, out := &in.ExcludeNodeNames, &out.ExcludeNodeNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Sample != nil {
+		in, out := &in.Sample, &out.Sample
+		*out = new(SosreportNodeSample)
+		**out = **in
+	}
 	if in.Tolerations != nil {
 		in, out := &in.Tolerations, &out.Tolerations
-		*out = make([]v1.Toleration, len(*in))
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.OnlyPlugins != nil {
+		in, out := &in.OnlyPlugins, &out.OnlyPlugins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SkipPlugins != nil {
+		in, out := &in.SkipPlugins, &out.SkipPlugins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EnablePlugins != nil {
+		in, out := &in.EnablePlugins, &out.EnablePlugins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PluginOptions != nil {
+		in, out := &in.PluginOptions, &out.PluginOptions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LogSize != nil {
+		in, out := &in.LogSize, &out.LogSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.PendingTimeout != nil {
+		in, out := &in.PendingTimeout, &out.PendingTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.UploadTimeout != nil {
+		in, out := &in.UploadTimeout, &out.UploadTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(SosreportRetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UploadTargets != nil {
+		in, out := &in.UploadTargets, &out.UploadTargets
+		*out = make([]SosreportUploadTarget, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(SosreportStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TTLAfterFinished != nil {
+		in, out := &in.TTLAfterFinished, &out.TTLAfterFinished
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(SosreportDeletionPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportSpec.
@@ -116,6 +635,13 @@ func (in *SosreportSpec) DeepCopy() *SosreportSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SosreportStatus) DeepCopyInto(out *SosreportStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.CurrentlyRunningNodes != nil {
 		in, out := &in.CurrentlyRunningNodes, &out.CurrentlyRunningNodes
 		*out = make([]string, len(*in))
@@ -126,6 +652,27 @@ func (in *SosreportStatus) DeepCopyInto(out *SosreportStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.QueuedNodes != nil {
+		in, out := &in.QueuedNodes, &out.QueuedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]SosreportNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EffectiveConfiguration != nil {
+		in, out := &in.EffectiveConfiguration, &out.EffectiveConfiguration
+		*out = new(SosreportEffectiveConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportStatus.
@@ -137,3 +684,96 @@ func (in *SosreportStatus) DeepCopy() *SosreportStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportStorage) DeepCopyInto(out *SosreportStorage) {
+	*out = *in
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportStorage.
+func (in *SosreportStorage) DeepCopy() *SosreportStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportTemplateSpec) DeepCopyInto(out *SosreportTemplateSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportTemplateSpec.
+func (in *SosreportTemplateSpec) DeepCopy() *SosreportTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportUploadStatus) DeepCopyInto(out *SosreportUploadStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextAttemptTime != nil {
+		in, out := &in.NextAttemptTime, &out.NextAttemptTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportUploadStatus.
+func (in *SosreportUploadStatus) DeepCopy() *SosreportUploadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportUploadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SosreportUploadTarget) DeepCopyInto(out *SosreportUploadTarget) {
+	*out = *in
+	in.SosreportConfigUpload.DeepCopyInto(&out.SosreportConfigUpload)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SosreportUploadTarget.
+func (in *SosreportUploadTarget) DeepCopy() *SosreportUploadTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(SosreportUploadTarget)
+	in.DeepCopyInto(out)
+	return out
+}
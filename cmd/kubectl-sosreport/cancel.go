@@ -0,0 +1,46 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func runCancel(o *options, args []string) error {
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+	if s.Status.IsFinished() {
+		return fmt.Errorf("Sosreport %s is already finished", name)
+	}
+
+	// the operator stops the running jobs and finishes all outstanding nodes as Cancelled
+	patch := client.RawPatch(types.MergePatchType, []byte(`{"spec":{"cancel":true}}`))
+	if err := o.client.Patch(ctx, s, patch); err != nil {
+		return err
+	}
+	fmt.Printf("sosreport.support.openshift.io/%s cancelled\n", name)
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+// stringList is a flag which can be repeated and which accepts comma separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+/*
+Parse a list of key=value pairs
+*/
+func parseKeyValues(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, kv := range values {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", kv)
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m, nil
+}
+
+/*
+Parse a toleration in the format key[=value][:effect]. A toleration without value uses the Exists operator, an empty
+key tolerates all taints.
+*/
+func parseToleration(t string) (corev1.Toleration, error) {
+	toleration := corev1.Toleration{Operator: corev1.TolerationOpExists}
+	if i := strings.LastIndex(t, ":"); i >= 0 {
+		toleration.Effect = corev1.TaintEffect(t[i+1:])
+		t = t[:i]
+		switch toleration.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return toleration, fmt.Errorf("invalid taint effect %q", toleration.Effect)
+		}
+	}
+	parts := strings.SplitN(t, "=", 2)
+	toleration.Key = parts[0]
+	if len(parts) == 2 {
+		if toleration.Key == "" {
+			return toleration, fmt.Errorf("a toleration with a value requires a key")
+		}
+		toleration.Operator = corev1.TolerationOpEqual
+		toleration.Value = parts[1]
+	}
+	return toleration, nil
+}
+
+func runCreate(o *options, args []string) error {
+	var (
+		nodeSelector, nodeNames, excludeNodeNames, tolerations           stringList
+		onlyPlugins, skipPlugins, enablePlugins, pluginOptions, profiles stringList
+	)
+	spec := supportv1alpha1.SosreportSpec{}
+	o.flags.Var(&nodeSelector, "node-selector", "Select nodes by label, e.g. node-role.kubernetes.io/worker= (repeatable, comma separated).")
+	o.flags.Var(&nodeNames, "node-names", "Only run on the nodes with these names (repeatable, comma separated).")
+	o.flags.Var(&excludeNodeNames, "exclude-node-names", "Never run on the nodes with these names (repeatable, comma separated).")
+	o.flags.Var(&tolerations, "toleration", "Tolerate a taint, in the format key[=value][:effect] (repeatable, comma separated).")
+	o.flags.BoolVar(&spec.SkipUnschedulableNodes, "skip-unschedulable-nodes", false, "Do not run on cordoned nodes.")
+	o.flags.Var(&onlyPlugins, "only-plugins", "Only run these sos plugins (repeatable, comma separated).")
+	o.flags.Var(&skipPlugins, "skip-plugins", "Do not run these sos plugins (repeatable, comma separated).")
+	o.flags.Var(&enablePlugins, "enable-plugins", "Enable these sos plugins (repeatable, comma separated).")
+	o.flags.Var(&pluginOptions, "plugin-option", "Set a sos plugin option, in the format plugin.option=value (repeatable, comma separated).")
+	o.flags.Var(&profiles, "profiles", "Run the sos plugins of these profiles (repeatable, comma separated).")
+	o.flags.BoolVar(&spec.AllLogs, "all-logs", false, "Collect all log files.")
+	logSize := o.flags.Int("log-size", 0, "Limit the size of collected log files in MiB.")
+	o.flags.StringVar(&spec.Since, "since", "", "Only collect log files newer than YYYYMMDD[HHMMSS].")
+	timeout := o.flags.Duration("timeout", 0, "Fail the sosreport of a node which runs longer than this, e.g. 30m.")
+	o.flags.StringVar(&spec.ConfigRef, "config-ref", "", "The name of the SosreportConfig to use.")
+	dryRun := o.flags.Bool("dry-run", false, "Print the Sosreport instead of creating it.")
+
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+
+	if spec.NodeSelector, err = parseKeyValues(nodeSelector); err != nil {
+		return err
+	}
+	if spec.PluginOptions, err = parseKeyValues(pluginOptions); err != nil {
+		return err
+	}
+	for _, t := range tolerations {
+		toleration, err := parseToleration(t)
+		if err != nil {
+			return err
+		}
+		spec.Tolerations = append(spec.Tolerations, toleration)
+	}
+	spec.NodeNames = nodeNames
+	spec.ExcludeNodeNames = excludeNodeNames
+	spec.OnlyPlugins = onlyPlugins
+	spec.SkipPlugins = skipPlugins
+	spec.EnablePlugins = enablePlugins
+	spec.Profiles = profiles
+	if *logSize > 0 {
+		size := int32(*logSize)
+		spec.LogSize = &size
+	}
+	if *timeout > 0 {
+		spec.Timeout = &metav1.Duration{Duration: *timeout}
+	}
+
+	s := &supportv1alpha1.Sosreport{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: supportv1alpha1.GroupVersion.String(),
+			Kind:       "Sosreport",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: o.namespace,
+		},
+		Spec: spec,
+	}
+	if *dryRun {
+		out, err := yaml.Marshal(s)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	if err := o.client.Create(ctx, s); err != nil {
+		return err
+	}
+	fmt.Printf("sosreport.support.openshift.io/%s created\n", name)
+	fmt.Printf("Run 'kubectl sosreport status %s -n %s' to follow its progress.\n", name, o.namespace)
+	return nil
+}
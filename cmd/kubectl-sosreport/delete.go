@@ -0,0 +1,53 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/andreaskaris/sosreport-operator/pkg/sosreportpvc"
+)
+
+func runDelete(o *options, args []string) error {
+	keepArtifacts := o.flags.Bool("keep-artifacts", false, "Keep the PVCs which hold the archives of the Sosreport.")
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+
+	if *keepArtifacts {
+		kept, err := sosreportpvc.Orphan(ctx, o.client, s)
+		for _, pvcName := range kept {
+			fmt.Printf("persistentvolumeclaim/%s kept\n", pvcName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := o.client.Delete(ctx, s, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		return err
+	}
+	fmt.Printf("sosreport.support.openshift.io/%s deleted\n", name)
+	return nil
+}
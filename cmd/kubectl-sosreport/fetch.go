@@ -0,0 +1,188 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	ARTIFACT_SERVER_PATH_PREFIX = "/sosreports/" // must match the path prefix of the operator's artifact server
+)
+
+/*
+Get the URL of a node's archive. If the base URL of the artifact server is overridden, the URL is built from it,
+otherwise it is taken from the status of the Sosreport.
+*/
+func getArchiveURL(baseURL string, s *supportv1alpha1.Sosreport, n supportv1alpha1.SosreportNodeStatus) string {
+	if baseURL == "" {
+		return n.ArchiveURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + ARTIFACT_SERVER_PATH_PREFIX +
+		url.PathEscape(s.Namespace) + "/" + url.PathEscape(s.Name) + "/" + url.PathEscape(n.NodeName)
+}
+
+/*
+Get the bearer token which authenticates the user with the artifact server
+*/
+func (o *options) getBearerToken(token string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if o.config.BearerToken != "" {
+		return o.config.BearerToken, nil
+	}
+	if o.config.BearerTokenFile != "" {
+		b, err := ioutil.ReadFile(o.config.BearerTokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", fmt.Errorf("the current context has no bearer token, use --token")
+}
+
+/*
+Build the HTTP client which talks to the artifact server
+*/
+func newArtifactServerClient(caFile string, insecure bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+func runFetch(o *options, args []string) error {
+	var nodes stringList
+	o.flags.Var(&nodes, "node", "Only download the archives of these nodes (repeatable, comma separated).")
+	outputDir := o.flags.String("output-dir", ".", "The directory to save the archives to.")
+	baseURL := o.flags.String("artifacts-url", "", "The base URL of the artifact server. Defaults to the URLs in the status of the Sosreport.")
+	token := o.flags.String("token", "", "The bearer token to authenticate with. Defaults to the token of the current context.")
+	caFile := o.flags.String("certificate-authority", "", "Path to the CA bundle which signed the artifact server's certificate.")
+	insecure := o.flags.Bool("insecure-skip-tls-verify", false, "Do not verify the artifact server's certificate.")
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+	bearerToken, err := o.getBearerToken(*token)
+	if err != nil {
+		return err
+	}
+	httpClient, err := newArtifactServerClient(*caFile, *insecure)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool)
+	for _, n := range nodes {
+		selected[n] = true
+	}
+	fetched := 0
+	for _, n := range s.Status.Nodes {
+		if len(selected) > 0 && !selected[n.NodeName] {
+			continue
+		}
+		if n.Outcome != supportv1alpha1.NodeOutcomeSucceeded {
+			fmt.Fprintf(os.Stderr, "Skipping node %s, its sosreport did not succeed\n", n.NodeName)
+			continue
+		}
+		archiveURL := getArchiveURL(*baseURL, s, n)
+		if archiveURL == "" {
+			fmt.Fprintf(os.Stderr, "Skipping node %s, the operator's artifact server is not enabled. Use --artifacts-url.\n", n.NodeName)
+			continue
+		}
+		archive := n.Archive
+		if archive == "" {
+			archive = n.NodeName + ".tar.xz"
+		}
+		path := filepath.Join(*outputDir, filepath.Base(archive))
+		if err := fetchArchive(httpClient, archiveURL, bearerToken, path); err != nil {
+			return fmt.Errorf("node %s: %v", n.NodeName, err)
+		}
+		fmt.Printf("Saved the archive of node %s to %s\n", n.NodeName, path)
+		fetched++
+	}
+	if fetched == 0 {
+		return fmt.Errorf("no archives were downloaded")
+	}
+	return nil
+}
+
+/*
+Download an archive from the artifact server to a file. The file is only created once the download succeeded.
+*/
+func fetchArchive(httpClient *http.Client, archiveURL, bearerToken, path string) error {
+	req, err := http.NewRequest(http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Plugin fetch", func() {
+
+	Context("When building the URL of an archive", func() {
+		s := &supportv1alpha1.Sosreport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "sosreport-sample",
+				Namespace: "sosreport-test",
+			},
+		}
+		n := supportv1alpha1.SosreportNodeStatus{
+			NodeName:   "worker-0",
+			ArchiveURL: "https://artifacts.example.com/sosreports/sosreport-test/sosreport-sample/worker-0",
+		}
+
+		It("Should take the URL from the status without a base URL", func() {
+			Expect(getArchiveURL("", s, n)).To(Equal(n.ArchiveURL))
+		})
+
+		It("Should build the URL from the base URL", func() {
+			Expect(getArchiveURL("https://localhost:8082/", s, n)).To(
+				Equal("https://localhost:8082/sosreports/sosreport-test/sosreport-sample/worker-0"))
+			Expect(getArchiveURL("https://localhost:8082", s, n)).To(
+				Equal("https://localhost:8082/sosreports/sosreport-test/sosreport-sample/worker-0"))
+		})
+
+		It("Should escape the node name", func() {
+			n := supportv1alpha1.SosreportNodeStatus{NodeName: "worker 0/a"}
+			Expect(getArchiveURL("https://localhost:8082", s, n)).To(
+				Equal("https://localhost:8082/sosreports/sosreport-test/sosreport-sample/worker%200%2Fa"))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	JOB_NAME_LABEL = "job-name" // the Job controller labels the pods of a job with the job's name
+)
+
+/*
+Get the newest pod of a job, which belongs to the job's current attempt
+*/
+func (o *options) getNewestJobPod(jobName string) (*corev1.Pod, error) {
+	podList, err := o.clientset.CoreV1().Pods(o.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: JOB_NAME_LABEL + "=" + jobName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *corev1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if newest == nil || newest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			newest = pod
+		}
+	}
+	return newest, nil
+}
+
+func runLogs(o *options, args []string) error {
+	var nodes stringList
+	o.flags.Var(&nodes, "node", "Only print the logs of these nodes (repeatable, comma separated).")
+	follow := o.flags.Bool("f", false, "Follow the logs of running jobs.")
+	tail := o.flags.Int64("tail", -1, "The number of lines to print from the end of each log. Defaults to all lines.")
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool)
+	for _, n := range nodes {
+		selected[n] = true
+	}
+	podsByNode := make(map[string]*corev1.Pod)
+	for _, n := range s.Status.Nodes {
+		if len(selected) > 0 && !selected[n.NodeName] {
+			continue
+		}
+		if n.JobName == "" {
+			fmt.Fprintf(os.Stderr, "Node %s did not start a sosreport job, yet\n", n.NodeName)
+			continue
+		}
+		pod, err := o.getNewestJobPod(n.JobName)
+		if err != nil {
+			return err
+		}
+		if pod == nil {
+			fmt.Fprintf(os.Stderr, "Job %s of node %s has no pods\n", n.JobName, n.NodeName)
+			continue
+		}
+		podsByNode[n.NodeName] = pod
+	}
+
+	logOptions := &corev1.PodLogOptions{Follow: *follow}
+	if *tail >= 0 {
+		logOptions.TailLines = tail
+	}
+
+	// print the lines of all pods concurrently, prefixed with their node name
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		errs   []error
+		prefix = len(podsByNode) > 1
+	)
+	for nodeName, pod := range podsByNode {
+		wg.Add(1)
+		go func(nodeName string, pod *corev1.Pod) {
+			defer wg.Done()
+			err := o.streamPodLogs(nodeName, pod, logOptions, prefix, &mutex)
+			if err != nil {
+				mutex.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %v", nodeName, err))
+				mutex.Unlock()
+			}
+		}(nodeName, pod)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to get the logs of %d node(s)", len(errs))
+	}
+	return nil
+}
+
+/*
+Copy the log of a pod to stdout line by line
+*/
+func (o *options) streamPodLogs(nodeName string, pod *corev1.Pod, logOptions *corev1.PodLogOptions, prefix bool, mutex *sync.Mutex) error {
+	stream, err := o.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOptions).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		mutex.Lock()
+		if prefix {
+			fmt.Printf("[%s] %s\n", nodeName, scanner.Text())
+		} else {
+			fmt.Println(scanner.Text())
+		}
+		mutex.Unlock()
+	}
+	return scanner.Err()
+}
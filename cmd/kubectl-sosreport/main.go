@@ -0,0 +1,187 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-sosreport is a kubectl plugin which creates, inspects and cleans up Sosreports.
+// Install it into the PATH in order to run it as "kubectl sosreport" or "oc sosreport".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var (
+	scheme = runtime.NewScheme()
+	ctx    = context.Background()
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(supportv1alpha1.AddToScheme(scheme))
+}
+
+// command is a subcommand of the plugin
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(o *options, args []string) error
+}
+
+var commands = []command{
+	{"create", "create NAME [flags]", "Create a Sosreport", runCreate},
+	{"status", "status NAME [flags]", "Show the phase of a Sosreport and the state of each of its nodes", runStatus},
+	{"logs", "logs NAME [flags]", "Print the logs of the sosreport jobs of a Sosreport", runLogs},
+	{"fetch", "fetch NAME [flags]", "Download the archives of a Sosreport from the artifact server", runFetch},
+	{"cancel", "cancel NAME [flags]", "Stop the running sosreport jobs of a Sosreport", runCancel},
+	{"retry-uploads", "retry-uploads NAME [flags]", "Start new upload jobs for the failed uploads of a Sosreport", runRetryUploads},
+	{"delete", "delete NAME [flags]", "Delete a Sosreport and, unless --keep-artifacts is set, its PVCs", runDelete},
+}
+
+// options are the flags which all subcommands share
+type options struct {
+	flags      *flag.FlagSet
+	namespace  string
+	kubeconfig string
+
+	config    *rest.Config
+	client    client.Client
+	clientset kubernetes.Interface
+}
+
+/*
+Register the shared flags with the flag set of a subcommand
+*/
+func newOptions(c command) *options {
+	o := &options{
+		flags: flag.NewFlagSet(c.name, flag.ExitOnError),
+	}
+	o.flags.StringVar(&o.namespace, "namespace", "", "The namespace of the Sosreport. Defaults to the namespace of the current context.")
+	o.flags.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+	o.flags.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	o.flags.Usage = func() {
+		fmt.Fprintf(o.flags.Output(), "%s\n\nUsage:\n  kubectl sosreport %s\n\nFlags:\n", c.description, c.usage)
+		o.flags.PrintDefaults()
+	}
+	return o
+}
+
+/*
+Parse the flags of a subcommand and connect to the cluster. Returns the name of the Sosreport.
+*/
+func (o *options) complete(args []string) (string, error) {
+	name, err := o.parseArgs(args)
+	if err != nil {
+		return "", err
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return "", err
+	}
+	if o.namespace == "" {
+		if o.namespace, _, err = clientConfig.Namespace(); err != nil {
+			return "", err
+		}
+	}
+
+	o.config = config
+	if o.client, err = client.New(config, client.Options{Scheme: scheme}); err != nil {
+		return "", err
+	}
+	if o.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+/*
+Parse the flags of a subcommand. Returns the name of the Sosreport, which flags may precede and follow.
+*/
+func (o *options) parseArgs(args []string) (string, error) {
+	if err := o.flags.Parse(args); err != nil {
+		return "", err
+	}
+	var name string
+	if o.flags.NArg() > 0 {
+		name = o.flags.Arg(0)
+		if err := o.flags.Parse(o.flags.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	if name == "" || o.flags.NArg() > 0 {
+		o.flags.Usage()
+		return "", fmt.Errorf("expected exactly one Sosreport name")
+	}
+	return name, nil
+}
+
+/*
+Get a Sosreport by name from the namespace of the options
+*/
+func (o *options) getSosreport(name string) (*supportv1alpha1.Sosreport, error) {
+	s := &supportv1alpha1.Sosreport{}
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Create, inspect and clean up Sosreports.\n\nUsage:\n  kubectl sosreport COMMAND NAME [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'kubectl sosreport COMMAND -h' for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(newOptions(c), os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+	}
+	usage()
+	os.Exit(1)
+}
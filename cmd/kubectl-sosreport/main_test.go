@@ -0,0 +1,131 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plugin options", func() {
+
+	newTestOptions := func() *options {
+		o := newOptions(command{name: "delete", usage: "delete NAME [flags]", description: "Delete a Sosreport"})
+		o.flags.SetOutput(ioutil.Discard)
+		return o
+	}
+
+	Context("When parsing the arguments of a subcommand", func() {
+		It("Should accept flags before and after the name of the Sosreport", func() {
+			o := newTestOptions()
+			keep := o.flags.Bool("keep-artifacts", false, "")
+			name, err := o.parseArgs([]string{"-n", "sosreport-test", "sosreport-sample", "--keep-artifacts"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("sosreport-sample"))
+			Expect(o.namespace).To(Equal("sosreport-test"))
+			Expect(*keep).To(BeTrue())
+
+			o = newTestOptions()
+			name, err = o.parseArgs([]string{"sosreport-sample", "--namespace", "sosreport-test"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("sosreport-sample"))
+			Expect(o.namespace).To(Equal("sosreport-test"))
+		})
+
+		It("Should require exactly one name", func() {
+			_, err := newTestOptions().parseArgs(nil)
+			Expect(err).To(HaveOccurred())
+			_, err = newTestOptions().parseArgs([]string{"-n", "sosreport-test"})
+			Expect(err).To(HaveOccurred())
+			_, err = newTestOptions().parseArgs([]string{"sosreport-a", "sosreport-b"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When completing the options", func() {
+		var server *httptest.Server
+		var kubeconfig string
+
+		BeforeEach(func() {
+			// the client discovers the API of the cluster when it is created
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch req.URL.Path {
+				case "/api":
+					fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+				case "/apis":
+					fmt.Fprint(w, `{"kind":"APIGroupList","apiVersion":"v1","groups":[]}`)
+				case "/api/v1":
+					fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[]}`)
+				default:
+					http.NotFound(w, req)
+				}
+			}))
+			dir, err := ioutil.TempDir("", "kubectl-sosreport")
+			Expect(err).NotTo(HaveOccurred())
+			kubeconfig = filepath.Join(dir, "kubeconfig")
+			Expect(ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    namespace: context-namespace
+current-context: test
+`, server.URL)), 0600)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			Expect(os.RemoveAll(filepath.Dir(kubeconfig))).Should(Succeed())
+		})
+
+		It("Should default to the namespace of the current context", func() {
+			o := newTestOptions()
+			name, err := o.complete([]string{"sosreport-sample", "--kubeconfig", kubeconfig})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("sosreport-sample"))
+			Expect(o.namespace).To(Equal("context-namespace"))
+			Expect(o.config.Host).To(Equal(server.URL))
+			Expect(o.client).NotTo(BeNil())
+			Expect(o.clientset).NotTo(BeNil())
+
+			o = newTestOptions()
+			_, err = o.complete([]string{"--kubeconfig", kubeconfig, "-n", "sosreport-test", "sosreport-sample"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(o.namespace).To(Equal("sosreport-test"))
+		})
+
+		It("Should not connect without a name", func() {
+			o := newTestOptions()
+			_, err := o.complete([]string{"--kubeconfig", kubeconfig})
+			Expect(err).To(HaveOccurred())
+			Expect(o.client).To(BeNil())
+		})
+	})
+})
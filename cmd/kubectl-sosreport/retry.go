@@ -0,0 +1,57 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+func runRetryUploads(o *options, args []string) error {
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, nodeStatus := range s.Status.Nodes {
+		for _, upload := range nodeStatus.Uploads {
+			if upload.Result == supportv1alpha1.UploadResultFailed {
+				failed++
+			}
+		}
+	}
+	if failed == 0 {
+		return fmt.Errorf("Sosreport %s has no failed uploads", name)
+	}
+
+	// the operator starts new upload jobs for the failed uploads and removes the annotation
+	patch := client.RawPatch(types.MergePatchType,
+		[]byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:""}}}`, supportv1alpha1.RetryUploadsAnnotation)))
+	if err := o.client.Patch(ctx, s, patch); err != nil {
+		return err
+	}
+	fmt.Printf("sosreport.support.openshift.io/%s retrying %d failed upload(s)\n", name, failed)
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+/*
+Print an optional string as "-" if it is empty
+*/
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+/*
+Print the age of a timestamp the way kubectl does, e.g. 5m
+*/
+func age(t *metav1.Time) string {
+	if t == nil {
+		return "-"
+	}
+	d := time.Since(t.Time).Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func runStatus(o *options, args []string) error {
+	output := o.flags.String("o", "", "Output format, one of yaml or json. Defaults to a summary.")
+	name, err := o.complete(args)
+	if err != nil {
+		return err
+	}
+	s, err := o.getSosreport(name)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "yaml":
+		out, err := yaml.Marshal(s)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	case "json":
+		out, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	printSosreportStatus(s)
+	return nil
+}
+
+/*
+Print the phase and the conditions of a Sosreport, followed by a table of its nodes
+*/
+func printSosreportStatus(s *supportv1alpha1.Sosreport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Name:\t%s\n", s.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", s.Namespace)
+	fmt.Fprintf(w, "Phase:\t%s\n", orDash(string(s.Status.Phase)))
+	if s.Spec.Cancel {
+		fmt.Fprintf(w, "Cancelled:\ttrue\n")
+	}
+	if s.Status.ArtifactsURL != "" {
+		fmt.Fprintf(w, "Artifacts:\t%s\n", s.Status.ArtifactsURL)
+	}
+
+	if len(s.Status.Conditions) > 0 {
+		fmt.Fprintf(w, "\nCONDITION\tSTATUS\tREASON\tMESSAGE\n")
+		for _, c := range s.Status.Conditions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Type, c.Status, orDash(c.Reason), orDash(c.Message))
+		}
+	}
+
+	if len(s.Status.Nodes) == 0 {
+		fmt.Fprintf(w, "\nNo nodes were selected, yet.\n")
+		return
+	}
+	fmt.Fprintf(w, "\nNODE\tSTATE\tOUTCOME\tATTEMPTS\tSTARTED\tJOB\tARCHIVE\tUPLOAD\tREASON\n")
+	for _, n := range s.Status.Nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			n.NodeName, n.State, orDash(string(n.Outcome)), n.Attempts, age(n.StartTime), orDash(n.JobName),
+			orDash(n.Archive), summarizeNodeUploads(n), orDash(n.Reason))
+	}
+
+	// the upload jobs run after the sosreport jobs and are retried on their own, one per node and target
+	header := false
+	for _, n := range s.Status.Nodes {
+		for _, upload := range n.Uploads {
+			if upload.JobName == "" {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(w, "\nNODE\tTARGET\tMETHOD\tRESULT\tATTEMPTS\tJOB\tLOCATION\tMESSAGE\n")
+				header = true
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				n.NodeName, orDash(upload.Target), orDash(upload.Method), orDash(upload.Result), upload.Attempts,
+				upload.JobName, orDash(upload.Location), orDash(upload.Message))
+		}
+	}
+}
+
+/*
+Summarize the uploads of a node for the node table, e.g. "Succeeded" or "1/2 Succeeded" for several targets
+*/
+func summarizeNodeUploads(n supportv1alpha1.SosreportNodeStatus) string {
+	switch {
+	case n.Upload != nil:
+		return orDash(n.Upload.Result)
+	case len(n.Uploads) == 0:
+		return "-"
+	case len(n.Uploads) == 1:
+		return orDash(n.Uploads[0].Result)
+	}
+	succeeded := 0
+	for _, upload := range n.Uploads {
+		if upload.Result == supportv1alpha1.UploadResultSucceeded {
+			succeeded++
+		}
+	}
+	return fmt.Sprintf("%d/%d %s", succeeded, len(n.Uploads), supportv1alpha1.UploadResultSucceeded)
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// sosreport-uploader uploads the sosreport archive of a single node with the configured upload-method.
+// The operator runs it in an upload job once the node's sosreport job produced the archive. The upload itself is
+// done by the upload_to_<method>.sh scripts of the sosreport image. The result is written as JSON to the
+// container's termination message, which the operator reads into the node's upload status.
+//
+// Variables:
+// UPLOAD_METHOD - case|ftp|nfs|s3|sftp|http
+// ARCHIVE_PATH - path of the archive to upload
+// UPLOAD_RETRIES - number of times the upload script is run before giving up, defaults to 3
+// UPLOAD_RETRY_DELAY - time to wait after the first failed run, doubles with every run, defaults to 10s
+// SCRIPTS_DIR - directory of the upload scripts, defaults to /scripts
+// TERMINATION_LOG - file which the result is written to, defaults to /dev/termination-log
+// All other variables are passed on to the upload scripts, e.g. CASE_NUMBER or S3_BUCKET.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_SCRIPTS_DIR     = "/scripts"
+	DEFAULT_RETRIES         = 3
+	DEFAULT_RETRY_DELAY     = 10 * time.Second
+	TERMINATION_LOG         = "/dev/termination-log"
+	MAX_MESSAGE_LENGTH      = 1024 // the termination message of all containers of a pod is limited to 4096 bytes
+	OUTPUT_TAIL_LINES       = 3    // lines of the script output which are reported if the upload fails
+	MAX_OUTPUT_BUFFER_BYTES = 16 * 1024
+
+	RESULT_SUCCEEDED = "Succeeded"
+	RESULT_FAILED    = "Failed"
+)
+
+// uploadResult is the termination message of the upload job
+type uploadResult struct {
+	Method   string `json:"method"`
+	Result   string `json:"result"`
+	Message  string `json:"message,omitempty"`
+	Location string `json:"location,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	// Retryable is false if another upload job cannot succeed either, e.g. because the configuration is incomplete
+	Retryable bool `json:"retryable"`
+}
+
+// the variables which each upload method cannot do without
+var requiredVariables = map[string][]string{
+	"case": {"CASE_NUMBER", "USERNAME", "PASSWORD"},
+	"ftp":  {"FTP_SERVER"},
+	"nfs":  {"NFS_SHARE"},
+	"s3":   {"S3_BUCKET"},
+	"sftp": {"SFTP_SERVER", "SFTP_KNOWN_HOSTS", "USERNAME", "SSH_PRIVATE_KEY"},
+	"http": {"HTTP_URL"},
+}
+
+/*
+tailWriter keeps the last lines which were written to it
+*/
+type tailWriter struct {
+	mutex  sync.Mutex
+	buffer []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.buffer = append(t.buffer, p...)
+	if len(t.buffer) > MAX_OUTPUT_BUFFER_BYTES {
+		t.buffer = t.buffer[len(t.buffer)-MAX_OUTPUT_BUFFER_BYTES:]
+	}
+	return len(p), nil
+}
+
+/*
+Return the last non-empty lines, joined into a single line
+*/
+func (t *tailWriter) String() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var lines []string
+	for _, line := range strings.Split(string(t.buffer), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > OUTPUT_TAIL_LINES {
+		lines = lines[len(lines)-OUTPUT_TAIL_LINES:]
+	}
+	return strings.Join(lines, "; ")
+}
+
+/*
+Check that the upload method is supported and that all of its variables are set, before anything is uploaded
+*/
+func checkConfiguration(method, scriptsDir string) error {
+	required, ok := requiredVariables[method]
+	if !ok {
+		return fmt.Errorf("Unsupported upload-method %q", method)
+	}
+	var missing []string
+	for _, name := range required {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Cannot upload via %s, %s not set", method, strings.Join(missing, ", "))
+	}
+	if _, err := os.Stat(getUploadScript(method, scriptsDir)); err != nil {
+		return fmt.Errorf("Cannot upload via %s: %v", method, err)
+	}
+	return nil
+}
+
+func getUploadScript(method, scriptsDir string) string {
+	return filepath.Join(scriptsDir, "upload_to_"+method+".sh")
+}
+
+/*
+Run the upload script once. Returns the location which the script reported, if any.
+*/
+func runUploadScript(script, archivePath string) (string, error) {
+	// upload scripts write the location of the uploaded archive to this file, e.g. the S3 object
+	locationFile, err := ioutil.TempFile("", "upload-location")
+	if err != nil {
+		return "", err
+	}
+	locationFile.Close()
+	defer os.Remove(locationFile.Name())
+
+	tail := &tailWriter{}
+	cmd := exec.Command(script)
+	cmd.Env = append(os.Environ(), "sosreport_file="+archivePath, "UPLOAD_LOCATION_FILE="+locationFile.Name())
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	if err := cmd.Run(); err != nil {
+		message := fmt.Sprintf("%s: %v", filepath.Base(script), err)
+		if output := tail.String(); output != "" {
+			message = fmt.Sprintf("%s: %s", message, output)
+		}
+		return "", fmt.Errorf("%s", message)
+	}
+
+	location, err := ioutil.ReadFile(locationFile.Name())
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(string(location)), nil
+}
+
+/*
+Upload the archive, retrying failed runs of the upload script with an exponential backoff
+*/
+func upload() uploadResult {
+	method := os.Getenv("UPLOAD_METHOD")
+	archivePath := os.Getenv("ARCHIVE_PATH")
+	scriptsDir := getenvDefault("SCRIPTS_DIR", DEFAULT_SCRIPTS_DIR)
+	result := uploadResult{Method: method, Result: RESULT_FAILED}
+
+	if err := checkConfiguration(method, scriptsDir); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		result.Message = fmt.Sprintf("Cannot read the archive: %v", err)
+		return result
+	}
+	result.Size = info.Size()
+
+	retries := DEFAULT_RETRIES
+	if value, err := strconv.Atoi(os.Getenv("UPLOAD_RETRIES")); err == nil && value > 0 {
+		retries = value
+	}
+	delay := DEFAULT_RETRY_DELAY
+	if value, err := time.ParseDuration(os.Getenv("UPLOAD_RETRY_DELAY")); err == nil && value >= 0 {
+		delay = value
+	}
+
+	script := getUploadScript(method, scriptsDir)
+	for attempt := 1; attempt <= retries; attempt++ {
+		result.Attempts = attempt
+		log.Printf("Uploading %s (%d bytes) via %s, attempt %d of %d", archivePath, result.Size, method, attempt, retries)
+		location, err := runUploadScript(script, archivePath)
+		if err == nil {
+			result.Result = RESULT_SUCCEEDED
+			result.Message = fmt.Sprintf("Uploaded %s", filepath.Base(archivePath))
+			result.Location = location
+			result.Retryable = false
+			return result
+		}
+		log.Printf("Upload failed: %v", err)
+		result.Message = err.Error()
+		result.Retryable = true
+		if attempt < retries {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return result
+}
+
+func getenvDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+/*
+Write the result to the termination log, where the operator picks it up
+*/
+func writeResult(result uploadResult) error {
+	if len(result.Message) > MAX_MESSAGE_LENGTH {
+		result.Message = result.Message[:MAX_MESSAGE_LENGTH]
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getenvDefault("TERMINATION_LOG", TERMINATION_LOG), data, 0644)
+}
+
+func main() {
+	result := upload()
+	log.Printf("Upload %s after %d attempt(s): %s", strings.ToLower(result.Result), result.Attempts, result.Message)
+	if err := writeResult(result); err != nil {
+		log.Printf("Could not write the termination log: %v", err)
+	}
+	if result.Result != RESULT_SUCCEEDED {
+		os.Exit(1)
+	}
+}
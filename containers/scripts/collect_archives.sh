@@ -0,0 +1,85 @@
+#!/bin/bash
+
+# Receives the sosreport archives of the sosreport jobs of a Sosreport in the Shared storage mode and stores them on
+# the shared PV. Sosreport jobs upload their archive with
+#   PUT /<job name>/<archive>
+#   Authorization: Bearer $COLLECTOR_TOKEN
+# Variables:
+# COLLECTOR_PORT - Port to listen on, defaults to 8080
+# COLLECTOR_TOKEN - Token which sosreport jobs authenticate with
+
+PV_DIR="/pv"
+port=${COLLECTOR_PORT:-8080}
+
+if [ "$COLLECTOR_TOKEN" == "" ]; then
+	echo "No collector token provided. Exiting script."
+	exit 1
+fi
+
+# CentOS 8 and RHEL 8 always ship the platform python, which sos runs on
+python=$(command -v python3 || echo /usr/libexec/platform-python)
+
+echo "Collecting archives in $PV_DIR on port $port"
+exec $python - "$PV_DIR" "$port" <<'PYTHON'
+import hmac
+import os
+import shutil
+import sys
+from http.server import BaseHTTPRequestHandler, HTTPServer
+from socketserver import ThreadingMixIn
+
+pv_dir, port = sys.argv[1], int(sys.argv[2])
+token = os.environ["COLLECTOR_TOKEN"]
+
+
+class ThreadingHTTPServer(ThreadingMixIn, HTTPServer):
+    daemon_threads = True
+
+
+class CollectorHandler(BaseHTTPRequestHandler):
+    def reply(self, code, message):
+        self.send_response(code)
+        self.send_header("Content-Type", "text/plain")
+        self.end_headers()
+        self.wfile.write((message + "\n").encode())
+
+    def do_GET(self):
+        # readiness
+        self.reply(200, "ok")
+
+    def do_PUT(self):
+        if not hmac.compare_digest(self.headers.get("Authorization", ""), "Bearer " + token):
+            self.reply(401, "invalid token")
+            return
+        parts = self.path.strip("/").split("/")
+        if len(parts) != 2 or any(p in ("", ".", "..") for p in parts):
+            self.reply(400, "expected /<job>/<archive>")
+            return
+        length = int(self.headers.get("Content-Length", "-1"))
+        if length < 0:
+            self.reply(411, "Content-Length is required")
+            return
+
+        directory = os.path.join(pv_dir, parts[0])
+        os.makedirs(directory, exist_ok=True)
+        path = os.path.join(directory, parts[1])
+        # a partial upload never replaces a complete archive
+        with open(path + ".part", "wb") as f:
+            remaining = length
+            while remaining > 0:
+                chunk = self.rfile.read(min(remaining, 1024 * 1024))
+                if not chunk:
+                    break
+                f.write(chunk)
+                remaining -= len(chunk)
+        if remaining > 0:
+            os.remove(path + ".part")
+            self.reply(400, "incomplete upload")
+            return
+        os.rename(path + ".part", path)
+        print("Stored %s (%d bytes)" % (path, length), flush=True)
+        self.reply(201, "stored " + os.path.join(parts[0], parts[1]))
+
+
+ThreadingHTTPServer(("", port), CollectorHandler).serve_forever()
+PYTHON
@@ -0,0 +1,76 @@
+#!/bin/bash
+
+# Serves the sosreport archives on the PV over HTTP. The operator streams them to users through the API server's
+# pod proxy. Archives are served with
+#   GET /<archive>
+#   X-Sosreport-Reader-Token: $ARCHIVE_SERVER_TOKEN
+# The API server removes the Authorization header of proxied requests, hence the header of its own. Directories are
+# not listed. GET /healthz answers without a token for the readiness probe.
+# Variables:
+# ARCHIVE_SERVER_PORT - Port to listen on, defaults to 8080
+# ARCHIVE_SERVER_TOKEN - Token which the operator authenticates with
+
+PV_DIR="/pv"
+port=${ARCHIVE_SERVER_PORT:-8080}
+
+if [ "$ARCHIVE_SERVER_TOKEN" == "" ]; then
+	echo "No archive server token provided. Exiting script."
+	exit 1
+fi
+
+# CentOS 8 and RHEL 8 always ship the platform python, which sos runs on
+python=$(command -v python3 || echo /usr/libexec/platform-python)
+
+echo "Serving $PV_DIR on port $port"
+exec $python - "$PV_DIR" "$port" <<'PYTHON'
+import hmac
+import os
+import shutil
+import sys
+from http.server import BaseHTTPRequestHandler, HTTPServer
+from socketserver import ThreadingMixIn
+from urllib.parse import unquote, urlsplit
+
+pv_dir, port = os.path.realpath(sys.argv[1]), int(sys.argv[2])
+token = os.environ["ARCHIVE_SERVER_TOKEN"]
+
+
+class ThreadingHTTPServer(ThreadingMixIn, HTTPServer):
+    daemon_threads = True
+
+
+class ReaderHandler(BaseHTTPRequestHandler):
+    def reply(self, code, message):
+        self.send_response(code)
+        self.send_header("Content-Type", "text/plain")
+        self.end_headers()
+        self.wfile.write((message + "\n").encode())
+
+    def do_GET(self):
+        path = unquote(urlsplit(self.path).path)
+        if path == "/healthz":
+            self.reply(200, "ok")
+            return
+        if not hmac.compare_digest(self.headers.get("X-Sosreport-Reader-Token", ""), token):
+            self.reply(401, "invalid token")
+            return
+        # only regular files below the PV are served
+        parts = path.strip("/").split("/")
+        if any(p in ("", ".", "..") for p in parts):
+            self.reply(400, "expected /<archive>")
+            return
+        file_path = os.path.realpath(os.path.join(pv_dir, *parts))
+        if not file_path.startswith(pv_dir + os.sep) or not os.path.isfile(file_path):
+            self.reply(404, "not found")
+            return
+
+        with open(file_path, "rb") as f:
+            self.send_response(200)
+            self.send_header("Content-Type", "application/octet-stream")
+            self.send_header("Content-Length", str(os.fstat(f.fileno()).st_size))
+            self.end_headers()
+            shutil.copyfileobj(f, self.wfile)
+
+
+ThreadingHTTPServer(("", port), ReaderHandler).serve_forever()
+PYTHON
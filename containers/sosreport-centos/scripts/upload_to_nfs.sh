@@ -18,5 +18,7 @@ fi
 
 echo "Uploading file $sosreport_file to NFS share $NFS_SHARE"
 cp $sosreport_file /mnt/.
+rc=$?
 
 umount $NFS_SHARE
+exit $rc
@@ -1,20 +1,42 @@
 #!/bin/bash
 
+# This script only collects the sosreport. The archive is uploaded by the operator's upload job, which runs
+# /usr/local/bin/sosreport-uploader and the upload_to_*.sh scripts.
+#
 # Variables:
-# UPLOAD_METHOD - case|ftp|nfs
-# USERNAME - username for portal or FTP
-# PASSWORD - password for portal or FTP
-# CASE_NUMBER - Case number for portal
-# NFS_SHARE - NFS share configuration
-# NFS_OPTIONS - NFS mount options
-# FTP_SERVER - FTP connection string
+# CASE_NUMBER - Case number which is passed to sosreport
 # DEBUG - Be more verbose
 # SIMULATION_MODE - If simulation mode is on, create a sosreport from the container instead of the host file system
 # OBFUSCATE - Obfuscate the attachment by running it through soscleaner to remove hostnames and IPs
+# SOS_ONLY_PLUGINS - Comma separated list of plugins for --only-plugins
+# SOS_SKIP_PLUGINS - Comma separated list of plugins for --skip-plugins
+# SOS_ENABLE_PLUGINS - Comma separated list of plugins for --enable-plugins
+# SOS_PLUGIN_OPTIONS - Comma separated list of plugin.option=value for --plugin-option
+# SOS_PROFILES - Comma separated list of profiles for --profiles
+# SOS_LOG_SIZE - Maximum log size in MiB for --log-size
+# SOS_ALL_LOGS - If true, pass --all-logs
+# SOS_SINCE - Only collect logs newer than YYYYMMDD[HHMMSS] with --since
+# COLLECTOR_URL - If set, hand off the archive to the Sosreport's collector at this URL
+# COLLECTOR_TOKEN - Token for the collector
+# LOCAL_ARCHIVE_DIR - If set, write the archive to this directory on the node instead of /pv and remove it after
+#                     the hand-off to the collector
+# SOSREPORT_NAMESPACE, SOSREPORT_NAME, NODE_NAME - The Sosreport and the node which this job collects the sosreport of
 
 export DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
 
 PV_DIR="/pv"
+# Archives of failed hand-offs are kept this many days in the parent of LOCAL_ARCHIVE_DIR
+LOCAL_ARCHIVE_RETENTION_DAYS=7
+# The operator reads the result of this job from the container's termination message
+TERMINATION_LOG="/dev/termination-log"
+
+archive=""
+
+write_termination_log() {
+	cat <<EOF > $TERMINATION_LOG
+archive=$archive
+EOF
+}
 
 if [ "$CASE_NUMBER" != "" ]; then
 	ticket_number="--ticket-number $CASE_NUMBER"
@@ -24,25 +46,79 @@ if [ "$DEBUG" == "true" ] ; then
 fi
 # When using kind, the host base image is Ubuntu, so the "real sosreport"
 # will not work
-# If simulation mode is on, create a sosreport from the container instead, just to 
+# If simulation mode is on, create a sosreport from the container instead, just to
 # have something
 simulation_mode="--sysroot /host"
 if [ "$SIMULATION_MODE" == "true" ]; then
 	simulation_mode="--tmp-dir /host/var/tmp"
 fi
 options="$ticket_number $verbose $simulation_mode"
-sosreport --batch  -k crio.all=on -k crio.logs=on $options | tee /tmp/log.txt
+
+# plugin selection and options from the Sosreport's spec
+# if SOS_PLUGIN_OPTIONS is not set at all, keep the defaults
+plugin_options=${SOS_PLUGIN_OPTIONS-crio.all=on,crio.logs=on}
+if [ "$plugin_options" != "" ]; then
+	options="$options --plugin-option $plugin_options"
+fi
+if [ "$SOS_ONLY_PLUGINS" != "" ]; then
+	options="$options --only-plugins $SOS_ONLY_PLUGINS"
+fi
+if [ "$SOS_SKIP_PLUGINS" != "" ]; then
+	options="$options --skip-plugins $SOS_SKIP_PLUGINS"
+fi
+if [ "$SOS_ENABLE_PLUGINS" != "" ]; then
+	options="$options --enable-plugins $SOS_ENABLE_PLUGINS"
+fi
+if [ "$SOS_PROFILES" != "" ]; then
+	options="$options --profiles $SOS_PROFILES"
+fi
+if [ "$SOS_LOG_SIZE" != "" ]; then
+	options="$options --log-size $SOS_LOG_SIZE"
+fi
+if [ "$SOS_ALL_LOGS" == "true" ]; then
+	options="$options --all-logs"
+fi
+if [ "$SOS_SINCE" != "" ]; then
+	options="$options --since $SOS_SINCE"
+fi
+
+if [ "$LOCAL_ARCHIVE_DIR" != "" ]; then
+	PV_DIR=$LOCAL_ARCHIVE_DIR
+	echo "Removing the archives of failed hand-offs older than $LOCAL_ARCHIVE_RETENTION_DAYS days"
+	find $(dirname $LOCAL_ARCHIVE_DIR) -mindepth 1 -maxdepth 1 -type d -mtime +$LOCAL_ARCHIVE_RETENTION_DAYS \
+		-exec rm -rf {} +
+	mkdir -p $PV_DIR
+fi
+
+echo "Collecting the sosreport of node $NODE_NAME for Sosreport $SOSREPORT_NAMESPACE/$SOSREPORT_NAME"
+echo "Running: sosreport --batch $options"
+sosreport --batch $options | tee /tmp/log.txt
 
 tmp_sosreport_file=$(grep 'tar.xz' /tmp/log.txt  | awk '{print $1}')
+if [ "$tmp_sosreport_file" == "" ] || [ ! -f "$tmp_sosreport_file" ]; then
+	echo "Could not find a sosreport archive in the sosreport output"
+	write_termination_log
+	exit 1
+fi
 sosreport_basename=$(basename $tmp_sosreport_file)
 export sosreport_file=$PV_DIR/$sosreport_basename
 echo "Moving file $tmp_sosreport_file to PV $sosreport_file"
 mv $tmp_sosreport_file $sosreport_file
+archive=$sosreport_basename
 
-if [ "$UPLOAD_METHOD" == "case" ]; then
-	${DIR}/upload_to_case.sh
-elif [ "$UPLOAD_METHOD" == "nfs" ]; then
-	${DIR}/upload_to_nfs.sh
-elif [ "$UPLOAD_METHOD" == "ftp" ]; then
-	${DIR}/upload_to_ftp.sh
+# in the Shared storage mode, /pv is a local volume and the collector stores the archive on the shared PV
+if [ "$COLLECTOR_URL" != "" ]; then
+	echo "Handing off $sosreport_file to the collector at $COLLECTOR_URL"
+	if ! curl -sSf --retry 10 --retry-delay 5 --retry-connrefused -T $sosreport_file \
+		-H "Authorization: Bearer $COLLECTOR_TOKEN" $COLLECTOR_URL/$sosreport_basename; then
+		echo "Could not hand off the archive to the collector"
+		write_termination_log
+		exit 1
+	fi
+	if [ "$LOCAL_ARCHIVE_DIR" != "" ]; then
+		echo "Removing the local copy in $LOCAL_ARCHIVE_DIR"
+		rm -rf $LOCAL_ARCHIVE_DIR
+	fi
 fi
+
+write_termination_log
@@ -0,0 +1,18 @@
+#!/bin/bash
+
+# Copies the sosreport archives on the PV to the export PV before their Sosreport is deleted.
+# Variables:
+# EXPORT_DIR - Directory below the export PV to copy the archives to, <namespace>/<sosreport>/<pvc>
+
+PV_DIR="/pv"
+EXPORT_PV_DIR="/export"
+
+if [ "$EXPORT_DIR" == "" ]; then
+	echo "No export directory provided. Exiting script."
+	exit 1
+fi
+
+export_dir=$EXPORT_PV_DIR/$EXPORT_DIR
+echo "Copying the archives in $PV_DIR to $export_dir"
+mkdir -p $export_dir || exit 1
+cp -av $PV_DIR/. $export_dir/
@@ -4,7 +4,7 @@ DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
 
 if [ "$CASE_NUMBER" == "" ] ; then
     echo "No case number provided. Cannot upload sosreport to case."
-    exit
+    exit 1
 fi
 if [ "$USERNAME" == "" ]; then
     echo "No username provided. Cannot upload sosreport to case."
@@ -28,5 +28,7 @@ case_number="-c $CASE_NUMBER"
 support_tool_options="$case_number $obfuscate"
 
 echo "n" | redhat-support-tool addattachment $support_tool_options $sosreport_file
+rc=$?
 # remove the authentication file
 rm -f /root/.redhat-support-tool/redhat-support-tool.conf
+exit $rc
@@ -0,0 +1,79 @@
+#!/bin/bash
+
+# Uploads the sosreport to an HTTP(S) endpoint, either as the body of a PUT request or as a multipart POST request.
+# Variables:
+# HTTP_URL - Template of the URL. {{namespace}}, {{sosreport}}, {{node}} and {{archive}} are replaced.
+# HTTP_METHOD - PUT or POST, defaults to PUT
+# HTTP_FORM_FIELD - Name of the form field of the archive with method POST, defaults to file
+# HTTP_HEADERS - Additional headers, one "Name: value" per line
+# HTTP_CA_BUNDLE - PEM encoded CA certificates which the server certificate is verified with
+# HTTP_EXPECTED_STATUS - Comma separated list of the status codes which mean success, defaults to 200,201,204
+# HTTP_BEARER_TOKEN - Bearer token for the Authorization header
+# USERNAME, PASSWORD - Credentials for basic authentication, if there is no bearer token
+# HTTP_CLIENT_CERT, HTTP_CLIENT_KEY - PEM encoded client certificate and key
+# SOSREPORT_NAMESPACE, SOSREPORT_NAME, NODE_NAME - Values for the URL template
+# UPLOAD_LOCATION_FILE - The URL is written to this file
+
+if [ "$HTTP_URL" == "" ]; then
+	echo "No HTTP URL provided. Exiting script."
+	exit 1
+fi
+
+archive=$(basename $sosreport_file)
+url="$HTTP_URL"
+url="${url//\{\{namespace\}\}/$SOSREPORT_NAMESPACE}"
+url="${url//\{\{sosreport\}\}/$SOSREPORT_NAME}"
+url="${url//\{\{node\}\}/$NODE_NAME}"
+url="${url//\{\{archive\}\}/$archive}"
+
+# credentials are passed in a config file, so that they do not show up in the process list
+tmp_dir=$(mktemp -d)
+trap "rm -rf $tmp_dir" EXIT
+curl_config=$tmp_dir/curl.conf
+touch $curl_config
+chmod 600 $curl_config
+if [ "$HTTP_BEARER_TOKEN" != "" ]; then
+	echo "header = \"Authorization: Bearer $HTTP_BEARER_TOKEN\"" >> $curl_config
+elif [ "$USERNAME" != "" ]; then
+	echo "user = \"$USERNAME:$PASSWORD\"" >> $curl_config
+fi
+if [ "$HTTP_CA_BUNDLE" != "" ]; then
+	echo "$HTTP_CA_BUNDLE" > $tmp_dir/ca.crt
+	echo "cacert = \"$tmp_dir/ca.crt\"" >> $curl_config
+fi
+if [ "$HTTP_CLIENT_CERT" != "" ]; then
+	echo "$HTTP_CLIENT_CERT" > $tmp_dir/tls.crt
+	echo "$HTTP_CLIENT_KEY" > $tmp_dir/tls.key
+	echo "cert = \"$tmp_dir/tls.crt\"" >> $curl_config
+	echo "key = \"$tmp_dir/tls.key\"" >> $curl_config
+fi
+headers=()
+while IFS= read -r header; do
+	if [ "$header" != "" ]; then
+		headers+=(-H "$header")
+	fi
+done <<< "$HTTP_HEADERS"
+
+method="${HTTP_METHOD:-PUT}"
+if [ "$method" == "POST" ]; then
+	body=(-F "${HTTP_FORM_FIELD:-file}=@$sosreport_file")
+elif [ "$method" == "PUT" ]; then
+	body=(-T "$sosreport_file")
+else
+	echo "Unsupported HTTP method $method. Exiting script."
+	exit 1
+fi
+
+echo "Uploading file $sosreport_file to $url with $method"
+status=$(curl -sS -K $curl_config "${headers[@]}" "${body[@]}" -X $method \
+	-o $tmp_dir/response -w '%{http_code}' "$url") || exit 1
+if [[ ",${HTTP_EXPECTED_STATUS:-200,201,204}," != *",$status,"* ]]; then
+	echo "Unexpected status code $status, the response was:"
+	head -c 4096 $tmp_dir/response
+	echo
+	exit 1
+fi
+echo "Upload finished with status code $status"
+if [ "$UPLOAD_LOCATION_FILE" != "" ]; then
+	echo "$url" > "$UPLOAD_LOCATION_FILE"
+fi
@@ -0,0 +1,47 @@
+#!/bin/bash
+
+# Uploads the sosreport to S3 or to an S3-compatible object storage such as MinIO or Ceph RGW.
+# Archives above the part size are uploaded with multipart uploads.
+# Variables:
+# S3_BUCKET - Bucket to upload to
+# S3_PREFIX - Optional prefix of the object key, e.g. cluster-a/
+# S3_REGION - Optional region of the bucket
+# S3_ENDPOINT - Optional URL of an S3-compatible object storage. Path-style addressing is used with it.
+# S3_PART_SIZE - Optional size of the parts of multipart uploads, in bytes or e.g. 64MB. Defaults to 64MB.
+# AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN - Credentials. Fall back to USERNAME and PASSWORD.
+# UPLOAD_LOCATION_FILE - The location of the uploaded object is written to this file
+
+if [ "$S3_BUCKET" == "" ]; then
+	echo "No S3 bucket provided. Exiting script."
+	exit 1
+fi
+
+if [ "$AWS_ACCESS_KEY_ID" == "" ] && [ "$USERNAME" != "" ]; then
+	export AWS_ACCESS_KEY_ID="$USERNAME"
+	export AWS_SECRET_ACCESS_KEY="$PASSWORD"
+fi
+
+# the configuration must be writable, the home directory may not be
+export AWS_CONFIG_FILE=$(mktemp)
+aws configure set default.s3.multipart_threshold "${S3_PART_SIZE:-64MB}"
+aws configure set default.s3.multipart_chunksize "${S3_PART_SIZE:-64MB}"
+if [ "$S3_REGION" != "" ]; then
+	aws configure set default.region "$S3_REGION"
+fi
+endpoint=()
+if [ "$S3_ENDPOINT" != "" ]; then
+	aws configure set default.s3.addressing_style path
+	endpoint=(--endpoint-url "$S3_ENDPOINT")
+fi
+
+prefix="$S3_PREFIX"
+if [ "$prefix" != "" ] && [ "${prefix: -1}" != "/" ]; then
+	prefix="$prefix/"
+fi
+key="${prefix}$(basename $sosreport_file)"
+
+echo "Uploading file $sosreport_file to s3://$S3_BUCKET/$key"
+aws "${endpoint[@]}" s3 cp --only-show-errors "$sosreport_file" "s3://$S3_BUCKET/$key" || exit 1
+if [ "$UPLOAD_LOCATION_FILE" != "" ]; then
+	echo "s3://$S3_BUCKET/$key" > "$UPLOAD_LOCATION_FILE"
+fi
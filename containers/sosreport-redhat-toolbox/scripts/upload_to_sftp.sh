@@ -0,0 +1,62 @@
+#!/bin/bash
+
+# Uploads the sosreport to an SFTP server with key-based authentication. The host key of the server must be pinned.
+# Variables:
+# SFTP_SERVER - Server to upload to, host or host:port
+# SFTP_KNOWN_HOSTS - known_hosts entries of the server
+# SFTP_PATH - Template of the remote directory, defaults to {{namespace}}/{{sosreport}}/{{node}}
+# USERNAME - User on the SFTP server
+# SSH_PRIVATE_KEY - Private key of the user
+# SOSREPORT_NAMESPACE, SOSREPORT_NAME, NODE_NAME - Values for the path template
+# UPLOAD_LOCATION_FILE - The location of the uploaded file is written to this file
+
+if [ "$SFTP_SERVER" == "" ]; then
+	echo "No SFTP server provided. Exiting script."
+	exit 1
+fi
+if [ "$SFTP_KNOWN_HOSTS" == "" ]; then
+	echo "No known_hosts entries provided, refusing to trust the host key of $SFTP_SERVER. Exiting script."
+	exit 1
+fi
+if [ "$USERNAME" == "" ] || [ "$SSH_PRIVATE_KEY" == "" ]; then
+	echo "No username or SSH private key provided. Exiting script."
+	exit 1
+fi
+
+ssh_dir=$(mktemp -d)
+trap "rm -rf $ssh_dir" EXIT
+echo "$SFTP_KNOWN_HOSTS" > $ssh_dir/known_hosts
+echo "$SSH_PRIVATE_KEY" > $ssh_dir/id
+chmod 600 $ssh_dir/id
+
+host="${SFTP_SERVER%:*}"
+port="22"
+if [ "$host" != "$SFTP_SERVER" ]; then
+	port="${SFTP_SERVER##*:}"
+fi
+
+remote_path="${SFTP_PATH:-{{namespace\}\}/{{sosreport\}\}/{{node\}\}}"
+remote_path="${remote_path//\{\{namespace\}\}/$SOSREPORT_NAMESPACE}"
+remote_path="${remote_path//\{\{sosreport\}\}/$SOSREPORT_NAME}"
+remote_path="${remote_path//\{\{node\}\}/$NODE_NAME}"
+remote_path="${remote_path%/}"
+
+# sftp cannot create parent directories, so create each of them and ignore the errors of existing ones
+batch_file=$ssh_dir/batch
+dir=""
+if [ "${remote_path:0:1}" == "/" ]; then
+	dir="/"
+fi
+for component in ${remote_path//\// }; do
+	dir="$dir$component/"
+	echo "-mkdir $dir" >> $batch_file
+done
+echo "put $sosreport_file $remote_path/" >> $batch_file
+
+echo "Uploading file $sosreport_file to $SFTP_SERVER:$remote_path/"
+sftp -b $batch_file -P "$port" -i $ssh_dir/id \
+	-o StrictHostKeyChecking=yes -o UserKnownHostsFile=$ssh_dir/known_hosts -o BatchMode=yes \
+	"$USERNAME@$host" || exit 1
+if [ "$UPLOAD_LOCATION_FILE" != "" ]; then
+	echo "sftp://$SFTP_SERVER/$remote_path/$(basename $sosreport_file)" > "$UPLOAD_LOCATION_FILE"
+fi
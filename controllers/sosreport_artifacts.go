@@ -0,0 +1,596 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	ARTIFACT_SERVER_PATH_PREFIX  = "/sosreports/" // path of the artifact server's API
+	ARTIFACTS_SUBRESOURCE        = "artifacts"    // users need get on sosreports/artifacts in order to download archives
+	ARCHIVE_READER_PORT          = 8080           // port of the HTTP server in the reader pods
+	ARCHIVE_READER_COMMAND       = "bash /scripts/serve_archives.sh"
+	ARCHIVE_READER_LIFETIME      = 10 * time.Minute // reader pods fail after this time and are deleted by the next download
+	ARCHIVE_READER_START_TIMEOUT = 2 * time.Minute  // how long a download waits for its reader pod
+	ARCHIVE_READER_POLL_INTERVAL = 2 * time.Second
+	ARCHIVE_READER_HEALTH_PATH   = "/healthz" // the only path of a reader pod which answers without a token
+	// the API server removes the Authorization header of proxied requests, so the token has a header of its own
+	ARCHIVE_READER_TOKEN_HEADER = "X-Sosreport-Reader-Token"
+	ARCHIVE_READER_TOKEN_KEY    = "token" // key of a reader pod's token in its Secret
+	// label of the namespaces of host network traffic on OpenShift
+	HOST_NETWORK_POLICY_GROUP_LABEL = "policy-group.network.openshift.io/host-network"
+	// namespaces which the NetworkPolicy of the reader pods admits by default
+	DEFAULT_READER_NAMESPACE_SELECTOR = HOST_NETWORK_POLICY_GROUP_LABEL + "="
+	ARTIFACT_SERVER_SHUTDOWN          = 10 * time.Second
+)
+
+// +kubebuilder:rbac:groups="",resources=pods/proxy,verbs=get
+// +kubebuilder:rbac:groups="networking.k8s.io",resources=networkpolicies,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="authentication.k8s.io",resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups="authorization.k8s.io",resources=subjectaccessreviews,verbs=create
+
+// ArtifactServer lists and streams the sosreport archives on the PVCs of the sosreport jobs.
+// Archives are read through short-lived reader pods which mount the PVC, as the operator cannot mount PVCs itself.
+type ArtifactServer struct {
+	Client client.Client
+	// APIReader reads the reader pods, their Secrets and NetworkPolicies directly from the API server, so that the
+	// cache holds no pods
+	APIReader client.Reader
+	Clientset kubernetes.Interface
+	Scheme    *runtime.Scheme
+	Log       logr.Logger
+	// BindAddress is the address which the server listens on, e.g. :8082
+	BindAddress string
+	// CertDir holds tls.crt and tls.key. The server uses plain HTTP if it is empty.
+	CertDir string
+	// ReaderNamespaceSelector selects the namespaces which the NetworkPolicy of the reader pods admits. No
+	// NetworkPolicy is created if it is nil.
+	ReaderNamespaceSelector *metav1.LabelSelector
+}
+
+// sosreportArtifact is one archive in the list of archives of a Sosreport
+type sosreportArtifact struct {
+	NodeName string `json:"nodeName"`
+	PVCName  string `json:"pvcName"`
+	Archive  string `json:"archive"`
+	Path     string `json:"path"`
+}
+
+/*
+Add the artifact server to the manager. It runs on every replica, not just on the leader.
+*/
+func (a *ArtifactServer) SetupWithManager(mgr ctrl.Manager) error {
+	if a.Client == nil {
+		a.Client = mgr.GetClient()
+	}
+	if a.APIReader == nil {
+		a.APIReader = mgr.GetAPIReader()
+	}
+	if a.Scheme == nil {
+		a.Scheme = mgr.GetScheme()
+	}
+	if a.Clientset == nil {
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		a.Clientset = clientset
+	}
+	return mgr.Add(a)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (a *ArtifactServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable
+func (a *ArtifactServer) Start(stop <-chan struct{}) error {
+	server := &http.Server{
+		Addr:    a.BindAddress,
+		Handler: a,
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		a.Log.Info("Starting artifact server", "address", a.BindAddress)
+		if a.CertDir != "" {
+			errChan <- server.ListenAndServeTLS(filepath.Join(a.CertDir, "tls.crt"), filepath.Join(a.CertDir, "tls.key"))
+		} else {
+			errChan <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case <-stop:
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ARTIFACT_SERVER_SHUTDOWN)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errChan:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	}
+}
+
+/*
+Serve the artifact API:
+GET /sosreports/<namespace>/<name>         lists the archives of a Sosreport
+GET /sosreports/<namespace>/<name>/<node>  streams the archive of a node
+*/
+func (a *ArtifactServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace, name, nodeName, ok := parseArtifactPath(req.URL.Path)
+	if !ok {
+		http.Error(w, "expected "+ARTIFACT_SERVER_PATH_PREFIX+"<namespace>/<name>[/<node>]", http.StatusNotFound)
+		return
+	}
+	if status, err := a.authorize(req, namespace, name); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	s := &supportv1alpha1.Sosreport{}
+	if err := a.Client.Get(req.Context(), types.NamespacedName{Namespace: namespace, Name: name}, s); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("Sosreport %s/%s not found", namespace, name), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if nodeName == "" {
+		a.serveArtifactList(w, s)
+		return
+	}
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.NodeName == nodeName && nodeStatus.Archive != "" && nodeStatus.PVCName != "" {
+			a.serveArchive(w, req, s, nodeStatus)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("Sosreport %s/%s has no archive of node %s", namespace, name, nodeName), http.StatusNotFound)
+}
+
+/*
+Split an artifact path into the namespace and name of the Sosreport and the optional node name
+*/
+func parseArtifactPath(path string) (string, string, string, bool) {
+	if !strings.HasPrefix(path, ARTIFACT_SERVER_PATH_PREFIX) {
+		return "", "", "", false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, ARTIFACT_SERVER_PATH_PREFIX), "/"), "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", "", "", false
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], "", true
+	case 3:
+		return parts[0], parts[1], parts[2], true
+	}
+	return "", "", "", false
+}
+
+/*
+Get the URL which lists the archives of a Sosreport, relative to the artifact server's base URL
+*/
+func getArtifactsURL(baseURL string, s *supportv1alpha1.Sosreport) string {
+	return strings.TrimSuffix(baseURL, "/") + ARTIFACT_SERVER_PATH_PREFIX +
+		url.PathEscape(s.Namespace) + "/" + url.PathEscape(s.Name)
+}
+
+/*
+Get the URL which streams the archive of a node, relative to the artifact server's base URL
+*/
+func getArchiveURL(baseURL string, s *supportv1alpha1.Sosreport, nodeName string) string {
+	return getArtifactsURL(baseURL, s) + "/" + url.PathEscape(nodeName)
+}
+
+/*
+Authenticate the bearer token of a request with a TokenReview and make sure with a SubjectAccessReview that its user
+may get the artifacts of the Sosreport. Returns the HTTP status code to reply with if the request is denied.
+*/
+func (a *ArtifactServer) authorize(req *http.Request, namespace, name string) (int, error) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == req.Header.Get("Authorization") {
+		return http.StatusUnauthorized, fmt.Errorf("a bearer token is required")
+	}
+
+	tokenReview := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+	if err := a.Client.Create(req.Context(), tokenReview); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !tokenReview.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+	}
+
+	user := tokenReview.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	subjectAccessReview := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        "get",
+				Group:       supportv1alpha1.GroupVersion.Group,
+				Resource:    "sosreports",
+				Subresource: ARTIFACTS_SUBRESOURCE,
+				Name:        name,
+			},
+		},
+	}
+	if err := a.Client.Create(req.Context(), subjectAccessReview); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !subjectAccessReview.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("user %s may not get sosreports/%s of %s/%s",
+			user.Username, ARTIFACTS_SUBRESOURCE, namespace, name)
+	}
+	return http.StatusOK, nil
+}
+
+/*
+Reply with the list of archives of a Sosreport
+*/
+func (a *ArtifactServer) serveArtifactList(w http.ResponseWriter, s *supportv1alpha1.Sosreport) {
+	artifacts := []sosreportArtifact{}
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.Archive == "" || nodeStatus.PVCName == "" {
+			continue
+		}
+		artifacts = append(artifacts, sosreportArtifact{
+			NodeName: nodeStatus.NodeName,
+			PVCName:  nodeStatus.PVCName,
+			Archive:  nodeStatus.Archive,
+			Path:     getArchiveURL("", s, nodeStatus.NodeName),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(artifacts); err != nil {
+		a.Log.V(DEBUG).Info("Could not write the list of archives", "err", err)
+	}
+}
+
+/*
+Stream the archive of a node from its reader pod through the API server's pod proxy
+*/
+func (a *ArtifactServer) serveArchive(w http.ResponseWriter, req *http.Request, s *supportv1alpha1.Sosreport, nodeStatus supportv1alpha1.SosreportNodeStatus) {
+	pod, err := a.getArchiveReaderPod(req.Context(), s, nodeStatus.PVCName)
+	if err != nil {
+		a.Log.Error(err, "Could not start the reader pod", "Sosreport.Namespace", s.Namespace, "PVC", nodeStatus.PVCName)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	token, err := a.getArchiveReaderToken(req.Context(), pod)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	stream, err := a.Clientset.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", pod.Name, ARCHIVE_READER_PORT)).
+		SubResource("proxy").
+		Suffix(nodeStatus.Archive).
+		SetHeader(ARCHIVE_READER_TOKEN_HEADER, token).
+		Stream(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(nodeStatus.Archive)))
+	if _, err := io.Copy(w, stream); err != nil {
+		a.Log.V(DEBUG).Info("Streaming of archive aborted", "archive", nodeStatus.Archive, "err", err)
+	}
+}
+
+/*
+Read the token of a reader pod from its Secret
+*/
+func (a *ArtifactServer) getArchiveReaderToken(ctx context.Context, pod *corev1.Pod) (string, error) {
+	secret := &corev1.Secret{}
+	if err := a.APIReader.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, secret); err != nil {
+		return "", fmt.Errorf("could not read the token of reader pod %s: %v", pod.Name, err)
+	}
+	return string(secret.Data[ARCHIVE_READER_TOKEN_KEY]), nil
+}
+
+/*
+Get the ready reader pod of a PVC. The pod, its token Secret and the NetworkPolicy of the Sosreport's reader pods are
+created if they do not exist. A pod which reached the end of its lifetime is replaced together with its Secret, so
+that every reader pod has a token of its own.
+*/
+func (a *ArtifactServer) getArchiveReaderPod(ctx context.Context, s *supportv1alpha1.Sosreport, pvcName string) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	namespacedName := types.NamespacedName{Namespace: s.Namespace, Name: pvcName + "-reader"}
+	if err := a.ensureArchiveReaderNetworkPolicy(ctx, s); err != nil {
+		return nil, err
+	}
+	err := wait.PollImmediate(ARCHIVE_READER_POLL_INTERVAL, ARCHIVE_READER_START_TIMEOUT, func() (bool, error) {
+		err := a.APIReader.Get(ctx, namespacedName, pod)
+		if apierrors.IsNotFound(err) {
+			secret, err := a.readerSecretForSosreport(s, namespacedName.Name)
+			if err != nil {
+				return false, err
+			}
+			if err := a.Client.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+				return false, err
+			}
+			readerPod, err := a.readerPodForSosreport(s, namespacedName.Name, pvcName)
+			if err != nil {
+				return false, err
+			}
+			a.Log.V(INFO).Info("Creating reader pod", "Pod.Namespace", readerPod.Namespace, "Pod.Name", readerPod.Name)
+			if err := a.Client.Create(ctx, readerPod); err != nil && !apierrors.IsAlreadyExists(err) {
+				return false, err
+			}
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		switch {
+		case pod.DeletionTimestamp != nil:
+			return false, nil
+		case pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+			// the reader pod reached its activeDeadlineSeconds
+			err := a.Client.Delete(ctx, pod, client.GracePeriodSeconds(0))
+			if err != nil && !apierrors.IsNotFound(err) {
+				return false, err
+			}
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+			if err := a.Client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+				return false, err
+			}
+			return false, nil
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reader pod %s did not become ready: %v", namespacedName, err)
+	}
+	return pod, nil
+}
+
+/*
+Return the labels of the reader pods of a Sosreport
+*/
+func labelsForSosreportReader(name string) map[string]string {
+	return map[string]string{"app": "sosreport-reader", "sosreport": name}
+}
+
+/*
+Create the definition of the Secret with the token which the operator authenticates with at a reader pod. The Secret
+has the name of the pod.
+*/
+func (a *ArtifactServer) readerSecretForSosreport(s *supportv1alpha1.Sosreport, podName string) (*corev1.Secret, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: s.Namespace,
+			Labels:    labelsForSosreportReader(s.Name),
+		},
+		StringData: map[string]string{
+			ARCHIVE_READER_TOKEN_KEY: token,
+		},
+	}
+	if err := controllerutil.SetControllerReference(s, secret, a.Scheme); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+/*
+Create the NetworkPolicy of a Sosreport's reader pods unless it exists. The operator reaches them through the API
+server's pod proxy, so only traffic from the host network is admitted, which OpenShift assigns to the namespaces with
+the host-network policy group label. Other clusters identify the API server differently, so the namespaces are
+selected by the ReaderNamespaceSelector, and the NetworkPolicy is skipped without one.
+*/
+func (a *ArtifactServer) ensureArchiveReaderNetworkPolicy(ctx context.Context, s *supportv1alpha1.Sosreport) error {
+	if a.ReaderNamespaceSelector == nil {
+		return nil
+	}
+	policy := &networkingv1.NetworkPolicy{}
+	namespacedName := types.NamespacedName{Namespace: s.Namespace, Name: s.Name + "-reader"}
+	err := a.APIReader.Get(ctx, namespacedName, policy)
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	policy = a.readerNetworkPolicyForSosreport(s, namespacedName.Name)
+	if err := controllerutil.SetControllerReference(s, policy, a.Scheme); err != nil {
+		return err
+	}
+	a.Log.V(INFO).Info("Creating reader NetworkPolicy", "NetworkPolicy.Namespace", policy.Namespace,
+		"NetworkPolicy.Name", policy.Name)
+	if err := a.Client.Create(ctx, policy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+/*
+Create the definition of the NetworkPolicy which restricts the ingress of the reader pods of a Sosreport
+*/
+func (a *ArtifactServer) readerNetworkPolicyForSosreport(s *supportv1alpha1.Sosreport, name string) *networkingv1.NetworkPolicy {
+	port := intstr.FromInt(ARCHIVE_READER_PORT)
+	protocol := corev1.ProtocolTCP
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.Namespace,
+			Labels:    labelsForSosreportReader(s.Name),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: labelsForSosreportReader(s.Name)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: a.ReaderNamespaceSelector.DeepCopy(),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+/*
+Create the definition of a reader pod, which serves the archives on a PVC over HTTP to holders of its token
+*/
+func (a *ArtifactServer) readerPodForSosreport(s *supportv1alpha1.Sosreport, podName, pvcName string) (*corev1.Pod, error) {
+	image := DEFAULT_IMAGE_NAME
+	imagePullPolicy := corev1.PullPolicy(DEFAULT_IMAGE_PULL_POLICY)
+	if ec := s.Status.EffectiveConfiguration; ec != nil {
+		image = ec.Image
+		imagePullPolicy = corev1.PullPolicy(ec.ImagePullPolicy)
+	}
+	activeDeadlineSeconds := int64(ARCHIVE_READER_LIFETIME.Seconds())
+	// the archives are only readable by root, which needs no further privileges to read them
+	runAsUser := int64(0)
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: s.Namespace,
+			Labels:    labelsForSosreportReader(s.Name),
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &activeDeadlineSeconds,
+			Tolerations:           s.Spec.Tolerations,
+			Containers: []corev1.Container{
+				{
+					Name:            "reader",
+					Image:           image,
+					ImagePullPolicy: imagePullPolicy,
+					Command:         strings.Split(ARCHIVE_READER_COMMAND, " "),
+					Env: []corev1.EnvVar{
+						{Name: "ARCHIVE_SERVER_PORT", Value: strconv.Itoa(ARCHIVE_READER_PORT)},
+						{
+							Name: "ARCHIVE_SERVER_TOKEN",
+							ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: podName},
+									Key:                  ARCHIVE_READER_TOKEN_KEY,
+								},
+							},
+						},
+					},
+					Ports: []corev1.ContainerPort{
+						{Name: "http", ContainerPort: ARCHIVE_READER_PORT},
+					},
+					ReadinessProbe: &corev1.Probe{
+						Handler: corev1.Handler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path: ARCHIVE_READER_HEALTH_PATH,
+								Port: intstr.FromInt(ARCHIVE_READER_PORT),
+							},
+						},
+						PeriodSeconds: 2,
+					},
+					SecurityContext: &corev1.SecurityContext{
+						RunAsUser:                &runAsUser,
+						AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+						ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "pv", MountPath: "/pv", ReadOnly: true},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "pv",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvcName,
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+		},
+	}
+	// reader pods are deleted together with their Sosreport
+	if err := controllerutil.SetControllerReference(s, pod, a.Scheme); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
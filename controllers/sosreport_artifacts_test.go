@@ -0,0 +1,132 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Artifact server", func() {
+
+	s := &supportv1alpha1.Sosreport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "artifacts",
+			Namespace: "default",
+			UID:       "00000000-0000-0000-0000-000000000000",
+		},
+	}
+
+	Context("When building and parsing artifact paths", func() {
+		It("Should round-trip the Sosreport and the node", func() {
+			Expect(getArtifactsURL("https://artifacts.example.com/", s)).To(
+				Equal("https://artifacts.example.com/sosreports/default/artifacts"))
+			archiveURL := getArchiveURL("", s, "worker-0")
+			Expect(archiveURL).To(Equal("/sosreports/default/artifacts/worker-0"))
+
+			namespace, name, nodeName, ok := parseArtifactPath(archiveURL)
+			Expect(ok).To(BeTrue())
+			Expect([]string{namespace, name, nodeName}).To(Equal([]string{"default", "artifacts", "worker-0"}))
+
+			_, _, nodeName, ok = parseArtifactPath("/sosreports/default/artifacts/")
+			Expect(ok).To(BeTrue())
+			Expect(nodeName).To(BeEmpty())
+
+			for _, path := range []string{"/", "/sosreports/default", "/sosreports/default//worker-0", "/sosreports/a/b/c/d"} {
+				_, _, _, ok = parseArtifactPath(path)
+				Expect(ok).To(BeFalse(), path)
+			}
+		})
+	})
+
+	Context("When serving requests", func() {
+		It("Should reject requests without a bearer token", func() {
+			a := &ArtifactServer{Client: k8sClient}
+
+			recorder := httptest.NewRecorder()
+			a.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sosreports/default/artifacts", nil))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+
+			recorder = httptest.NewRecorder()
+			a.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/sosreports/default/artifacts", nil))
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Context("When creating reader pods", func() {
+		It("Should mount the PVC read-only and be owned by the Sosreport", func() {
+			a := &ArtifactServer{Scheme: scheme.Scheme}
+
+			pod, err := a.readerPodForSosreport(s, "pvc-0-reader", "pvc-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pod.Spec.Volumes).To(HaveLen(1))
+			Expect(pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("pvc-0"))
+			Expect(pod.Spec.Volumes[0].PersistentVolumeClaim.ReadOnly).To(BeTrue())
+			Expect(pod.Spec.Containers[0].VolumeMounts[0].ReadOnly).To(BeTrue())
+			securityContext := pod.Spec.Containers[0].SecurityContext
+			Expect(securityContext.Privileged).To(BeNil())
+			Expect(*securityContext.RunAsUser).To(Equal(int64(0)))
+			Expect(*securityContext.AllowPrivilegeEscalation).To(BeFalse())
+			Expect(pod.Spec.ActiveDeadlineSeconds).NotTo(BeNil())
+			Expect(pod.OwnerReferences).To(HaveLen(1))
+			Expect(pod.OwnerReferences[0].UID).To(Equal(s.UID))
+		})
+
+		It("Should give every reader pod a token of its own and admit no other pods", func() {
+			readerNamespaceSelector, err := metav1.ParseToLabelSelector(DEFAULT_READER_NAMESPACE_SELECTOR)
+			Expect(err).NotTo(HaveOccurred())
+			a := &ArtifactServer{Scheme: scheme.Scheme, ReaderNamespaceSelector: readerNamespaceSelector}
+
+			pod, err := a.readerPodForSosreport(s, "pvc-0-reader", "pvc-0")
+			Expect(err).NotTo(HaveOccurred())
+			container := pod.Spec.Containers[0]
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal(ARCHIVE_READER_HEALTH_PATH))
+			var tokenRef *corev1.SecretKeySelector
+			for _, env := range container.Env {
+				if env.Name == "ARCHIVE_SERVER_TOKEN" {
+					tokenRef = env.ValueFrom.SecretKeyRef
+				}
+			}
+			Expect(tokenRef).NotTo(BeNil())
+			Expect(tokenRef.Name).To(Equal(pod.Name))
+
+			secret, err := a.readerSecretForSosreport(s, pod.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.StringData[tokenRef.Key]).To(HaveLen(64))
+			Expect(secret.OwnerReferences[0].UID).To(Equal(s.UID))
+			otherSecret, err := a.readerSecretForSosreport(s, pod.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otherSecret.StringData[tokenRef.Key]).NotTo(Equal(secret.StringData[tokenRef.Key]))
+
+			policy := a.readerNetworkPolicyForSosreport(s, s.Name+"-reader")
+			Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(pod.Labels))
+			Expect(policy.Spec.Ingress).To(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].From).To(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].From[0].PodSelector).To(BeNil())
+			Expect(policy.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels).To(
+				Equal(map[string]string{HOST_NETWORK_POLICY_GROUP_LABEL: ""}))
+		})
+	})
+})
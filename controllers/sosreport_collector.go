@@ -0,0 +1,413 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	resourcev1 "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	COLLECTOR_PORT         = 8080 // port of the HTTP server in the collector pod
+	COLLECTOR_COMMAND      = "bash /scripts/collect_archives.sh"
+	COLLECTOR_TOKEN_KEY    = "token"                       // key of the collector's token in its Secret
+	COLLECTOR_HOST_PATH    = "/var/tmp/sosreport-operator" // parent directory of the HostPath local volumes
+	ARCHIVE_DIR_ANNOTATION = "archiveDir"                  // directory of a job's archive on the shared PVC
+	LOCAL_ARCHIVE_VOLUME   = "archives"                    // name of the local volume in the Shared storage mode
+)
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;delete
+
+/*
+Get the storage mode of a Sosreport
+*/
+func getStorageMode(s *supportv1alpha1.Sosreport) supportv1alpha1.SosreportStorageMode {
+	if s.Spec.Storage == nil || s.Spec.Storage.Mode == "" {
+		return supportv1alpha1.StorageModePerNode
+	}
+	return s.Spec.Storage.Mode
+}
+
+/*
+The collector job, its Service and its Secret share the same name
+*/
+func getCollectorName(s *supportv1alpha1.Sosreport) string {
+	return s.Name + "-collector"
+}
+
+/*
+Get the name of the PVC which holds the archives of all nodes in the Shared storage mode
+*/
+func getSharedPVCName(s *supportv1alpha1.Sosreport) string {
+	return s.Name + "-archives"
+}
+
+/*
+Return the labels of the collector job's pod. They differ from the labels of sosreport jobs, so that the collector
+is neither mistaken for a node's job nor counted against the concurrency limits.
+*/
+func labelsForSosreportCollector(name string) map[string]string {
+	return map[string]string{"app": "sosreport-collector", "sosreport-cr": name}
+}
+
+/*
+Create the shared PVC, the token Secret, the Service and the Job of a Sosreport's collector, unless the collector job
+exists already. All of them are owned by the Sosreport.
+*/
+func (r *SosreportReconciler) ensureSosreportCollector(s *supportv1alpha1.Sosreport, conf *sosreportConfiguration) error {
+	existingJob := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: getCollectorName(s)}, existingJob)
+	if err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	pvc, err := r.sharedPVCForSosreport(s, conf)
+	if err != nil {
+		return err
+	}
+	secret, err := collectorSecretForSosreport(s)
+	if err != nil {
+		return err
+	}
+	objects := []collectorObject{
+		pvc,
+		secret,
+		collectorServiceForSosreport(s),
+		collectorJobForSosreport(s, conf),
+	}
+	for _, o := range objects {
+		if err := ctrl.SetControllerReference(s, o, r.Scheme); err != nil {
+			return err
+		}
+		log.V(INFO).Info("Creating collector resource", "namespace", s.Namespace, "name", o.GetName(),
+			"kind", fmt.Sprintf("%T", o))
+		// the Secret of an earlier, failed attempt is kept, as running jobs may already use its token
+		if err := r.Create(ctx, o); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	r.recorder.Event(s, corev1.EventTypeNormal, "Sosreport collector started",
+		"Archives are collected on PVC "+getSharedPVCName(s))
+	return nil
+}
+
+// collectorObject is one of the resources of a collector, which are created and owned by their Sosreport
+type collectorObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+/*
+Create the definition of the PVC which holds the archives of all nodes
+*/
+func (r *SosreportReconciler) sharedPVCForSosreport(s *supportv1alpha1.Sosreport, conf *sosreportConfiguration) (*corev1.PersistentVolumeClaim, error) {
+	accessMode := corev1.ReadWriteMany
+	if s.Spec.Storage.AccessMode != "" {
+		accessMode = s.Spec.Storage.AccessMode
+	}
+	var capacity resourcev1.Quantity
+	if s.Spec.Storage.Capacity != nil {
+		capacity = *s.Spec.Storage.Capacity
+	} else {
+		var err error
+		if capacity, err = getPVCCapacity(conf); err != nil {
+			return nil, err
+		}
+	}
+	var storageClassName *string
+	if conf.pvcStorageClass != "" {
+		storageClassName = &conf.pvcStorageClass
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getSharedPVCName(s),
+			Namespace: s.Namespace,
+			Labels:    r.labelsForSosreportJob(s.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{accessMode},
+			StorageClassName: storageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: capacity,
+				},
+			},
+		},
+	}, nil
+}
+
+/*
+Create the definition of the Secret with the token which sosreport jobs authenticate with at the collector
+*/
+func collectorSecretForSosreport(s *supportv1alpha1.Sosreport) (*corev1.Secret, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getCollectorName(s),
+			Namespace: s.Namespace,
+			Labels:    labelsForSosreportCollector(s.Name),
+		},
+		StringData: map[string]string{
+			COLLECTOR_TOKEN_KEY: token,
+		},
+	}, nil
+}
+
+/*
+Generate a random token for the authentication of the operator's own pods
+*/
+func generateToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+/*
+Create the definition of the Service which sosreport jobs hand off their archives to
+*/
+func collectorServiceForSosreport(s *supportv1alpha1.Sosreport) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getCollectorName(s),
+			Namespace: s.Namespace,
+			Labels:    labelsForSosreportCollector(s.Name),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labelsForSosreportCollector(s.Name),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       COLLECTOR_PORT,
+					TargetPort: intstr.FromInt(COLLECTOR_PORT),
+				},
+			},
+		},
+	}
+}
+
+/*
+Get the environment variable which passes the collector's token to a container
+*/
+func getCollectorTokenEnvVar(s *supportv1alpha1.Sosreport) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: "COLLECTOR_TOKEN",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: getCollectorName(s)},
+				Key:                  COLLECTOR_TOKEN_KEY,
+			},
+		},
+	}
+}
+
+/*
+Create the definition of the collector job. Its pod receives the archives of the sosreport jobs and writes them to
+the shared PVC. It runs until the operator deletes it once all sosreport jobs are done.
+*/
+func collectorJobForSosreport(s *supportv1alpha1.Sosreport, conf *sosreportConfiguration) *batchv1.Job {
+	labels := labelsForSosreportCollector(s.Name)
+	privileged := true
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getCollectorName(s),
+			Namespace: s.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					// a crashed collector is restarted in place, so that it keeps its node with a RWO PVC
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Tolerations:   s.Spec.Tolerations,
+					Containers: []corev1.Container{
+						{
+							Name:    "collector",
+							Image:   conf.imageName,
+							Command: strings.Split(COLLECTOR_COMMAND, " "),
+							Env: []corev1.EnvVar{
+								{Name: "COLLECTOR_PORT", Value: strconv.Itoa(COLLECTOR_PORT)},
+								getCollectorTokenEnvVar(s),
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: "http", ContainerPort: COLLECTOR_PORT},
+							},
+							// the archives are only readable by root
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: &privileged,
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "pv", MountPath: "/pv"},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "pv",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: getSharedPVCName(s),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if conf.imagePullPolicy != "" {
+		job.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullPolicy(conf.imagePullPolicy)
+	}
+	return job
+}
+
+/*
+Let a sosreport job write its archive to a local volume and hand it off to the collector, instead of writing it
+to a PVC of its own
+*/
+func useSosreportCollector(job *batchv1.Job, s *supportv1alpha1.Sosreport) {
+	container := &job.Spec.Template.Spec.Containers[0]
+	localVolume := corev1.Volume{Name: LOCAL_ARCHIVE_VOLUME}
+	localVolumeMount := corev1.VolumeMount{
+		Name:      LOCAL_ARCHIVE_VOLUME,
+		MountPath: "/pv",
+	}
+	if s.Spec.Storage.LocalVolume == supportv1alpha1.LocalVolumeHostPath {
+		// the job gets the parent directory, so that it can remove its own directory after the hand-off and the
+		// leftovers of failed hand-offs of earlier jobs
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		localVolume.VolumeSource = corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: COLLECTOR_HOST_PATH,
+				Type: &hostPathType,
+			},
+		}
+		localVolumeMount.MountPath = COLLECTOR_HOST_PATH
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "LOCAL_ARCHIVE_DIR",
+			Value: COLLECTOR_HOST_PATH + "/" + job.Name,
+		})
+	} else {
+		localVolume.VolumeSource = corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		}
+	}
+	job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, localVolume)
+
+	// sosreport jobs use the host network, which only resolves Service names with this DNS policy
+	job.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+
+	container.VolumeMounts = append(container.VolumeMounts, localVolumeMount)
+	// every attempt gets a directory of its own on the shared PVC
+	container.Env = append(container.Env,
+		corev1.EnvVar{
+			Name: "COLLECTOR_URL",
+			Value: fmt.Sprintf("http://%s.%s.svc:%d/%s", getCollectorName(s), s.Namespace, COLLECTOR_PORT,
+				job.Name),
+		},
+		getCollectorTokenEnvVar(s),
+	)
+	job.Annotations["pvcName"] = getSharedPVCName(s)
+	job.Annotations[ARCHIVE_DIR_ANNOTATION] = job.Name
+}
+
+/*
+Check if the collector job of a Sosreport failed. Its pod is restarted on failure, so the job only fails once it
+exhausted its backoff limit.
+*/
+func (r *SosreportReconciler) isSosreportCollectorFailed(s *supportv1alpha1.Sosreport) (bool, error) {
+	if getStorageMode(s) != supportv1alpha1.StorageModeShared {
+		return false, nil
+	}
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: getCollectorName(s)}, job)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	done, conditionType := isJobDone(*job)
+	return done && conditionType == batchv1.JobFailed, nil
+}
+
+/*
+Fail a Sosreport whose collector job failed. The archives of the nodes which are not done, yet, can no longer be
+handed off, so their jobs are deleted and the nodes fail. Pending uploads are skipped, as the Sosreport is finished.
+*/
+func (r *SosreportReconciler) failSosreportCollector(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
+	message := fmt.Sprintf("The collector job %s failed", getCollectorName(s))
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		if nodeStatus.State == supportv1alpha1.NodeStateDone {
+			continue
+		}
+		if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+			if err := r.deleteSosreportJob(s.Namespace, nodeStatus.JobName, message); err != nil {
+				return err
+			}
+		}
+		completionTime := metav1.Now()
+		nodeStatus.State = supportv1alpha1.NodeStateDone
+		nodeStatus.Outcome = supportv1alpha1.NodeOutcomeFailed
+		nodeStatus.Reason = message
+		nodeStatus.CompletionTime = &completionTime
+		nodeStatus.NextAttemptTime = nil
+	}
+	if err := r.cancelSosreportUploads(s); err != nil {
+		return err
+	}
+	r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport collector failed", message)
+	s.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+	setSosreportCondition(s, supportv1alpha1.ConditionCollected, metav1.ConditionFalse, "CollectorFailed", message)
+	setSosreportCondition(s, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse, "CollectorFailed", message)
+	r.synchronizeRunningStatus(s, req)
+	return nil
+}
+
+/*
+Stop the collector job of a Sosreport once all of its sosreport jobs are done. The shared PVC is kept.
+*/
+func (r *SosreportReconciler) stopSosreportCollector(s *supportv1alpha1.Sosreport) error {
+	if getStorageMode(s) != supportv1alpha1.StorageModeShared {
+		return nil
+	}
+	return r.deleteSosreportJob(s.Namespace, getCollectorName(s), "All sosreport jobs are done")
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport shared storage", func() {
+
+	const (
+		COLLECTOR_NAMESPACE = "default"
+		NODE_LABEL          = "sosreport-collector-test"
+		TIMEOUT             = time.Second * 10
+		INTERVAL            = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	Context("When a Sosreport uses the Shared storage mode", func() {
+		It("Should hand off the archives to a collector with a single PVC", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "shared-0",
+					Labels: map[string]string{
+						NODE_LABEL:     "",
+						HOSTNAME_LABEL: "shared-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "shared",
+					Namespace: COLLECTOR_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+					Storage: &supportv1alpha1.SosreportStorage{
+						Mode:        supportv1alpha1.StorageModeShared,
+						LocalVolume: supportv1alpha1.LocalVolumeHostPath,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the sosreport job of the node to run")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"shared-0"}))
+			Expect(s.Status.Nodes[0].PVCName).To(Equal(getSharedPVCName(s)))
+
+			By("Checking the collector's resources")
+			collectorName := types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: getCollectorName(s)}
+			collectorJob := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, collectorName, collectorJob)).Should(Succeed())
+			Expect(collectorJob.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(getSharedPVCName(s)))
+			Expect(k8sClient.Get(ctx, collectorName, &corev1.Service{})).Should(Succeed())
+			Expect(k8sClient.Get(ctx, collectorName, &corev1.Secret{})).Should(Succeed())
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: getSharedPVCName(s)}, pvc)).Should(Succeed())
+			Expect(pvc.Spec.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}))
+
+			By("Checking that the sosreport job writes to a local volume")
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: s.Status.Nodes[0].JobName}, job)).Should(Succeed())
+			Expect(job.Spec.Template.Spec.DNSPolicy).To(Equal(corev1.DNSClusterFirstWithHostNet))
+			var localVolume *corev1.Volume
+			for i, v := range job.Spec.Template.Spec.Volumes {
+				Expect(v.PersistentVolumeClaim).To(BeNil())
+				if v.Name == LOCAL_ARCHIVE_VOLUME {
+					localVolume = &job.Spec.Template.Spec.Volumes[i]
+				}
+			}
+			Expect(localVolume).NotTo(BeNil())
+			Expect(localVolume.HostPath.Path).To(Equal(COLLECTOR_HOST_PATH))
+			env := make(map[string]corev1.EnvVar)
+			for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e
+			}
+			Expect(env["LOCAL_ARCHIVE_DIR"].Value).To(Equal(COLLECTOR_HOST_PATH + "/" + job.Name))
+			Expect(env["COLLECTOR_URL"].Value).To(HaveSuffix("/" + job.Name))
+			Expect(env["COLLECTOR_TOKEN"].ValueFrom.SecretKeyRef.Name).To(Equal(getCollectorName(s)))
+
+			pvcList := &corev1.PersistentVolumeClaimList{}
+			Expect(k8sClient.List(ctx, pvcList, client.InNamespace(COLLECTOR_NAMESPACE),
+				client.MatchingLabels{"sosreport-cr": s.Name})).Should(Succeed())
+			Expect(pvcList.Items).To(HaveLen(1))
+
+			By("Deleting the node so that the Sosreport finishes and the collector stops")
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, collectorName, &batchv1.Job{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+			Expect(k8sClient.Get(ctx, namespacedName, s)).Should(Succeed())
+			Expect(s.Status.IsFinished()).To(BeTrue())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+		})
+
+		It("Should fail the Sosreport if the collector job fails", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "shared-1",
+					Labels: map[string]string{
+						NODE_LABEL + "-failed": "",
+						HOSTNAME_LABEL:         "shared-1",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "shared-failed",
+					Namespace: COLLECTOR_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL + "-failed": "",
+					},
+					Storage: &supportv1alpha1.SosreportStorage{
+						Mode: supportv1alpha1.StorageModeShared,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: s.Name}
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"shared-1"}))
+			jobName := s.Status.Nodes[0].JobName
+
+			By("Failing the collector job")
+			// envtest runs no job controller, so the job's status is set by hand
+			collectorJob := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: getCollectorName(s)},
+				collectorJob)).Should(Succeed())
+			collectorJob.Status.Conditions = []batchv1.JobCondition{{
+				Type:   batchv1.JobFailed,
+				Status: corev1.ConditionTrue,
+				Reason: "BackoffLimitExceeded",
+			}}
+			Expect(k8sClient.Status().Update(ctx, collectorJob)).Should(Succeed())
+
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+			condition := meta.FindStatusCondition(s.Status.Conditions, supportv1alpha1.ConditionCollected)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal("CollectorFailed"))
+			Expect(s.Status.Nodes[0].Outcome).To(Equal(supportv1alpha1.NodeOutcomeFailed))
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: COLLECTOR_NAMESPACE, Name: jobName}, &batchv1.Job{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, collectorJob)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+		})
+	})
+
+	Context("When the PVC capacity of the configuration is invalid", func() {
+		It("Should return a configuration error instead of panicking", func() {
+			r := &SosreportReconciler{}
+			s := &supportv1alpha1.Sosreport{
+				Spec: supportv1alpha1.SosreportSpec{
+					Storage: &supportv1alpha1.SosreportStorage{
+						Mode: supportv1alpha1.StorageModeShared,
+					},
+				},
+			}
+			_, err := r.sharedPVCForSosreport(s, &sosreportConfiguration{pvcCapacity: "ten gigabytes"})
+			Expect(err).To(BeAssignableToTypeOf(&sosreportConfigurationError{}))
+			pvc, err := r.sharedPVCForSosreport(s, &sosreportConfiguration{pvcCapacity: "10Gi"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pvc.Spec.Resources.Requests.Storage().String()).To(Equal("10Gi"))
+		})
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	NODE_ROLE_LABEL_PREFIX = "node-role.kubernetes.io/" // prefix of the labels which assign roles to nodes
+	QUEUED_REQUEUE_PERIOD  = 10 * time.Second           // how often Sosreports with queued nodes look for a free slot
+)
+
+/*
+clusterSlots tracks the sosreport jobs which run across all Sosreports in the cluster
+*/
+type clusterSlots struct {
+	clusterConcurrency  int
+	nodeRoleConcurrency map[string]int
+	nodeRoles           map[string][]string // roles of each node, by its hostname label
+	running             int                 // number of running jobs in the cluster
+	runningPerRole      map[string]int      // number of running jobs per node role
+}
+
+/*
+Count the sosreport jobs which are not done, yet, across all namespaces.
+The jobs are read from the API server directly, so that jobs which were just created are counted, too.
+*/
+func (r *SosreportReconciler) getClusterSlots() (*clusterSlots, error) {
+	slots := &clusterSlots{
+		clusterConcurrency:  r.ClusterConcurrency,
+		nodeRoleConcurrency: r.NodeRoleConcurrency,
+		nodeRoles:           make(map[string][]string),
+		runningPerRole:      make(map[string]int),
+	}
+	// nothing to count if there are no cluster-wide limits
+	if slots.clusterConcurrency <= 0 && len(slots.nodeRoleConcurrency) == 0 {
+		return slots, nil
+	}
+
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList); err != nil {
+		log.Error(err, "unable to list nodes")
+		return nil, err
+	}
+	// jobs and the run queue refer to nodes by their hostname label, which may differ from the node's name
+	for _, node := range nodeList.Items {
+		slots.nodeRoles[getSosreportNodeName(&node)] = getNodeRoles(node)
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.APIReader.List(ctx, jobList, client.MatchingLabels{"app": "sosreport"}); err != nil {
+		log.Error(err, "unable to list sosreport jobs in the cluster")
+		return nil, err
+	}
+	for _, job := range jobList.Items {
+		if done, _ := isJobDone(job); done {
+			continue
+		}
+		slots.take(job.Annotations["nodeName"])
+	}
+	log.V(DEBUG).Info("Cluster-wide sosreport jobs", "running", slots.running, "runningPerRole", slots.runningPerRole)
+	return slots, nil
+}
+
+/*
+Return a message which explains why no sosreport job may be started on nodeName right now,
+or "" if a slot is free
+*/
+func (slots *clusterSlots) isExhausted(nodeName string) string {
+	if slots.clusterConcurrency > 0 && slots.running >= slots.clusterConcurrency {
+		return fmt.Sprintf("Waiting for one of %d cluster-wide sosreport slots", slots.clusterConcurrency)
+	}
+	for _, role := range slots.nodeRoles[nodeName] {
+		if limit, ok := slots.nodeRoleConcurrency[role]; ok && slots.runningPerRole[role] >= limit {
+			return fmt.Sprintf("Waiting for one of %d sosreport slots for nodes with role %s", limit, role)
+		}
+	}
+	return ""
+}
+
+/*
+Account for a sosreport job which runs on nodeName
+*/
+func (slots *clusterSlots) take(nodeName string) {
+	slots.running++
+	for _, role := range slots.nodeRoles[nodeName] {
+		slots.runningPerRole[role]++
+	}
+}
+
+/*
+Get the roles of a node from its node-role.kubernetes.io/<role> labels
+*/
+func getNodeRoles(node corev1.Node) []string {
+	var roles []string
+	for label := range node.Labels {
+		if strings.HasPrefix(label, NODE_ROLE_LABEL_PREFIX) {
+			roles = append(roles, strings.TrimPrefix(label, NODE_ROLE_LABEL_PREFIX))
+		}
+	}
+	return roles
+}
+
+/*
+Parse a list of per node-role limits such as "master=1,worker=3"
+*/
+func ParseNodeRoleConcurrency(value string) (map[string]int, error) {
+	nodeRoleConcurrency := make(map[string]int)
+	if strings.TrimSpace(value) == "" {
+		return nodeRoleConcurrency, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid node role concurrency %q, expected <role>=<limit>", item)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit in node role concurrency %q, expected a positive number", item)
+		}
+		nodeRoleConcurrency[strings.TrimSpace(kv[0])] = limit
+	}
+	return nodeRoleConcurrency, nil
+}
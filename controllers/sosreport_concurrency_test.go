@@ -0,0 +1,148 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Sosreport concurrency limits", func() {
+
+	const (
+		CONCURRENCY_NAMESPACE = "default"
+		NODE_LABEL            = "sosreport-concurrency-test"
+		TIMEOUT               = time.Second * 10
+		INTERVAL              = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	// the hostname label differs from the node's name, as on e.g. AWS
+	newMasterNode := func(name, hostname string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					NODE_LABEL:                        "",
+					HOSTNAME_LABEL:                    hostname,
+					NODE_ROLE_LABEL_PREFIX + "master": "",
+				},
+			},
+		}
+	}
+
+	Context("When nodes are named differently from their hostname label", func() {
+		It("Should apply the node-role limit by the hostname label", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			nodes := []*corev1.Node{
+				newMasterNode("ip-10-0-1-2.ec2.internal", "ip-10-0-1-2"),
+				newMasterNode("ip-10-0-1-3.ec2.internal", "ip-10-0-1-3"),
+			}
+			for _, node := range nodes {
+				Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+			}
+
+			By("Counting a running job against the role of its node")
+			r := &SosreportReconciler{
+				Client:              k8sClient,
+				APIReader:           k8sClient,
+				NodeRoleConcurrency: map[string]int{"master": 1},
+			}
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "concurrency-running",
+					Namespace:   CONCURRENCY_NAMESPACE,
+					Labels:      map[string]string{"app": "sosreport", "sosreport-cr": "concurrency-running"},
+					Annotations: map[string]string{"nodeName": "ip-10-0-1-2"},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers:    []corev1.Container{{Name: "sosreport", Image: "sosreport"}},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, job)).Should(Succeed())
+			Eventually(func() string {
+				slots, err := r.getClusterSlots()
+				if err != nil {
+					return ""
+				}
+				return slots.isExhausted("ip-10-0-1-3")
+			}, TIMEOUT, INTERVAL).Should(ContainSubstring("role master"))
+			Expect(k8sClient.Delete(ctx, job)).Should(Succeed())
+			for _, node := range nodes {
+				Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			}
+		})
+	})
+
+	// the shared suite runs without limits, so they are only exercised here
+	Context("When counting the running sosreport jobs against the limits", func() {
+		newSlots := func(clusterConcurrency int, nodeRoleConcurrency map[string]int) *clusterSlots {
+			return &clusterSlots{
+				clusterConcurrency:  clusterConcurrency,
+				nodeRoleConcurrency: nodeRoleConcurrency,
+				nodeRoles: map[string][]string{
+					"master-0": {"master"},
+					"master-1": {"master"},
+					"worker-0": {"worker"},
+				},
+				runningPerRole: make(map[string]int),
+			}
+		}
+
+		It("Should not limit anything without limits", func() {
+			slots := newSlots(0, nil)
+			slots.take("master-0")
+			slots.take("worker-0")
+			Expect(slots.isExhausted("master-1")).To(BeEmpty())
+		})
+
+		It("Should apply the cluster-wide limit to all nodes", func() {
+			slots := newSlots(2, nil)
+			slots.take("master-0")
+			Expect(slots.isExhausted("worker-0")).To(BeEmpty())
+			slots.take("worker-0")
+			Expect(slots.isExhausted("master-1")).To(ContainSubstring("2 cluster-wide sosreport slots"))
+			Expect(slots.isExhausted("unknown")).To(ContainSubstring("2 cluster-wide sosreport slots"))
+		})
+
+		It("Should apply a node-role limit to the nodes with the role only", func() {
+			slots := newSlots(0, map[string]int{"master": 1})
+			slots.take("master-0")
+			Expect(slots.isExhausted("master-1")).To(ContainSubstring("role master"))
+			Expect(slots.isExhausted("worker-0")).To(BeEmpty())
+			slots.take("worker-0")
+			slots.take("worker-0")
+			Expect(slots.isExhausted("worker-0")).To(BeEmpty())
+		})
+	})
+})
@@ -20,34 +20,42 @@ import (
 	// appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	resourcev1 "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"go.uber.org/zap/zapcore"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
-	//"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	//"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	//"sigs.k8s.io/controller-runtime/pkg/source"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 
 	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+	"github.com/andreaskaris/sosreport-operator/pkg/sosreportpvc"
 )
 
 const (
@@ -63,36 +71,86 @@ const (
 	IS_DEVELOPER_MODE             = true // potentially unsafe settings that can easily be disabled
 	DEBUG                         = 1
 	INFO                          = 0
+	JOB_NAME_TIMESTAMP_LAYOUT     = "20060102150405" // timestamp in the names of sosreport jobs
 )
 
+// plugin options which are passed to sos report unless the Sosreport overrides them
+var DEFAULT_PLUGIN_OPTIONS = map[string]string{
+	"crio.all":  "on",
+	"crio.logs": "on",
+}
+
+// Older versions of this operator kept their run queues in these annotations. They are migrated into the status.
+const (
+	JOB_TO_RUN_LIST_ANNOTATION  = "job-to-run-list"
+	JOB_RUNNING_LIST_ANNOTATION = "job-running-list"
+)
+
+// SosreportLogLevel holds the minimum level of messages which are logged. It can be changed at runtime.
 type SosreportLogLevel struct {
 	MinLevel zapcore.Level
+	mutex    sync.RWMutex
+}
+
+// SetMinLevel changes the minimum level of messages which are logged
+func (l *SosreportLogLevel) SetMinLevel(level zapcore.Level) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.MinLevel = level
+}
+
+// Enabled returns true if messages at level lvl shall be logged
+func (l *SosreportLogLevel) Enabled(lvl zapcore.Level) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return lvl >= l.MinLevel
 }
 
 // SosreportReconciler reconciles a Sosreport object
+// It does not keep any state between reconcile loops: the state of each Sosreport is derived from its
+// status and from the Jobs that it owns. Hence, it is safe to run with MaxConcurrentReconciles > 1.
 type SosreportReconciler struct {
 	client.Client
 	Log             logr.Logger
 	DynamicLogLevel *SosreportLogLevel
 	Scheme          *runtime.Scheme
-	recorder        record.EventRecorder
-	// the runList takes care of race conditions due to caching delay
-	// a sosreport on the runList will not be run again
-	runList map[types.UID]struct{}
-	// list of jobs to run
-	jobToRunList map[types.UID]map[string]struct{} // will be jobToRunList[s.UID][nodeName]
-	// list of jobs to currently running
-	jobRunningList       map[types.UID]map[string]struct{} // will be jobToRunList[s.UID][nodeName]
-	imageName            string                            // name of the soreport job's image
-	sosreportCommand     string                            // command to run for the sosreport image
-	sosreportConcurrency int                               // command to run for the sosreport image
+	// MaxConcurrentReconciles is the number of Sosreports which can be reconciled at the same time
+	MaxConcurrentReconciles int
+	// ClusterConcurrency is the number of sosreport jobs which may run at the same time across all Sosreports
+	// in the cluster. 0 means no limit.
+	ClusterConcurrency int
+	// NodeRoleConcurrency limits the number of sosreport jobs which may run at the same time on nodes of a role
+	// across all Sosreports in the cluster, e.g. {"master": 1}
+	NodeRoleConcurrency map[string]int
+	// ArtifactServerURL is the external URL of the artifact server. The URLs of the archives are recorded in the
+	// status of the Sosreports if it is set.
+	ArtifactServerURL string
+	// APIReader reads directly from the API server. The cluster-wide limits are enforced with it, as the cache may
+	// not contain jobs which were just created. Pods are read with it, so that the cache holds no pods.
+	APIReader client.Reader
+	recorder  record.EventRecorder
+	// slotMutex serializes the creation of sosreport jobs when cluster-wide limits are enforced
+	slotMutex sync.Mutex
+}
+
+// sosreportConfiguration holds the settings which sosreport jobs are created with.
+// It is resolved from the configuration ConfigMaps at the beginning of each reconcile loop.
+type sosreportConfiguration struct {
+	imageName            string // name of the soreport job's image
+	sosreportCommand     string // command to run for the sosreport image
+	sosreportConcurrency int    // number of sosreport jobs which run at the same time
 	pvcStorageClass      string
 	pvcCapacity          string
 	imagePullPolicy      string
+	environment          map[string]string // non-secret environment variables of the sosreport jobs
+	uploadSecret         string            // name of the Secret with the upload credentials
+	debug                bool              // log level of the operator
+	sources              []string          // where the configuration was read from
 }
 
-var log logr.Logger
-var ctx context.Context
+// log and ctx are set once and shared by all reconcile loops
+var log logr.Logger = ctrllog.Log
+var ctx = context.Background()
 
 // +kubebuilder:rbac:groups=support.openshift.io,resources=sosreports,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=support.openshift.io,resources=sosreports/status,verbs=get;update;patch
@@ -109,13 +167,13 @@ var ctx context.Context
 // +kubebuilder:rbac:groups="",resources=secrets/status,verbs=get
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events/status,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=nodes/status,verbs=get
 // +kubebuilder:rbac:groups="security.openshift.io",resources=securitycontextconstraints,resourceNames=privileged,verbs=use
 
 func (r *SosreportReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx = context.Background()
-	log = r.Log.WithValues("sosreport", req.NamespacedName)
+	log := r.Log.WithValues("sosreport", req.NamespacedName)
 
 	log.V(DEBUG).Info("Reconciler loop triggered")
 
@@ -130,111 +188,247 @@ func (r *SosreportReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	/*
 	 A sosreport will not be run if:
-	 a) It is marked as Finished in the type
-	 b) It is marked as InProgress in the type
-	 c) It is on the runList (the runList avoids issues with caching delay)
+	 a) It is in one of the terminal phases
+	 b) It is past the Pending phase
+	 All other state is derived from the sosreport's status and from the jobs that it owns.
 	*/
 
+	// a Sosreport which is being deleted only waits for its uploads or exports, see sosreport_finalizer.go
+	if !sosreport.DeletionTimestamp.IsZero() {
+		return r.finalizeSosreport(sosreport, req)
+	}
+	if err := r.ensureSosreportFinalizer(sosreport, req); err != nil {
+		return requeueOnConflict(err)
+	}
+
+	// failed uploads are retried on request, even if the Sosreport is finished, see sosreport_upload.go
+	if _, ok := sosreport.Annotations[supportv1alpha1.RetryUploadsAnnotation]; ok {
+		if err := r.retrySosreportUploads(sosreport, req); err != nil {
+			log.Error(err, "unable to retry uploads")
+			return requeueOnConflict(err)
+		}
+	}
+
+	// Sosreports which were created by older versions of this operator have no phase, but may be finished
+	if err := r.migrateLegacyStatus(sosreport, req); err != nil {
+		log.Error(err, "Failed to migrate the legacy status")
+		return requeueOnConflict(err)
+	}
+
 	// don't look at finished sosreports, ever
-	if sosreport.Status.Finished == true {
+	if sosreport.Status.IsFinished() {
 		return ctrl.Result{}, nil
 	}
 
-	// initialize maps to avoid assignment to entry in nil map
-	r.init()
-	// before we run this, read some configuration from configmap
-	r.setGlobalSosreportReconcilerConfiguration(sosreport, req)
-	if IS_DEVELOPER_MODE {
-		r.setDevelopmentSosreportReconcilerConfiguration(sosreport, req)
+	// before we run this, read some configuration from SosreportConfigs or configmaps
+	conf, err := r.getSosreportConfiguration(sosreport, req)
+	if configErr, ok := err.(*sosreportConfigurationError); ok {
+		// a Sosreport with an invalid configuration can never be scheduled
+		log.V(INFO).Info("Invalid configuration", "err", configErr)
+		sosreport.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionConfigurationValid, metav1.ConditionFalse,
+			configErr.reason, configErr.message)
+		return requeueOnConflict(r.updateStatus(sosreport, req))
+	} else if err != nil {
+		log.Error(err, "unable to resolve the configuration")
+		return ctrl.Result{}, err
 	}
 
-	// a sosreport is not yet running if its not on the runList
-	// and if its status.inProgress is false
-	_, inRunlist := r.runList[sosreport.UID]
-	if !inRunlist && sosreport.Status.InProgress == false {
+	// Sosreports which were created by older versions of this operator keep their queues in annotations
+	if err := r.migrateRunListAnnotations(sosreport, req); err != nil {
+		log.Error(err, "Failed to migrate run list annotations")
+		return ctrl.Result{}, err
+	}
+
+	// a sosreport is not yet running if it is still in phase Pending
+	if isSosreportPending(sosreport) && sosreport.Spec.Cancel {
+		log.V(INFO).Info("Sosreport was cancelled before its nodes were selected")
+		sosreport.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionNodesSelected, metav1.ConditionFalse,
+			"Cancelled", "The Sosreport was cancelled")
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse,
+			"Cancelled", "No sosreport jobs were started")
+		return requeueOnConflict(r.updateStatus(sosreport, req))
+	}
+	if isSosreportPending(sosreport) {
 		log.V(INFO).Info("Starting sosreport jobs")
-		var err error
-		r.runList[sosreport.UID] = struct{}{}
 
 		// only schedule sosreports here
-		sosreport.Status.InProgress, err = r.scheduleSosreportJobs(sosreport, req)
+		scheduled, err := r.scheduleSosreportJobs(sosreport, req)
 		if err != nil {
 			log.Error(err, "unable to schedule sosreport jobs")
 			return ctrl.Result{}, err
 		}
-		log.V(DEBUG).Info("Updating sosreport status", "sosreport.Status.InProgress", sosreport.Status.InProgress)
-		r.updateStatus(sosreport, req)
-	} else {
-		// synchronize job running cache - in case this sosreport controller was restarted
-		err := r.synchronizeJobRunningCache(sosreport, req)
-		if err != nil {
-			log.Error(err, "Failed to synchronize job running cache")
+		if scheduled {
+			sosreport.Status.Phase = supportv1alpha1.SosreportPhaseScheduling
+			sosreport.Status.EffectiveConfiguration = conf.toEffectiveConfiguration()
+			if r.ArtifactServerURL != "" {
+				sosreport.Status.ArtifactsURL = getArtifactsURL(r.ArtifactServerURL, sosreport)
+			}
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionNodesSelected, metav1.ConditionTrue,
+				"NodesSelected", fmt.Sprintf("Selected %d node(s)", len(sosreport.Status.Nodes)))
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionTrue,
+				"JobsQueued", "Waiting for sosreport jobs to be started")
+		} else {
+			sosreport.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionNodesSelected, metav1.ConditionFalse,
+				"NoEligibleNodes", "No node matches the Sosreport's node selection and Tolerations")
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse,
+				"NoEligibleNodes", "No sosreport jobs were started")
 		}
-		// dequeue any jobs that are in running list and are done
-		err = r.dequeueSosreportJobsDone(sosreport, req)
-		if err != nil {
-			log.Error(err, "Failed to determine sosreport done state")
+		r.synchronizeRunningStatus(sosreport, req)
+		log.V(DEBUG).Info("Updating sosreport status", "sosreport.Status.Phase", sosreport.Status.Phase)
+		return requeueOnConflict(r.updateStatus(sosreport, req))
+	}
+
+	// Sosreports which were scheduled by older versions of this operator have no effective configuration, yet
+	if sosreport.Status.EffectiveConfiguration == nil {
+		sosreport.Status.EffectiveConfiguration = conf.toEffectiveConfiguration()
+	}
+	sosreport.Status.EffectiveConfiguration.Concurrency = conf.sosreportConcurrency
+
+	// the jobs which belong to this sosreport are the source of truth for running and done nodes
+	sosreportJobs, err := r.getSosreportJobs(sosreport, req)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// move nodes whose jobs are done out of the running queue
+	r.synchronizeNodeStatesWithJobs(sosreport, sosreportJobs, req)
+	// give up on nodes which were deleted or are NotReady for too long
+	notReadyDelay, err := r.synchronizeNodeStatesWithNodes(sosreport)
+	if err != nil {
+		log.Error(err, "unable to synchronize node states with nodes")
+		return ctrl.Result{}, err
+	}
+	// give nodes whose archives were collected an upload and record the results of finished upload jobs
+	if err := r.synchronizeSosreportUploads(sosreport); err != nil {
+		log.Error(err, "unable to synchronize uploads with upload jobs")
+		return ctrl.Result{}, err
+	}
+	// stop all jobs of a cancelled sosreport
+	if sosreport.Spec.Cancel {
+		if err := r.cancelSosreportJobs(sosreport); err != nil {
+			log.Error(err, "unable to cancel sosreport jobs")
+			return ctrl.Result{}, err
 		}
-		// run sosreport jobs from the jobToRunList and move them to running list
-		_, err = r.runSosreportJobs(sosreport, req)
-		if err != nil {
-			log.Error(err, "unable to run sosreport jobs")
+		if err := r.cancelSosreportUploads(sosreport); err != nil {
+			log.Error(err, "unable to cancel uploads")
 			return ctrl.Result{}, err
 		}
+	}
+	// a Sosreport cannot finish without its collector, see sosreport_collector.go
+	if failed, err := r.isSosreportCollectorFailed(sosreport); err != nil {
+		log.Error(err, "unable to get the collector job")
+		return ctrl.Result{}, err
+	} else if failed {
+		log.V(INFO).Info("Sosreport collector failed")
+		if err := r.failSosreportCollector(sosreport, req); err != nil {
+			log.Error(err, "unable to fail the sosreport jobs")
+			return ctrl.Result{}, err
+		}
+		return requeueOnConflict(r.updateStatus(sosreport, req))
+	}
+	// start sosreport jobs for outstanding nodes and move them into the running queue
+	err = r.runSosreportJobs(sosreport, conf, req)
+	if configErr, ok := err.(*sosreportConfigurationError); ok {
+		log.V(INFO).Info("Invalid configuration", "err", configErr)
+		sosreport.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionConfigurationValid, metav1.ConditionFalse,
+			configErr.reason, configErr.message)
+		return requeueOnConflict(r.updateStatus(sosreport, req))
+	} else if err != nil {
+		log.Error(err, "unable to run sosreport jobs")
+		return ctrl.Result{}, err
+	}
+	// start upload jobs for the archives which were collected
+	if err := r.runSosreportUploads(sosreport, conf, req); err != nil {
+		log.Error(err, "unable to run upload jobs")
+		return ctrl.Result{}, err
+	}
 
-		// copy the annotation for running-list and to-run-list into the Status field
-		r.synchronizeRunningStatus(sosreport, req)
+	// derive the running and outstanding node lists from the per-node records
+	r.synchronizeRunningStatus(sosreport, req)
 
-		if r.isSosreportJobsDone(sosreport) {
-			log.V(INFO).Info("Sosreport generation done")
-			sosreport.Status.InProgress = false
-			sosreport.Status.Finished = true
+	if r.isSosreportJobsDone(sosreport) {
+		log.V(INFO).Info("Sosreport generation done")
+		if err := r.stopSosreportCollector(sosreport); err != nil {
+			log.Error(err, "unable to stop the sosreport collector")
+			return ctrl.Result{}, err
 		}
-
-		r.updateStatus(sosreport, req)
+		if isSosreportUploadsDone(sosreport) {
+			r.recorder.Event(sosreport, corev1.EventTypeNormal, "Sosreports finished", "All Sosreports finished")
+			r.setSosreportFinishedStatus(sosreport, req)
+		} else {
+			// the Sosreport finishes once the upload jobs are done, too
+			sosreport.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse,
+				"JobsFinished", "All sosreport jobs finished")
+			setSosreportCondition(sosreport, supportv1alpha1.ConditionUploaded, metav1.ConditionUnknown,
+				"UploadsRunning", summarizeSosreportUploads(sosreport))
+		}
+	} else if len(sosreport.Status.CurrentlyRunningNodes) > 0 {
+		sosreport.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionTrue,
+			"JobsRunning", fmt.Sprintf("%d node(s) running, %d node(s) outstanding, %d node(s) queued",
+				len(sosreport.Status.CurrentlyRunningNodes), len(sosreport.Status.OutstandingNodes),
+				len(sosreport.Status.QueuedNodes)))
+	} else if len(sosreport.Status.QueuedNodes) > 0 {
+		setSosreportCondition(sosreport, supportv1alpha1.ConditionJobsRunning, metav1.ConditionTrue,
+			"JobsQueued", fmt.Sprintf("%d node(s) wait for a cluster-wide sosreport slot",
+				len(sosreport.Status.QueuedNodes)))
 	}
 
-	return ctrl.Result{}, nil
+	result, err := requeueOnConflict(r.updateStatus(sosreport, req))
+	if err != nil || result.Requeue || sosreport.Status.IsFinished() {
+		return result, err
+	}
+	// slots are freed by the jobs of other Sosreports, which do not trigger this Sosreport's reconcile loop
+	if len(sosreport.Status.QueuedNodes) > 0 {
+		result.RequeueAfter = QUEUED_REQUEUE_PERIOD
+	}
+	// nothing triggers the reconcile loop once the backoff of a failed node passed
+	if delay := getNextRetryDelay(sosreport); delay > 0 && (result.RequeueAfter == 0 || delay < result.RequeueAfter) {
+		result.RequeueAfter = delay
+	}
+	// nothing triggers the reconcile loop once the grace period of a NotReady node passed
+	if notReadyDelay > 0 && (result.RequeueAfter == 0 || notReadyDelay < result.RequeueAfter) {
+		result.RequeueAfter = notReadyDelay
+	}
+	// a Pending pod does not update its job, so look for stuck jobs periodically
+	if len(sosreport.Status.CurrentlyRunningNodes) > 0 {
+		delay := getPendingTimeout(sosreport)
+		if delay > PENDING_CHECK_PERIOD {
+			delay = PENDING_CHECK_PERIOD
+		}
+		if result.RequeueAfter == 0 || delay < result.RequeueAfter {
+			result.RequeueAfter = delay
+		}
+	}
+	return result, err
 }
 
+/*
+Derive the lists of running, outstanding and queued nodes from the per-node records in the Status field
+*/
 func (r *SosreportReconciler) synchronizeRunningStatus(s *supportv1alpha1.Sosreport, req ctrl.Request) {
 	var jobRunningList []string
 	var jobToRunList []string
-
-	if annotationJson, ok := s.Annotations["job-running-list"]; ok {
-		annotationData := make(map[string]struct{})
-		if err := json.Unmarshal([]byte(annotationJson), &annotationData); err == nil {
-			for k, _ := range annotationData {
-				jobRunningList = append(jobRunningList, k)
-			}
-		}
-	}
-	if annotationJson, ok := s.Annotations["job-to-run-list"]; ok {
-		annotationData := make(map[string]struct{})
-		if err := json.Unmarshal([]byte(annotationJson), &annotationData); err == nil {
-			for k, _ := range annotationData {
-				jobToRunList = append(jobToRunList, k)
-			}
+	var jobQueuedList []string
+
+	for _, nodeStatus := range s.Status.Nodes {
+		switch nodeStatus.State {
+		case supportv1alpha1.NodeStateRunning:
+			jobRunningList = append(jobRunningList, nodeStatus.NodeName)
+		case supportv1alpha1.NodeStateOutstanding:
+			jobToRunList = append(jobToRunList, nodeStatus.NodeName)
+		case supportv1alpha1.NodeStateQueued:
+			jobQueuedList = append(jobQueuedList, nodeStatus.NodeName)
 		}
 	}
 
 	s.Status.CurrentlyRunningNodes = jobRunningList
 	s.Status.OutstandingNodes = jobToRunList
-}
-
-/*
-Initialize maps to avoid assignment to entry in nil map
-*/
-func (r *SosreportReconciler) init() {
-	if r.runList == nil {
-		r.runList = make(map[types.UID]struct{})
-	}
-	if r.jobToRunList == nil {
-		r.jobToRunList = make(map[types.UID]map[string]struct{})
-	}
-	if r.jobRunningList == nil {
-		r.jobRunningList = make(map[types.UID]map[string]struct{})
-	}
+	s.Status.QueuedNodes = jobQueuedList
 }
 
 /*
@@ -244,18 +438,154 @@ Record events for CRD "Sosreport"
 func (r *SosreportReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// record events for Sosreport CRD
 	r.recorder = mgr.GetEventRecorderFor("Sosreport")
+	log = r.Log
+	// avoid nil pointer reference if this is not passed from the outside
+	if r.DynamicLogLevel == nil {
+		r.DynamicLogLevel = &SosreportLogLevel{}
+	}
+	if r.MaxConcurrentReconciles < 1 {
+		r.MaxConcurrentReconciles = 1
+	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	// Owns(&corev1.PersistentVolumeClaim{}).
+	bldr := ctrl.NewControllerManagedBy(mgr).
 		For(&supportv1alpha1.Sosreport{}).
-		Owns(&batchv1.Job{}).
-		// Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&batchv1.Job{})
+	// configuration changes apply to Sosreports which are in progress, e.g. a raised concurrency. Only the
+	// ConfigMaps and the Secret with the operator's names are watched, instead of all ConfigMaps and Secrets.
+	for _, name := range CONFIGURATION_CONFIG_MAP_NAMES {
+		informer, err := newNamedInformer(mgr, clientset, "configmaps", name, &corev1.ConfigMap{})
+		if err != nil {
+			return err
+		}
+		bldr = bldr.Watches(&source.Informer{Informer: informer},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapConfigMapToSosreports)})
+	}
+	informer, err := newNamedInformer(mgr, clientset, "secrets", UPLOAD_SECRET_NAME, &corev1.Secret{})
+	if err != nil {
+		return err
+	}
+	return bldr.
+		Watches(&source.Informer{Informer: informer},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapSecretToSosreports)}).
+		Watches(&source.Kind{Type: &supportv1alpha1.SosreportConfig{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapSosreportConfigToSosreports)}).
+		// nodes which are deleted or become NotReady never finish their sosreport jobs
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapNodeToSosreports)},
+			builder.WithPredicates(nodeLostPredicate)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
+/*
+Resolve the configuration of this reconcile loop from the SosreportConfigs or, if none applies to the Sosreport,
+from the configuration ConfigMaps. A Sosreport which was already scheduled keeps the configuration that it was
+scheduled with, except for the concurrency, which always follows the current configuration.
+Returns a *sosreportConfigurationError if the configuration which applies to the Sosreport is invalid.
+*/
+func (r *SosreportReconciler) getSosreportConfiguration(s *supportv1alpha1.Sosreport, req ctrl.Request) (*sosreportConfiguration, error) {
+	conf := &sosreportConfiguration{
+		imageName:            DEFAULT_IMAGE_NAME,
+		sosreportCommand:     DEFAULT_SOSREPORT_COMMAND,
+		imagePullPolicy:      DEFAULT_IMAGE_PULL_POLICY,
+		sosreportConcurrency: DEFAULT_SOSREPORT_CONCURRENCY,
+		pvcCapacity:          DEFAULT_PVC_SIZE,
+		uploadSecret:         UPLOAD_SECRET_NAME,
+	}
+
+	sosreportConfigs, err := r.getSosreportConfigs(s)
+	if err == nil && len(sosreportConfigs) > 0 {
+		for _, sosreportConfig := range sosreportConfigs {
+			applySosreportConfig(conf, sosreportConfig)
+		}
+	} else if err == nil {
+		r.setGlobalSosreportReconcilerConfiguration(s, req, conf)
+		if IS_DEVELOPER_MODE {
+			r.setDevelopmentSosreportReconcilerConfiguration(s, req, conf)
+		}
+		conf.environment = r.getEnvConfigurationFromConfigMaps(s, req)
+		conf.sources = []string{"ConfigMaps"}
+	}
+	if err == nil {
+		r.setLogLevel(conf.debug)
+	}
+
+	// a Sosreport keeps the configuration that it was scheduled with
+	if s.Status.EffectiveConfiguration != nil {
+		if err != nil {
+			log.V(INFO).Info("Ignoring configuration error of a scheduled Sosreport", "err", err)
+		}
+		log.V(DEBUG).Info("Using the effective configuration from the Sosreport's status")
+		scheduledConf := sosreportConfigurationFromStatus(s.Status.EffectiveConfiguration)
+		if err == nil {
+			scheduledConf.sosreportConcurrency = conf.sosreportConcurrency
+		}
+		return scheduledConf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+/*
+Change the log level of the operator
+*/
+func (r *SosreportReconciler) setLogLevel(sosreportDebug bool) {
+	log.V(DEBUG).Info("Setting loglevel to", "sosreportDebug", sosreportDebug)
+	if sosreportDebug {
+		r.DynamicLogLevel.SetMinLevel(zapcore.DebugLevel)
+	} else {
+		r.DynamicLogLevel.SetMinLevel(zapcore.InfoLevel)
+	}
+}
+
+/*
+Convert the configuration into its representation in the Sosreport's status
+*/
+func (conf *sosreportConfiguration) toEffectiveConfiguration() *supportv1alpha1.SosreportEffectiveConfiguration {
+	return &supportv1alpha1.SosreportEffectiveConfiguration{
+		Image:           conf.imageName,
+		Command:         conf.sosreportCommand,
+		ImagePullPolicy: conf.imagePullPolicy,
+		Concurrency:     conf.sosreportConcurrency,
+		PVCStorageClass: conf.pvcStorageClass,
+		PVCCapacity:     conf.pvcCapacity,
+		UploadSecret:    conf.uploadSecret,
+		Sources:         conf.sources,
+		Environment:     conf.environment,
+	}
+}
+
+/*
+Restore the configuration from its representation in the Sosreport's status
+*/
+func sosreportConfigurationFromStatus(ec *supportv1alpha1.SosreportEffectiveConfiguration) *sosreportConfiguration {
+	return &sosreportConfiguration{
+		imageName:            ec.Image,
+		sosreportCommand:     ec.Command,
+		imagePullPolicy:      ec.ImagePullPolicy,
+		sosreportConcurrency: ec.Concurrency,
+		pvcStorageClass:      ec.PVCStorageClass,
+		pvcCapacity:          ec.PVCCapacity,
+		uploadSecret:         ec.UploadSecret,
+		sources:              ec.Sources,
+		environment:          ec.Environment,
+	}
+}
+
 /*
 This method reads custom configuration from a configmap that allows admins to overwrite PVC settings, log-level and concurrency
 */
-func (r *SosreportReconciler) setGlobalSosreportReconcilerConfiguration(s *supportv1alpha1.Sosreport, req ctrl.Request) {
+func (r *SosreportReconciler) setGlobalSosreportReconcilerConfiguration(s *supportv1alpha1.Sosreport, req ctrl.Request, conf *sosreportConfiguration) {
 	sosreportConcurrency := DEFAULT_SOSREPORT_CONCURRENCY
 	sosreportDebug := false
 	pvcStorageClass := ""
@@ -292,35 +622,26 @@ func (r *SosreportReconciler) setGlobalSosreportReconcilerConfiguration(s *suppo
 		}
 	}
 
-	log.V(DEBUG).Info("Setting loglevel to", "sosreportDebug", sosreportDebug)
-	// avoid nil pointer reference if this is not passed from the outside
-	if r.DynamicLogLevel == nil {
-		r.DynamicLogLevel = &SosreportLogLevel{}
-	}
-	if sosreportDebug {
-		r.DynamicLogLevel.MinLevel = zapcore.DebugLevel
-	} else {
-		r.DynamicLogLevel.MinLevel = zapcore.InfoLevel
-	}
+	conf.debug = sosreportDebug
 
 	log.V(DEBUG).Info("Using concurrency", "concurrency", sosreportConcurrency)
-	r.sosreportConcurrency = sosreportConcurrency
+	conf.sosreportConcurrency = sosreportConcurrency
 
 	log.V(DEBUG).Info("PVC storage class", "pvcStorageClass", pvcStorageClass)
-	r.pvcStorageClass = pvcStorageClass
+	conf.pvcStorageClass = pvcStorageClass
 
 	log.V(DEBUG).Info("PVC capacity", "pvcCapacity", pvcCapacity)
-	r.pvcCapacity = pvcCapacity
+	conf.pvcCapacity = pvcCapacity
 }
 
 /*
 This method reads custom configuration from a configmap that allows admins to overwrite the sosreport generation
 image as well as the sosreport command and image pull policy (developer settings)
 */
-func (r *SosreportReconciler) setDevelopmentSosreportReconcilerConfiguration(s *supportv1alpha1.Sosreport, req ctrl.Request) {
-	sosreportImage := DEFAULT_IMAGE_NAME
-	sosreportCommand := DEFAULT_SOSREPORT_COMMAND
-	imagePullPolicy := DEFAULT_IMAGE_PULL_POLICY
+func (r *SosreportReconciler) setDevelopmentSosreportReconcilerConfiguration(s *supportv1alpha1.Sosreport, req ctrl.Request, conf *sosreportConfiguration) {
+	sosreportImage := conf.imageName
+	sosreportCommand := conf.sosreportCommand
+	imagePullPolicy := conf.imagePullPolicy
 
 	cm, err := r.getSosreportConfigMap(DEVELOPMENT_CONFIG_MAP_NAME, s, req)
 	if err == nil {
@@ -342,33 +663,43 @@ func (r *SosreportReconciler) setDevelopmentSosreportReconcilerConfiguration(s *
 		}
 	}
 	log.V(DEBUG).Info("Using sosreport-image", "sosreport-image", sosreportImage)
-	r.imageName = sosreportImage
+	conf.imageName = sosreportImage
 	log.V(DEBUG).Info("Using sosreport-command", "sosreport-command", sosreportCommand)
-	r.sosreportCommand = sosreportCommand
+	conf.sosreportCommand = sosreportCommand
 	log.V(DEBUG).Info("ImagePullPolicy", "imagePullPolicy", imagePullPolicy)
-	r.imagePullPolicy = imagePullPolicy
+	conf.imagePullPolicy = imagePullPolicy
 }
 
 /*
-This method reads custom configuration from a configmap and secret and populates a map containing configuration items
+This method merges the ConfigMaps into a map of environment variables for the sosreport jobs
 */
-func (r *SosreportReconciler) getEnvConfigurationFromConfigMapAndSecret(s *supportv1alpha1.Sosreport, req ctrl.Request) map[string]string {
+func (r *SosreportReconciler) getEnvConfigurationFromConfigMaps(s *supportv1alpha1.Sosreport, req ctrl.Request) map[string]string {
 	keyMapUploadCm := map[string]string{
-		"upload-method": "UPLOAD_METHOD",
-		"case-number":   "CASE_NUMBER",
-		"obfuscate":     "OBFUSCATE",
-		"nfs-share":     "NFS_SHARE",
-		"nfs-options":   "NFS_OPTIONS",
-		"ftp-server":    "FTP_SERVER",
+		"upload-method":        "UPLOAD_METHOD",
+		"case-number":          "CASE_NUMBER",
+		"obfuscate":            "OBFUSCATE",
+		"nfs-share":            "NFS_SHARE",
+		"nfs-options":          "NFS_OPTIONS",
+		"ftp-server":           "FTP_SERVER",
+		"s3-bucket":            "S3_BUCKET",
+		"s3-prefix":            "S3_PREFIX",
+		"s3-region":            "S3_REGION",
+		"s3-endpoint":          "S3_ENDPOINT",
+		"s3-part-size":         "S3_PART_SIZE",
+		"sftp-server":          "SFTP_SERVER",
+		"sftp-known-hosts":     "SFTP_KNOWN_HOSTS",
+		"sftp-path":            "SFTP_PATH",
+		"http-url":             "HTTP_URL",
+		"http-method":          "HTTP_METHOD",
+		"http-form-field":      "HTTP_FORM_FIELD",
+		"http-headers":         "HTTP_HEADERS",
+		"http-ca-bundle":       "HTTP_CA_BUNDLE",
+		"http-expected-status": "HTTP_EXPECTED_STATUS",
 	}
 	keyMapDevelopmentCm := map[string]string{
 		"simulation-mode": "SIMULATION_MODE",
 		"debug":           "DEBUG",
 	}
-	keyMapSecret := map[string]string{
-		"username": "USERNAME",
-		"password": "PASSWORD",
-	}
 
 	configurationMap := make(map[string]string)
 
@@ -393,7 +724,29 @@ func (r *SosreportReconciler) getEnvConfigurationFromConfigMapAndSecret(s *suppo
 			}
 		}
 	}
-	secret, err := r.getSosreportSecret(s, req)
+	return configurationMap
+}
+
+/*
+This method reads the upload credentials from the Secret into a map of environment variables for the sosreport jobs.
+Credentials are never part of the effective configuration, so they are read whenever a job is created.
+*/
+func (r *SosreportReconciler) getEnvConfigurationFromSecret(secretName string, s *supportv1alpha1.Sosreport, req ctrl.Request) map[string]string {
+	keyMapSecret := map[string]string{
+		"username":          "USERNAME",
+		"password":          "PASSWORD",
+		"access-key-id":     "AWS_ACCESS_KEY_ID",
+		"secret-access-key": "AWS_SECRET_ACCESS_KEY",
+		"session-token":     "AWS_SESSION_TOKEN",
+		"ssh-private-key":   "SSH_PRIVATE_KEY",
+		"bearer-token":      "HTTP_BEARER_TOKEN",
+		"tls.crt":           "HTTP_CLIENT_CERT",
+		"tls.key":           "HTTP_CLIENT_KEY",
+	}
+
+	configurationMap := make(map[string]string)
+
+	secret, err := r.getSosreportSecret(secretName, s, req)
 	if err == nil {
 		for k, v := range secret.Data {
 			// username and password shall be provided by secret
@@ -406,6 +759,74 @@ func (r *SosreportReconciler) getEnvConfigurationFromConfigMapAndSecret(s *suppo
 	return configurationMap
 }
 
+/*
+Translate the sos report options from the Sosreport's spec into environment variables for the entrypoint
+*/
+func getEnvConfigurationFromSpec(s *supportv1alpha1.Sosreport) map[string]string {
+	configurationMap := make(map[string]string)
+
+	if len(s.Spec.OnlyPlugins) > 0 {
+		configurationMap["SOS_ONLY_PLUGINS"] = strings.Join(s.Spec.OnlyPlugins, ",")
+	}
+	if len(s.Spec.SkipPlugins) > 0 {
+		configurationMap["SOS_SKIP_PLUGINS"] = strings.Join(s.Spec.SkipPlugins, ",")
+	}
+	if len(s.Spec.EnablePlugins) > 0 {
+		configurationMap["SOS_ENABLE_PLUGINS"] = strings.Join(s.Spec.EnablePlugins, ",")
+	}
+	if len(s.Spec.Profiles) > 0 {
+		configurationMap["SOS_PROFILES"] = strings.Join(s.Spec.Profiles, ",")
+	}
+	if s.Spec.LogSize != nil {
+		configurationMap["SOS_LOG_SIZE"] = strconv.Itoa(int(*s.Spec.LogSize))
+	}
+	if s.Spec.AllLogs {
+		configurationMap["SOS_ALL_LOGS"] = "true"
+	}
+	if s.Spec.Since != "" {
+		configurationMap["SOS_SINCE"] = s.Spec.Since
+	}
+
+	// the default plugin options only apply to plugins which are not excluded
+	pluginOptions := make(map[string]string)
+	for k, v := range DEFAULT_PLUGIN_OPTIONS {
+		if isSosPluginSelected(s, strings.Split(k, ".")[0]) {
+			pluginOptions[k] = v
+		}
+	}
+	for k, v := range s.Spec.PluginOptions {
+		pluginOptions[k] = v
+	}
+	var pluginOptionList []string
+	for k, v := range pluginOptions {
+		pluginOptionList = append(pluginOptionList, k+"="+v)
+	}
+	sort.Strings(pluginOptionList)
+	configurationMap["SOS_PLUGIN_OPTIONS"] = strings.Join(pluginOptionList, ",")
+
+	return configurationMap
+}
+
+/*
+Determine if a plugin is neither skipped nor excluded via onlyPlugins
+*/
+func isSosPluginSelected(s *supportv1alpha1.Sosreport, plugin string) bool {
+	for _, p := range s.Spec.SkipPlugins {
+		if p == plugin {
+			return false
+		}
+	}
+	if len(s.Spec.OnlyPlugins) == 0 {
+		return true
+	}
+	for _, p := range s.Spec.OnlyPlugins {
+		if p == plugin {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 This method retrieves the config map which is used for configuration overrides
 */
@@ -413,7 +834,8 @@ func (r *SosreportReconciler) getSosreportConfigMap(configMapName string, s *sup
 	cm := &corev1.ConfigMap{}
 	nn := types.NamespacedName{Name: configMapName, Namespace: req.Namespace}
 	log.V(DEBUG).Info("Retrieving ConfigMap", "NamespacedName", nn)
-	if err := r.Get(ctx, nn, cm); err != nil {
+	// read past the cache, which only holds the Sosreports and the operator's jobs
+	if err := r.APIReader.Get(ctx, nn, cm); err != nil {
 		// all of the ConfigMaps are optional, so this should not be logged for INFO
 		log.V(DEBUG).Info("unable to get configuration configmap", "err", err)
 		return nil, err
@@ -424,11 +846,12 @@ func (r *SosreportReconciler) getSosreportConfigMap(configMapName string, s *sup
 /*
 This method retrieves the secret which is used for sosreport attachment authentication
 */
-func (r *SosreportReconciler) getSosreportSecret(s *supportv1alpha1.Sosreport, req ctrl.Request) (*corev1.Secret, error) {
+func (r *SosreportReconciler) getSosreportSecret(secretName string, s *supportv1alpha1.Sosreport, req ctrl.Request) (*corev1.Secret, error) {
 	secret := &corev1.Secret{}
-	nn := types.NamespacedName{Name: UPLOAD_SECRET_NAME, Namespace: req.Namespace}
+	nn := types.NamespacedName{Name: secretName, Namespace: req.Namespace}
 	log.V(DEBUG).Info("Retrieving Secret", "NamespacedName", nn)
-	if err := r.Get(ctx, nn, secret); err != nil {
+	// read past the cache, so that the Secrets of the cluster are not cached
+	if err := r.APIReader.Get(ctx, nn, secret); err != nil {
 		log.V(INFO).Info("unable to get authentication Secret", "err", err)
 		return nil, err
 	}
@@ -438,27 +861,47 @@ func (r *SosreportReconciler) getSosreportSecret(s *supportv1alpha1.Sosreport, r
 /*
 Update the "Sosreport" CR
 */
-func (r *SosreportReconciler) update(s *supportv1alpha1.Sosreport, req ctrl.Request) {
+func (r *SosreportReconciler) update(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
 	// update Sosreport resource
 	log.V(DEBUG).Info("Updating sosreport CR")
 	if err := r.Update(ctx, s); err != nil {
 		log.V(DEBUG).Info("unable to update Sosreport CR", "err", err)
+		return err
 	}
 	// after every update of a sosreport, get its new representation from the API
 	r.refreshSosreport(s, req)
+	return nil
 }
 
 /*
 Update the "Sosreport" CR's status
 */
-func (r *SosreportReconciler) updateStatus(s *supportv1alpha1.Sosreport, req ctrl.Request) {
+func (r *SosreportReconciler) updateStatus(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
 	// update Sosreport resource status
 	log.V(DEBUG).Info("Updating sosreport resource status")
+	// the retention policy counts the age of finished Sosreports from their completion
+	if s.Status.IsFinished() && s.Status.CompletionTime == nil {
+		completionTime := metav1.Now()
+		s.Status.CompletionTime = &completionTime
+	}
 	if err := r.Status().Update(ctx, s); err != nil {
 		log.V(DEBUG).Info("unable to update Sosreport status", "err", err)
+		return err
 	}
 	// after every update of a sosreport, get its new representation from the API
 	r.refreshSosreport(s, req)
+	return nil
+}
+
+/*
+A conflict means that the reconciler worked on an outdated copy of the Sosreport.
+Nothing was lost as all state is derived again in the next reconcile loop, so simply requeue.
+*/
+func requeueOnConflict(err error) (ctrl.Result, error) {
+	if apierrors.IsConflict(err) {
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, err
 }
 
 /*
@@ -475,32 +918,23 @@ func (r *SosreportReconciler) refreshSosreport(s *supportv1alpha1.Sosreport, req
 
 /*
 Get all jobs which belong to a specific sosreport
-We identify these by listing all jobs in the same namespace.
+We identify these by listing the jobs in the same namespace which carry this sosreport's labels.
 Then, we match the sosreport's UID with the job's ownerReference.UID from the job's metadata.
 If the 2 match, then the job belongs to this sosreport.
 */
 func (r *SosreportReconciler) getSosreportJobs(s *supportv1alpha1.Sosreport, req ctrl.Request) (*batchv1.JobList, error) {
 	allSosreportJobs := &batchv1.JobList{}
 	controllerSosreportJobs := &batchv1.JobList{}
-	if err := r.List(ctx, allSosreportJobs, client.InNamespace(req.Namespace)); err != nil {
+	listOpts := []client.ListOption{
+		client.InNamespace(req.Namespace),
+		client.MatchingLabels(r.labelsForSosreportJob(s.Name)),
+	}
+	if err := r.List(ctx, allSosreportJobs, listOpts...); err != nil {
 		log.Error(err, "unable to list child Jobs for sosreport")
 		return nil, err
 	}
 	for _, sosreportJob := range allSosreportJobs.Items {
-		// https://book.kubebuilder.io/cronjob-tutorial/controller-implementation.html
-		ownerReference := objectGetController(sosreportJob.ObjectMeta)
-		// there may be other jobs in this namespace with no owner
-		if ownerReference == nil {
-			continue
-		}
-		log.V(DEBUG).Info("Inspecting sosreport job's owner",
-			"Name", sosreportJob.Name,
-			"ownerReference.Kind", ownerReference.Kind,
-			"ownerReference.UID", ownerReference.UID,
-			"sosreport.UID", s.UID)
-		if ownerReference.Kind == "Sosreport" && ownerReference.UID == s.UID {
-			log.V(DEBUG).Info("ownerReference matches sosreport", "Kind", ownerReference.Kind,
-				"UID", ownerReference.UID)
+		if isOwnedBySosreport(sosreportJob.ObjectMeta, s) {
 			controllerSosreportJobs.Items = append(controllerSosreportJobs.Items, sosreportJob)
 		}
 	}
@@ -508,49 +942,92 @@ func (r *SosreportReconciler) getSosreportJobs(s *supportv1alpha1.Sosreport, req
 }
 
 /*
-Go through all jobs that belong to this sosreport and check if they are done
-A job is done if isJobDone returns true. That happens if the job is either JobComplete or JobFailed
+Determine if the object's controller is the given sosreport
 */
-func (r *SosreportReconciler) dequeueSosreportJobsDone(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
-	sosreportJobs, err := r.getSosreportJobs(s, req)
-	if err != nil {
-		log.Error(err, "Error in dequeueSosreportJobsDone")
-		return err
+func isOwnedBySosreport(o metav1.ObjectMeta, s *supportv1alpha1.Sosreport) bool {
+	// https://book.kubebuilder.io/cronjob-tutorial/controller-implementation.html
+	ownerReference := objectGetController(o)
+	// there may be other objects in this namespace with no owner
+	if ownerReference == nil {
+		return false
 	}
+	return ownerReference.Kind == "Sosreport" && ownerReference.UID == s.UID
+}
+
+// nodeAttempt identifies the sosreport job of one attempt on one node
+type nodeAttempt struct {
+	nodeName string
+	attempt  int32
+}
+
+/*
+Map each node name and attempt to the job which was created for it
+*/
+func sosreportJobsByNodeAttempt(sosreportJobs *batchv1.JobList) map[nodeAttempt]batchv1.Job {
+	jobsByNodeAttempt := make(map[nodeAttempt]batchv1.Job)
 	for _, sosreportJob := range sosreportJobs.Items {
+		key := nodeAttempt{sosreportJob.Annotations["nodeName"], getJobAttempt(sosreportJob)}
+		if j, ok := jobsByNodeAttempt[key]; ok && sosreportJob.CreationTimestamp.Before(&j.CreationTimestamp) {
+			continue
+		}
+		jobsByNodeAttempt[key] = sosreportJob
+	}
+	return jobsByNodeAttempt
+}
+
+/*
+Derive the state of every node from the jobs which belong to this sosreport.
+A node whose job is done is moved out of the running queue and its result is recorded. A node whose job exists
+but is not done is running - even if the status update which recorded the job's creation was lost.
+A failed node is put back into the run queue if its retryPolicy allows for another attempt.
+*/
+func (r *SosreportReconciler) synchronizeNodeStatesWithJobs(s *supportv1alpha1.Sosreport, sosreportJobs *batchv1.JobList, req ctrl.Request) {
+	jobsByNodeAttempt := sosreportJobsByNodeAttempt(sosreportJobs)
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		if nodeStatus.State == supportv1alpha1.NodeStateDone {
+			continue
+		}
+		sosreportJob, ok := jobsByNodeAttempt[nodeAttempt{nodeStatus.NodeName, getExpectedAttempt(nodeStatus)}]
+		if !ok {
+			if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+				log.V(DEBUG).Info("Job of running node not found, yet", "nodeName", nodeStatus.NodeName, "jobName", nodeStatus.JobName)
+			}
+			continue
+		}
 		log.V(DEBUG).Info("Inspecting sosreport job", "Name", sosreportJob.Name)
 		if done, _ := isJobDone(sosreportJob); !done {
 			log.V(DEBUG).Info("sosreport job is still running", "Name", sosreportJob.Name)
-		} else {
-			// delete from jobRunningList and report an event
-			log.V(DEBUG).Info("Delete job from jobRunningList", "sosreportJob.Annotations[\"nodeName\"]", sosreportJob.Annotations["nodeName"], "r.jobRunningList[s.UID]", r.jobRunningList[s.UID])
-			if _, ok := r.jobRunningList[s.UID][sosreportJob.Annotations["nodeName"]]; ok {
-				r.recorder.Event(s,
-					corev1.EventTypeNormal,
-					"Sosreport finished",
-					"Sosreport "+sosreportJob.Annotations["nodeName"]+" finished",
-				)
-				delete(r.jobRunningList[s.UID], sosreportJob.Annotations["nodeName"])
+			if nodeStatus.State != supportv1alpha1.NodeStateRunning {
+				recordSosreportJobStarted(s, &sosreportJob)
 			}
+			// a job whose pod cannot be scheduled would block its concurrency slot forever
+			message := r.getStuckSosreportJobMessage(s, sosreportJob)
+			if message == "" {
+				continue
+			}
+			if err := r.timeOutSosreportJob(s, sosreportJob, message); err != nil {
+				continue
+			}
+			r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport timed out", message)
+		} else {
+			// record the result, which also moves the node out of the running queue
+			r.recordSosreportJobResult(s, sosreportJob)
 		}
-	}
-
-	if j, err := json.Marshal(r.jobRunningList[s.UID]); err == nil {
-		if s.Annotations == nil {
-			s.Annotations = make(map[string]string)
-		}
-		if s.Annotations["job-running-list"] != string(j) {
-			s.Annotations["job-running-list"] = string(j)
-			r.update(s, req)
+		if scheduleSosreportRetry(s, nodeStatus) {
+			r.recorder.Event(s,
+				corev1.EventTypeWarning,
+				"Sosreport retry scheduled",
+				"Sosreport "+nodeStatus.NodeName+" failed, retrying at "+nodeStatus.NextAttemptTime.Format(time.RFC3339),
+			)
+			continue
 		}
+		r.recorder.Event(s,
+			corev1.EventTypeNormal,
+			"Sosreport finished",
+			"Sosreport "+nodeStatus.NodeName+" finished",
+		)
 	}
-
-	// log as an event for the sosreport
-	// TBD - individual logging per jobs - this is more complex as we should only log the event once
-	// per job. In the meantime, simply create an event when all jobs are done
-	// r.recorder.Event(s, corev1.EventTypeNormal, "Sosreports finished", "Sosreport batch finished")
-
-	return nil
 }
 
 /*
@@ -609,14 +1086,20 @@ func (r *SosreportReconciler) tolerates(s *supportv1alpha1.Sosreport, n corev1.N
 }
 
 /*
-Schedule jobs for this sosreport on Nodes which match the NodeSelector.
+Schedule jobs for this sosreport on Nodes which match the NodeSelector, the NodeLabelSelector and the NodeNames.
 */
 func (r *SosreportReconciler) scheduleSosreportJobs(s *supportv1alpha1.Sosreport, req ctrl.Request) (bool, error) {
-	// implement loop through nodes that are matched by sosreport's NodeSelector
+	// implement loop through nodes that are matched by sosreport's NodeSelector and NodeLabelSelector
 	nodeList := &corev1.NodeList{}
-	log.V(DEBUG).Info("Using NodeSelector", "s.Spec.NodeSelector", s.Spec.NodeSelector)
+	selector, err := getSosreportNodeLabelSelector(s)
+	if err != nil {
+		// the webhook rejects invalid selectors, but it may not be enabled
+		log.V(INFO).Info("Invalid NodeLabelSelector", "err", err)
+		return false, nil
+	}
+	log.V(DEBUG).Info("Using node selector", "selector", selector.String())
 	listOpts := []client.ListOption{
-		client.MatchingLabels(s.Spec.NodeSelector),
+		client.MatchingLabelsSelector{Selector: selector},
 	}
 	if err := r.List(ctx, nodeList, listOpts...); err != nil {
 		return false, err
@@ -629,166 +1112,334 @@ func (r *SosreportReconciler) scheduleSosreportJobs(s *supportv1alpha1.Sosreport
 		return false, nil
 	}
 
-	nodeNameList := make(map[string]struct{})
+	var eligibleNodes []corev1.Node
 	for _, node := range nodeList.Items {
+		// exclude nodes which are not listed or which are excluded by name
+		if !isNodeNameSelected(s, node) {
+			log.V(DEBUG).Info("Node is not selected by name, skipping", "node.Name", node.Name)
+			continue
+		}
+		// exclude cordoned nodes if the Sosreport asks for it
+		if s.Spec.SkipUnschedulableNodes && node.Spec.Unschedulable {
+			log.V(INFO).Info("Node is unschedulable, skipping", "node.Name", node.Name)
+			continue
+		}
 		// exclude nodes with Taints which do not match Toleration
 		if r.tolerates(s, node) {
-			nodeName := node.Labels["kubernetes.io/hostname"]
-			nodeNameList[nodeName] = struct{}{}
+			eligibleNodes = append(eligibleNodes, node)
 		} else {
 			log.V(INFO).Info("Node is not tolerated by Sosreport, skipping", "node.Name", node.Name, "node.Spec.Taints", node.Spec.Taints, "s.Spec.Tolerations", s.Spec.Tolerations)
 		}
 	}
 
-	if j, err := json.Marshal(nodeNameList); err == nil {
-		// every sosreport can have its list of names to run on
-		r.jobToRunList[s.UID] = nodeNameList
-		if s.Annotations == nil {
-			s.Annotations = make(map[string]string)
-		}
-		s.Annotations["job-to-run-list"] = string(j)
-		r.update(s, req)
+	nodeNameList := make(map[string]struct{})
+	for _, node := range sampleSosreportNodes(s, eligibleNodes) {
+		nodeNameList[getSosreportNodeName(&node)] = struct{}{}
+	}
+	if len(nodeNameList) == 0 {
+		log.V(INFO).Info("No node is tolerated by Sosreport",
+			"Sosreport.Namespace", s.Namespace,
+			"Sosreport.Name", s.Name,
+		)
+		return false, nil
+	}
+
+	// every sosreport can have its list of names to run on
+	nodeNames := make([]string, 0, len(nodeNameList))
+	for nodeName := range nodeNameList {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	for _, nodeName := range nodeNames {
+		getSosreportNodeStatus(s, nodeName).State = supportv1alpha1.NodeStateOutstanding
 	}
 
 	return true, nil
 }
 
 func (r *SosreportReconciler) isSosreportJobsDone(s *supportv1alpha1.Sosreport) bool {
-	toRunList, ok1 := r.jobToRunList[s.UID]
-	runningList, ok2 := r.jobRunningList[s.UID]
-	// we are done if either list does not exist or if either list is empty
-	isDone := (!ok1 || len(toRunList) == 0) &&
-		(!ok2 || len(runningList) == 0)
-
-	if isDone {
-		r.recorder.Event(s,
-			corev1.EventTypeNormal,
-			"Sosreports finished",
-			"All Sosreports finished",
-		)
+	// we are done if no node is outstanding or running
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.State != supportv1alpha1.NodeStateDone {
+			return false
+		}
 	}
-
-	return isDone
+	return true
 }
 
 /*
-Synchronize annotation with cache - in case the sosreport operator is restarted
+Convert the Finished and InProgress fields of older versions of this operator into a Phase. A Sosreport in progress
+is Running and its nodes are recovered from its annotations by migrateRunListAnnotations. The nodes of a finished
+Sosreport and their outcomes are recovered from its jobs, so that its phase is derived like for any other Sosreport.
+If its jobs are gone, nothing is known about its nodes, and it is considered Succeeded with an unknown Collected
+condition.
 */
-func (r *SosreportReconciler) synchronizeJobRunningCache(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
-	// the sosreport operator might have been restarted in the middle of a sosreport run
-	if _, inRunList := r.jobToRunList[s.UID]; !inRunList {
-		log.V(DEBUG).Info("Current jobToRunList for this job does not exist. Trying to load jobToRunList from s.Annotations[\"job-to-run-list\"]")
-		if annotationJson, annotationExists := s.Annotations["job-to-run-list"]; annotationExists {
-			log.V(DEBUG).Info("Annotation exists. Updating r.jobToRunList[s.UID]")
-			annotationData := make(map[string]struct{})
-			if err := json.Unmarshal([]byte(annotationJson), &annotationData); err == nil {
-				r.jobToRunList[s.UID] = annotationData
-				log.V(DEBUG).Info("Value is", "r.jobToRunList[s.UID]", r.jobToRunList[s.UID])
+func (r *SosreportReconciler) migrateLegacyStatus(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
+	if s.Status.Phase != "" || (!s.Status.Finished && !s.Status.InProgress) {
+		return nil
+	}
+	log.V(INFO).Info("Migrating the legacy status into a phase", "finished", s.Status.Finished,
+		"inProgress", s.Status.InProgress)
+
+	s.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+	if s.Status.Finished {
+		sosreportJobs, err := r.labelLegacySosreportJobs(s, req)
+		if err != nil {
+			return err
+		}
+		for i := range sosreportJobs {
+			if done, _ := isJobDone(sosreportJobs[i]); done {
+				r.recordSosreportJobResult(s, sosreportJobs[i])
 			} else {
-				log.Error(err, "Failed to unmarshal annotation", "s.Annotations[\"job-to-run-list\"]", annotationJson)
-				return err
+				recordSosreportJobStarted(s, &sosreportJobs[i])
 			}
 		}
+		if len(s.Status.Nodes) == 0 {
+			s.Status.Phase = supportv1alpha1.SosreportPhaseSucceeded
+			setSosreportCondition(s, supportv1alpha1.ConditionCollected, metav1.ConditionUnknown, "LegacyStatus",
+				"Finished under an older version of the operator, whose jobs no longer exist")
+		}
 	}
+	s.Status.Finished = false
+	s.Status.InProgress = false
+	return r.updateStatus(s, req)
+}
 
-	// the sosreport operator might have been restarted in the middle of a sosreport run
-	if _, inRunList := r.jobRunningList[s.UID]; !inRunList {
-		log.V(DEBUG).Info("Current jobRunningList for this job does not exist. Trying to load jobRunningList from s.Annotations[\"job-running-list\"]")
-		if annotationJson, annotationExists := s.Annotations["job-running-list"]; annotationExists {
-			log.V(DEBUG).Info("Annotation exists. Updating r.jobRunningList[s.UID]")
-			annotationData := make(map[string]struct{})
-			if err := json.Unmarshal([]byte(annotationJson), &annotationData); err == nil {
-				r.jobRunningList[s.UID] = annotationData
-				log.V(DEBUG).Info("Value is", "r.jobRunningList[s.UID]", r.jobRunningList[s.UID])
-			} else {
-				log.Error(err, "Failed to unmarshal annotation", "s.Annotations[\"job-running-list\"]", annotationJson)
-				return err
-			}
+/*
+Convert the "job-to-run-list" and "job-running-list" annotations of older versions of this operator
+into per-node records in the Status field and remove the annotations afterwards
+*/
+func (r *SosreportReconciler) migrateRunListAnnotations(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
+	toRunJson, hasToRunList := s.Annotations[JOB_TO_RUN_LIST_ANNOTATION]
+	runningJson, hasRunningList := s.Annotations[JOB_RUNNING_LIST_ANNOTATION]
+	if !hasToRunList && !hasRunningList {
+		return nil
+	}
+	log.V(INFO).Info("Migrating run list annotations into the Sosreport status")
+
+	jobToRunList := make(map[string]struct{})
+	if hasToRunList {
+		if err := json.Unmarshal([]byte(toRunJson), &jobToRunList); err != nil {
+			log.Error(err, "Failed to unmarshal annotation", "s.Annotations[\""+JOB_TO_RUN_LIST_ANNOTATION+"\"]", toRunJson)
+			return err
+		}
+	}
+	jobRunningList := make(map[string]struct{})
+	if hasRunningList {
+		if err := json.Unmarshal([]byte(runningJson), &jobRunningList); err != nil {
+			log.Error(err, "Failed to unmarshal annotation", "s.Annotations[\""+JOB_RUNNING_LIST_ANNOTATION+"\"]", runningJson)
+			return err
+		}
+	}
+
+	// jobs of older versions of this operator do not carry labels, so getSosreportJobs would not find them
+	sosreportJobs, err := r.labelLegacySosreportJobs(s, req)
+	if err != nil {
+		return err
+	}
+
+	// r.update replaces the status with the one that is stored in the API, so update the status afterwards
+	delete(s.Annotations, JOB_TO_RUN_LIST_ANNOTATION)
+	delete(s.Annotations, JOB_RUNNING_LIST_ANNOTATION)
+	if err := r.update(s, req); err != nil {
+		return err
+	}
+
+	// nodes which are in neither list are done, but we only know about them if they have a job. Their outcome is
+	// taken from the job, as a node only counts as succeeded with outcome Succeeded.
+	for i := range sosreportJobs {
+		if done, _ := isJobDone(sosreportJobs[i]); done {
+			r.recordSosreportJobResult(s, sosreportJobs[i])
+		} else {
+			recordSosreportJobStarted(s, &sosreportJobs[i])
 		}
 	}
+	for nodeName := range jobRunningList {
+		getSosreportNodeStatus(s, nodeName).State = supportv1alpha1.NodeStateRunning
+	}
+	for nodeName := range jobToRunList {
+		getSosreportNodeStatus(s, nodeName).State = supportv1alpha1.NodeStateOutstanding
+	}
+	// a sosreport with annotations was already scheduled
+	if isSosreportPending(s) {
+		s.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+	}
 
 	return nil
 }
 
 /*
-Run jobs for this sosreport - get jobs from the jobToRunList
+Add this sosreport's labels to all jobs that it owns in its namespace. Jobs which were created by older versions
+of this operator do not carry any labels.
 */
-func (r *SosreportReconciler) runSosreportJobs(s *supportv1alpha1.Sosreport, req ctrl.Request) (bool, error) {
-	// implement loop through nodes that are matched by sosreport's NodeSelector
-	nodeList := r.jobToRunList[s.UID]
-	// merge the ConfigMap and Secret and retrieve them as a map[string]string
-	configurationMap := r.getEnvConfigurationFromConfigMapAndSecret(s, req)
+func (r *SosreportReconciler) labelLegacySosreportJobs(s *supportv1alpha1.Sosreport, req ctrl.Request) ([]batchv1.Job, error) {
+	allJobs := &batchv1.JobList{}
+	if err := r.List(ctx, allJobs, client.InNamespace(req.Namespace)); err != nil {
+		log.Error(err, "unable to list child Jobs for sosreport")
+		return nil, err
+	}
+	var sosreportJobs []batchv1.Job
+	for _, sosreportJob := range allJobs.Items {
+		if !isOwnedBySosreport(sosreportJob.ObjectMeta, s) {
+			continue
+		}
+		if sosreportJob.Labels == nil {
+			sosreportJob.Labels = make(map[string]string)
+		}
+		for k, v := range r.labelsForSosreportJob(s.Name) {
+			sosreportJob.Labels[k] = v
+		}
+		if err := r.Update(ctx, &sosreportJob); err != nil {
+			log.Error(err, "unable to label sosreport job", "Job.Name", sosreportJob.Name)
+			return nil, err
+		}
+		sosreportJobs = append(sosreportJobs, sosreportJob)
+	}
+	return sosreportJobs, nil
+}
 
-	maxNewSosreports := r.sosreportConcurrency - len(r.jobRunningList[s.UID])
+/*
+Run jobs for this sosreport - start jobs for outstanding nodes until the concurrency is reached
+*/
+func (r *SosreportReconciler) runSosreportJobs(s *supportv1alpha1.Sosreport, conf *sosreportConfiguration, req ctrl.Request) error {
+	runningNodes := 0
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+			runningNodes++
+		}
+	}
+	maxNewSosreports := conf.sosreportConcurrency - runningNodes
 	log.V(DEBUG).Info("runSosreportJobs",
-		"r.sosreportConcurrency", r.sosreportConcurrency,
-		"len(r.jobRunningList[s.UID])", len(r.jobRunningList[s.UID]))
+		"conf.sosreportConcurrency", conf.sosreportConcurrency,
+		"runningNodes", runningNodes)
+	if maxNewSosreports <= 0 {
+		return nil
+	}
+
+	// merge the effective configuration and the spec into a map[string]string
+	// the upload credentials are only passed to the upload jobs, see sosreport_upload.go
+	configurationMap := make(map[string]string)
+	for k, v := range conf.environment {
+		configurationMap[k] = v
+	}
+	for k, v := range getEnvConfigurationFromSpec(s) {
+		configurationMap[k] = v
+	}
+
+	// the collector must exist before the first sosreport job hands off its archive
+	if getStorageMode(s) == supportv1alpha1.StorageModeShared {
+		if err := r.ensureSosreportCollector(s, conf); err != nil {
+			return err
+		}
+	}
+
+	// the cluster-wide slots must not change between counting them and creating the jobs
+	r.slotMutex.Lock()
+	defer r.slotMutex.Unlock()
+	slots, err := r.getClusterSlots()
+	if err != nil {
+		return err
+	}
+
 	i := 0
-	var newRunningNodes []string
-	for nodeName, _ := range nodeList {
+	for ni := range s.Status.Nodes {
 		if i >= maxNewSosreports {
 			break
 		}
+		if s.Status.Nodes[ni].State != supportv1alpha1.NodeStateOutstanding &&
+			s.Status.Nodes[ni].State != supportv1alpha1.NodeStateQueued {
+			continue
+		}
+		// failed nodes wait for their backoff to pass
+		if isWaitingForRetry(&s.Status.Nodes[ni]) {
+			continue
+		}
+		nodeName := s.Status.Nodes[ni].NodeName
+		attempt := s.Status.Nodes[ni].Attempts + 1
+
+		// wait for a slot if a cluster-wide limit is reached
+		if reason := slots.isExhausted(nodeName); reason != "" {
+			log.V(DEBUG).Info("Queueing sosreport job", "nodeName", nodeName, "reason", reason)
+			s.Status.Nodes[ni].State = supportv1alpha1.NodeStateQueued
+			s.Status.Nodes[ni].Reason = reason
+			continue
+		}
 
 		// Get a sosreport on this node
-		job, pvc, err := r.jobForSosreport(nodeName, configurationMap, s)
-		if err != nil {
+		job, pvc, err := r.jobForSosreport(nodeName, attempt, configurationMap, s, conf)
+		if _, ok := err.(*sosreportConfigurationError); ok {
+			return err
+		} else if err != nil {
 			log.Error(err, "Could not generate job", "nodeName", nodeName, "err", err)
 			continue
 		}
-		// Create the pvc
-		log.V(INFO).Info("Creating new PVC", "Job.Namespace", job.Namespace, "Job.Name", pvc.Name)
-		err = r.Create(ctx, pvc)
-		if err != nil {
-			log.Error(err, "Failed to create new PVC", "Job.Namespace", job.Namespace, "Job.Name", pvc.Name)
-			continue
+		// Create the pvc, unless the archive is handed off to the collector
+		// Job and PVC names are deterministic, so AlreadyExists means that an earlier reconcile loop created them
+		if pvc != nil {
+			log.V(INFO).Info("Creating new PVC", "Job.Namespace", job.Namespace, "Job.Name", pvc.Name)
+			err = r.Create(ctx, pvc)
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				log.Error(err, "Failed to create new PVC", "Job.Namespace", job.Namespace, "Job.Name", pvc.Name)
+				continue
+			}
 		}
 
 		// Create the job
 		log.V(INFO).Info("Creating new job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
 		err = r.Create(ctx, job)
-		if err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			log.V(DEBUG).Info("Job already exists", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			// the job of another node may have the same name if the hash in the name had to be truncated
+			if owner, err := r.getSosreportJobNodeName(job); err != nil {
+				log.Error(err, "Failed to get existing Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				continue
+			} else if owner != nodeName {
+				failSosreportNodeWithJobNameCollision(&s.Status.Nodes[ni], job.Name, owner)
+				r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport job name collision", s.Status.Nodes[ni].Reason)
+				continue
+			}
+		} else if err != nil {
 			log.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
 			continue
+		} else {
+			// log this job creation as an event for the sosreport
+			r.recorder.Event(s, corev1.EventTypeNormal, "Sosreport job started", "Sosreport started on "+nodeName)
 		}
-		// log this job creation as an event for the sosreport
-		r.recorder.Event(s, corev1.EventTypeNormal, "Sosreport job started", "Sosreport started on "+nodeName)
 
-		// remember which job switched to running
-		newRunningNodes = append(newRunningNodes, nodeName)
+		// record the started job in the per-node status, which also moves the node into the running queue
+		recordSosreportJobStarted(s, job)
+		slots.take(nodeName)
 
 		//increase the counter
 		i++
 	}
 
-	// move a running sosreport from jobToRunList to jobRunningList
-	if r.jobRunningList[s.UID] == nil {
-		r.jobRunningList[s.UID] = make(map[string]struct{})
-	}
-	for _, nodeName := range newRunningNodes {
-		r.jobRunningList[s.UID][nodeName] = struct{}{}
-		delete(r.jobToRunList[s.UID], nodeName)
-	}
+	return nil
+}
 
-	// update the CR annotation
-	doUpdate := false
-	if j, err := json.Marshal(r.jobToRunList[s.UID]); err == nil {
-		if s.Annotations["job-to-run-list"] != string(j) {
-			s.Annotations["job-to-run-list"] = string(j)
-			doUpdate = true
-		}
-	}
-	if j, err := json.Marshal(r.jobRunningList[s.UID]); err == nil {
-		if s.Annotations["job-running-list"] != string(j) {
-			s.Annotations["job-running-list"] = string(j)
-			doUpdate = true
-		}
-	}
-	if doUpdate {
-		r.update(s, req)
+/*
+Get the node of an existing sosreport job from its nodeName annotation. The job is read from the API server, as the
+cache may not contain it, yet.
+*/
+func (r *SosreportReconciler) getSosreportJobNodeName(job *batchv1.Job) (string, error) {
+	existingJob := &batchv1.Job{}
+	if err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: job.Namespace, Name: job.Name}, existingJob); err != nil {
+		return "", err
 	}
+	return existingJob.Annotations["nodeName"], nil
+}
 
-	return true, nil
+/*
+Fail a node whose job cannot be created, because a job of another node has the same name. The node would otherwise
+wait for a job which never reports for it.
+*/
+func failSosreportNodeWithJobNameCollision(nodeStatus *supportv1alpha1.SosreportNodeStatus, jobName, owner string) {
+	completionTime := metav1.Now()
+	nodeStatus.State = supportv1alpha1.NodeStateDone
+	nodeStatus.Outcome = supportv1alpha1.NodeOutcomeFailed
+	nodeStatus.Reason = fmt.Sprintf("Job %s belongs to node %s, use a shorter Sosreport name", jobName, owner)
+	nodeStatus.CompletionTime = &completionTime
+	nodeStatus.NextAttemptTime = nil
 }
 
 /*
@@ -806,27 +1457,65 @@ func mapToEnvVarArr(configurationMap map[string]string) []corev1.EnvVar {
 }
 
 /*
-Return a single job
+Return the number of characters of a node's name part which fit into the name of a sosreport job.
+Job names are <sosreport name>-<node part>-<timestamp>[-<attempt>] and the PVC name adds a "-pvc" suffix.
 */
-func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap map[string]string, s *supportv1alpha1.Sosreport) (*batchv1.Job, *corev1.PersistentVolumeClaim, error) {
-	layout := "20060102150405"
+func getMaxShortNameLength(sosreportName string) int {
+	// 2 dashes, the pvc name overhead of 4 characters and the attempt suffix of up to 3 characters
+	return 63 - 2 - len(sosreportName) - len(JOB_NAME_TIMESTAMP_LAYOUT) - 4 - 3
+}
 
-	// fix https://github.com/andreaskaris/sosreport-operator/issues/21
-	// only take the short hostname and cut off the shortName at 48 characters
-	// also account for the pvc name overhead of 4 characters
-	maxLen := 63 - 2 - len(s.Name) - len(layout) - 4
+/*
+Return the part of a sosreport job's name which identifies the node: the short hostname and a hash of the full node
+name, so that nodes with the same short hostname get jobs of their own. The short hostname is truncated to make room
+for the hash. If there is no room for both, only the hash is used, truncated to maxLen characters.
+*/
+func getJobNodePart(nodeName string, maxLen int) string {
+	h := fnv.New32a()
+	h.Write([]byte(nodeName))
+	hash := fmt.Sprintf("%08x", h.Sum32())
+	if maxLen <= len(hash)+1 {
+		if maxLen < len(hash) {
+			return hash[:maxLen]
+		}
+		return hash
+	}
 	shortName := strings.Split(nodeName, ".")[0]
-	if len(shortName) > maxLen {
-		shortName = shortName[:maxLen]
+	if len(shortName) > maxLen-len(hash)-1 {
+		shortName = shortName[:maxLen-len(hash)-1]
 	}
+	return shortName + "-" + hash
+}
 
-	jobName := fmt.Sprintf("%s-%s-%s", s.Name, shortName, time.Now().Format(layout))
+/*
+Return a single job
+*/
+func (r *SosreportReconciler) jobForSosreport(nodeName string, attempt int32, environmentMap map[string]string, s *supportv1alpha1.Sosreport, conf *sosreportConfiguration) (*batchv1.Job, *corev1.PersistentVolumeClaim, error) {
+	// fix https://github.com/andreaskaris/sosreport-operator/issues/21
+	// only take the short hostname and cut it off so that the job name fits
+	maxLen := getMaxShortNameLength(s.Name)
+	if maxLen < 1 {
+		return nil, nil, fmt.Errorf("Sosreport name %s is too long to generate job names", s.Name)
+	}
+
+	// the timestamp is the Sosreport's creation time, which makes the job name deterministic.
+	// Creating the same job twice, e.g. due to caching delay, hence fails with AlreadyExists.
+	jobName := fmt.Sprintf("%s-%s-%s", s.Name, getJobNodePart(nodeName, maxLen),
+		s.CreationTimestamp.Format(JOB_NAME_TIMESTAMP_LAYOUT))
+	// every retry gets a job and PVC of its own
+	if attempt > 1 {
+		jobName = fmt.Sprintf("%s-%d", jobName, attempt)
+	}
 	pvcName := fmt.Sprintf("%s-pvc", jobName)
 	labels := r.labelsForSosreportJob(s.Name)
 
 	var storageClassName *string
-	if r.pvcStorageClass != "" {
-		storageClassName = &r.pvcStorageClass
+	if conf.pvcStorageClass != "" {
+		storageClassName = &conf.pvcStorageClass
+	}
+	capacity, err := getPVCCapacity(conf)
+	if err != nil {
+		return nil, nil, err
 	}
 	pvc := &corev1.PersistentVolumeClaim{
 		Spec: corev1.PersistentVolumeClaimSpec{
@@ -836,7 +1525,7 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 			StorageClassName: storageClassName,
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resourcev1.MustParse(r.pvcCapacity),
+					corev1.ResourceStorage: capacity,
 				},
 			},
 		},
@@ -852,7 +1541,7 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 	}
 	// set this job's specific fields
 	job.ObjectMeta = metav1.ObjectMeta{
-		Labels:      make(map[string]string),
+		Labels:      r.labelsForSosreportJob(s.Name),
 		Annotations: make(map[string]string),
 		Name:        jobName,
 		Namespace:   s.Namespace,
@@ -862,6 +1551,7 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 	}
 
 	job.Spec.Template.Spec.Tolerations = s.Spec.Tolerations
+	job.Spec.ActiveDeadlineSeconds = getActiveDeadlineSeconds(s)
 	// This used to be:
 	// job.Spec.Template.Spec.NodeName = nodeName
 	// explanation for why this does not work with PVCs is here:
@@ -888,6 +1578,32 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 	}
 	// required for dequeuing from the run list
 	job.Annotations["nodeName"] = nodeName
+	// required for the per-node status
+	job.Annotations["pvcName"] = pvcName
+	job.Annotations[ATTEMPT_ANNOTATION] = strconv.Itoa(int(attempt))
+
+	job.Spec.Template.Spec.Containers[0].Image = conf.imageName
+	job.Spec.Template.Spec.Containers[0].Name = jobName
+	job.Spec.Template.Spec.Containers[0].Command = strings.Split(conf.sosreportCommand, " ")
+
+	job.Spec.Template.Spec.Containers[0].Env = mapToEnvVarArr(environmentMap)
+	// identifies the Sosreport and the node in the job's log
+	job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env,
+		corev1.EnvVar{Name: "SOSREPORT_NAMESPACE", Value: s.Namespace},
+		corev1.EnvVar{Name: "SOSREPORT_NAME", Value: s.Name},
+		corev1.EnvVar{Name: "NODE_NAME", Value: nodeName},
+	)
+
+	if conf.imagePullPolicy != "" {
+		job.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullPolicy(conf.imagePullPolicy)
+	}
+
+	// in the Shared storage mode, the archive is handed off to the collector instead of being written to a PVC
+	if getStorageMode(s) == supportv1alpha1.StorageModeShared {
+		useSosreportCollector(job, s)
+		ctrl.SetControllerReference(s, job, r.Scheme)
+		return job, nil, nil
+	}
 
 	pvcVolume := corev1.Volume{}
 	pvcVolume.Name = pvc.Name
@@ -901,12 +1617,6 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 		pvcVolume,
 	)
 
-	job.Spec.Template.Spec.Containers[0].Image = r.imageName
-	job.Spec.Template.Spec.Containers[0].Name = jobName
-	job.Spec.Template.Spec.Containers[0].Command = strings.Split(r.sosreportCommand, " ")
-
-	job.Spec.Template.Spec.Containers[0].Env = mapToEnvVarArr(environmentMap)
-
 	job.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 		job.Spec.Template.Spec.Containers[0].VolumeMounts,
 		corev1.VolumeMount{
@@ -915,10 +1625,6 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 		},
 	)
 
-	if r.imagePullPolicy != "" {
-		job.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullPolicy(r.imagePullPolicy)
-	}
-
 	// Set ownerReferences
 	// Set Sosreport instance as the owner of this pvc
 	ctrl.SetControllerReference(s, pvc, r.Scheme)
@@ -932,10 +1638,10 @@ func (r *SosreportReconciler) jobForSosreport(nodeName string, environmentMap ma
 Return the labels that shall be attached to a sosreport's job
 */
 func (r *SosreportReconciler) labelsForSosreportJob(name string) map[string]string {
-	return map[string]string{"app": "sosreport", "sosreport-cr": name}
+	return sosreportpvc.Labels(name)
 }
 
-func getTemplatesDir() (string, error) {
+func getTemplatesDir(log logr.Logger) (string, error) {
 	// This should normally find a templates directory right in the directory where this application is running
 	// in case of unit tests, we might find templates at "../templates", instead
 	for _, d := range []string{"templates", "../templates"} {
@@ -962,7 +1668,7 @@ Dynamically read a job from a template in the templates/ subfolder
 See https://github.com/kubernetes/client-go/issues/193
 */
 func (r *SosreportReconciler) jobFromTemplate(templateName string) (*batchv1.Job, error) {
-	templatesDir, err := getTemplatesDir()
+	templatesDir, err := getTemplatesDir(log)
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +17,7 @@ import (
 	"fmt"
 	"os"
 	//"reflect"
-	"encoding/json"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -26,6 +26,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	errorsv1 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -337,6 +338,7 @@ var _ = Describe("Sosreport controller", func() {
 			}
 
 			By("By creating a new Sosreport")
+			logSize := int32(50)
 			// Create a new Sosreport
 			sosreport = &supportv1alpha1.Sosreport{
 				TypeMeta: metav1.TypeMeta{
@@ -361,6 +363,15 @@ var _ = Describe("Sosreport controller", func() {
 							Effect: corev1.TaintEffectNoSchedule,
 						},
 					},
+					PluginOptions: map[string]string{
+						"crio.logs": "off",
+					},
+					LogSize: &logSize,
+					Timeout: &metav1.Duration{Duration: 30 * time.Minute},
+					RetryPolicy: &supportv1alpha1.SosreportRetryPolicy{
+						MaxAttempts: 2,
+						Backoff:     &metav1.Duration{Duration: time.Second},
+					},
 				},
 			}
 			Expect(k8sClient.Create(ctx, sosreport)).Should(Succeed())
@@ -376,7 +387,7 @@ var _ = Describe("Sosreport controller", func() {
 				return true
 			}, TIMEOUT, INTERVAL).Should(BeTrue())
 
-			By("By making sure that the Sosreport switches to InProgress")
+			By("By making sure that the Sosreport leaves the Pending phase")
 			// We'll need to retry getting this newly created Sosreport, given that creation may not immediately happen.
 			Eventually(func() bool {
 				// We need to retrieve a new copy of the Sosreport object at each try
@@ -384,11 +395,12 @@ var _ = Describe("Sosreport controller", func() {
 				if err != nil {
 					return false
 				}
-				// fmt.Fprintf(GinkgoWriter, "Test: %v\n", createdSosreport.Status.InProgress)
-				return createdSosreport.Status.InProgress
+				// fmt.Fprintf(GinkgoWriter, "Test: %v\n", createdSosreport.Status.Phase)
+				return createdSosreport.Status.Phase == supportv1alpha1.SosreportPhaseScheduling ||
+					createdSosreport.Status.Phase == supportv1alpha1.SosreportPhaseRunning
 			}, TIMEOUT, INTERVAL).Should(BeTrue())
 
-			By("By making sure that the Sosreport has a job in the job-to-run-list")
+			By("By making sure that the Sosreport has an outstanding node")
 			// We'll need to retry getting this newly created Sosreport, given that creation may not immediately happen.
 			Eventually(func() bool {
 				// We need to retrieve a new copy of the Sosreport object at each try
@@ -396,56 +408,62 @@ var _ = Describe("Sosreport controller", func() {
 				if err != nil {
 					return false
 				}
-
-				if _, ok = createdSosreport.Annotations["job-to-run-list"]; !ok {
-					return false
-				}
-
-				fmt.Fprintf(GinkgoWriter, "createdSosreport.Annotations[\"job-to-run-list\"]: %v\n", createdSosreport.Annotations["job-to-run-list"])
-				var jobToRunList map[string]struct{}
-				err = json.Unmarshal(
-					[]byte(createdSosreport.Annotations["job-to-run-list"]),
-					&jobToRunList,
-				)
-				if err != nil {
-					fmt.Fprintf(GinkgoWriter, "err %v", err)
-					return false
-				}
-				if len(jobToRunList) > 0 {
-					return true
-				}
-				return false
+				fmt.Fprintf(GinkgoWriter, "createdSosreport.Status.OutstandingNodes: %v\n", createdSosreport.Status.OutstandingNodes)
+				return len(createdSosreport.Status.OutstandingNodes) > 0
 			}, TIMEOUT, INTERVAL).Should(BeTrue())
 
-			By("By making sure that the Sosreport has a job in the job-running-list")
+			By("By making sure that the Sosreport has a running node")
 			// We'll need to retry getting this newly created Sosreport, given that creation may not immediately happen.
-
 			Eventually(func() bool {
 				// We need to retrieve a new copy of the Sosreport object at each try
 				err := k8sClient.Get(ctx, namespacedNameSosreport, createdSosreport)
 				if err != nil {
 					return false
 				}
+				fmt.Fprintf(GinkgoWriter, "createdSosreport.Status.CurrentlyRunningNodes: %v\n", createdSosreport.Status.CurrentlyRunningNodes)
+				return len(createdSosreport.Status.CurrentlyRunningNodes) > 0
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
 
-				if _, ok = createdSosreport.Annotations["job-running-list"]; !ok {
-					return false
-				}
+			By("By making sure that the effective configuration is recorded in the Sosreport")
+			Expect(createdSosreport.Status.EffectiveConfiguration).NotTo(BeNil())
+			Expect(createdSosreport.Status.EffectiveConfiguration.Image).To(Equal(sosreportImage))
+			Expect(createdSosreport.Status.EffectiveConfiguration.Command).To(Equal("bash -x /scripts/entrypoint.sh"))
+			Expect(createdSosreport.Status.EffectiveConfiguration.ImagePullPolicy).To(Equal("Always"))
+			Expect(createdSosreport.Status.EffectiveConfiguration.Environment).To(HaveKeyWithValue("DEBUG", "true"))
+			Expect(createdSosreport.Status.EffectiveConfiguration.Sources).To(Equal([]string{"ConfigMaps"}))
 
-				fmt.Fprintf(GinkgoWriter, "createdSosreport.Annotations[\"job-running-list\"]: %v\n", createdSosreport.Annotations["job-running-list"])
-				var jobRunningList map[string]struct{}
-				err = json.Unmarshal(
-					[]byte(createdSosreport.Annotations["job-running-list"]),
-					&jobRunningList,
-				)
-				if err != nil {
-					fmt.Fprintf(GinkgoWriter, "err %v", err)
-					return false
-				}
-				if len(jobRunningList) > 0 {
-					return true
+			if !useExistingCluster {
+				By("By raising the concurrency while the Sosreport runs")
+				globalCm := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      GLOBAL_CONFIG_MAP_NAME,
+						Namespace: SOSREPORT_NAMESPACE,
+					},
+					Data: map[string]string{
+						"concurrency": "2",
+					},
 				}
-				return false
-			}, TIMEOUT, INTERVAL).Should(BeTrue())
+				Expect(k8sClient.Create(ctx, globalCm)).Should(Succeed())
+				Eventually(func() int {
+					if err := k8sClient.Get(ctx, namespacedNameSosreport, createdSosreport); err != nil {
+						return 0
+					}
+					return createdSosreport.Status.EffectiveConfiguration.Concurrency
+				}, TIMEOUT, INTERVAL).Should(Equal(2))
+
+				By("By restoring the default concurrency")
+				Expect(k8sClient.Delete(ctx, globalCm)).Should(Succeed())
+				Eventually(func() int {
+					if err := k8sClient.Get(ctx, namespacedNameSosreport, createdSosreport); err != nil {
+						return 0
+					}
+					return createdSosreport.Status.EffectiveConfiguration.Concurrency
+				}, TIMEOUT, INTERVAL).Should(Equal(DEFAULT_SOSREPORT_CONCURRENCY))
+			}
+
+			By("By making sure that the run queue is not kept in annotations")
+			Expect(createdSosreport.Annotations).NotTo(HaveKey("job-to-run-list"))
+			Expect(createdSosreport.Annotations).NotTo(HaveKey("job-running-list"))
 
 			By("Retrieving a list of all jobs that belong to this sosreport")
 			allSosreportJobs := &batchv1.JobList{}
@@ -473,7 +491,57 @@ var _ = Describe("Sosreport controller", func() {
 				}
 			}
 
+			By("By making sure that the sos report options and the timeout are passed to the jobs")
+			Expect(controllerSosreportJobs.Items).NotTo(BeEmpty())
+			for _, job := range controllerSosreportJobs.Items {
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+					corev1.EnvVar{Name: "SOS_PLUGIN_OPTIONS", Value: "crio.all=on,crio.logs=off"}))
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+					corev1.EnvVar{Name: "SOS_LOG_SIZE", Value: "50"}))
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+					corev1.EnvVar{Name: "SOSREPORT_NAME", Value: SOSREPORT_NAME}))
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+					corev1.EnvVar{Name: "NODE_NAME", Value: job.Annotations["nodeName"]}))
+				Expect(job.Spec.ActiveDeadlineSeconds).NotTo(BeNil())
+				Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64(1800)))
+			}
+
 			if !useExistingCluster {
+				By("Failing the first attempt of the running job")
+				failedJob := controllerSosreportJobs.Items[0]
+				failedJob.Status.Conditions = append(failedJob.Status.Conditions,
+					batchv1.JobCondition{
+						Type:   batchv1.JobFailed,
+						Status: corev1.ConditionTrue,
+						Reason: "BackoffLimitExceeded",
+					})
+				Expect(k8sClient.Status().Update(ctx, &failedJob)).Should(Succeed())
+
+				By("By making sure that the failed node is retried")
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, namespacedNameSosreport, createdSosreport)
+					if err != nil {
+						return false
+					}
+					for _, nodeStatus := range createdSosreport.Status.Nodes {
+						if nodeStatus.NodeName == failedJob.Annotations["nodeName"] {
+							return nodeStatus.State == supportv1alpha1.NodeStateRunning &&
+								nodeStatus.Attempts == 2 &&
+								nodeStatus.JobName == failedJob.Name+"-2"
+						}
+					}
+					return false
+				}, TIMEOUT, INTERVAL).Should(BeTrue())
+
+				By("Retrieving the job of the second attempt")
+				retriedJob := &batchv1.Job{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: SOSREPORT_NAMESPACE,
+					Name:      failedJob.Name + "-2",
+				}, retriedJob)).Should(Succeed())
+				Expect(retriedJob.Annotations).To(HaveKeyWithValue("attempt", "2"))
+				controllerSosreportJobs.Items = []batchv1.Job{*retriedJob}
+
 				By("Setting all jobs to done")
 				for _, job := range controllerSosreportJobs.Items {
 					job.Status.Conditions = append(job.Status.Conditions,
@@ -486,7 +554,7 @@ var _ = Describe("Sosreport controller", func() {
 					Expect(err).ShouldNot(HaveOccurred())
 				}
 
-				By("By making sure that the Sosreport has no job in the job-to-run-list")
+				By("By making sure that the Sosreport has no outstanding node")
 				// We'll need to retry getting this newly created Sosreport, given that creation may not immediately happen.
 				Eventually(func() bool {
 					// We need to retrieve a new copy of the Sosreport object at each try
@@ -494,11 +562,11 @@ var _ = Describe("Sosreport controller", func() {
 					if err != nil {
 						return false
 					}
-					// fmt.Fprintf(GinkgoWriter, "createdSosreport.Annotations[\"job-to-run-list\"]: %v\n", createdSosreport.Annotations["job-to-run-list"])
-					return createdSosreport.Annotations["job-to-run-list"] == "{}"
+					// fmt.Fprintf(GinkgoWriter, "createdSosreport.Status.OutstandingNodes: %v\n", createdSosreport.Status.OutstandingNodes)
+					return len(createdSosreport.Status.OutstandingNodes) == 0
 				}, TIMEOUT, INTERVAL).Should(BeTrue())
 
-				By("By making sure that the Sosreport has a job in the job-running-list")
+				By("By making sure that the Sosreport has the other node running")
 				// We'll need to retry getting this newly created Sosreport, given that creation may not immediately happen.
 				Eventually(func() bool {
 					// We need to retrieve a new copy of the Sosreport object at each try
@@ -506,9 +574,10 @@ var _ = Describe("Sosreport controller", func() {
 					if err != nil {
 						return false
 					}
-					// fmt.Fprintf(GinkgoWriter, "createdSosreport.Annotations[\"job-running-list\"]: %v\n", createdSosreport.Annotations["job-running-list"])
-					return createdSosreport.Annotations["job-running-list"] == "{\"worker-1\":{}}" ||
-						createdSosreport.Annotations["job-running-list"] == "{\"worker-0\":{}}"
+					// fmt.Fprintf(GinkgoWriter, "createdSosreport.Status.CurrentlyRunningNodes: %v\n", createdSosreport.Status.CurrentlyRunningNodes)
+					return len(createdSosreport.Status.CurrentlyRunningNodes) == 1 &&
+						(createdSosreport.Status.CurrentlyRunningNodes[0] == "worker-1" ||
+							createdSosreport.Status.CurrentlyRunningNodes[0] == "worker-0")
 				}, TIMEOUT, INTERVAL).Should(BeTrue())
 
 				By("Retrieving a list of all jobs that belong to this sosreport")
@@ -550,7 +619,7 @@ var _ = Describe("Sosreport controller", func() {
 				}
 			} // if !useExistingCluster
 
-			By("By making sure that the Sosreport switches to Finished")
+			By("By making sure that the Sosreport switches to Succeeded")
 			timeout := TIMEOUT
 			if useExistingCluster {
 				timeout = USE_EXISTING_CLUSTER_TIMEOUT
@@ -561,10 +630,26 @@ var _ = Describe("Sosreport controller", func() {
 				if err != nil {
 					return false
 				}
-				// fmt.Fprintf(GinkgoWriter, "Test: %v\n", createdSosreport.Status.Finished)
-				return createdSosreport.Status.Finished
+				// fmt.Fprintf(GinkgoWriter, "Test: %v\n", createdSosreport.Status.Phase)
+				return createdSosreport.Status.Phase == supportv1alpha1.SosreportPhaseSucceeded
 			}, timeout, INTERVAL).Should(BeTrue())
 
+			By("By making sure that the Sosreport reports all nodes as collected")
+			collected := meta.FindStatusCondition(createdSosreport.Status.Conditions, supportv1alpha1.ConditionCollected)
+			Expect(collected).NotTo(BeNil())
+			Expect(collected.Status).To(Equal(metav1.ConditionTrue))
+			Expect(meta.IsStatusConditionFalse(createdSosreport.Status.Conditions, supportv1alpha1.ConditionJobsRunning)).To(BeTrue())
+
+			By("By making sure that the Sosreport has a successful record for every node")
+			Expect(createdSosreport.Status.Nodes).NotTo(BeEmpty())
+			for _, nodeStatus := range createdSosreport.Status.Nodes {
+				Expect(nodeStatus.JobName).NotTo(Equal(""))
+				Expect(nodeStatus.PVCName).NotTo(Equal(""))
+				Expect(nodeStatus.StartTime).NotTo(BeNil())
+				Expect(nodeStatus.CompletionTime).NotTo(BeNil())
+				Expect(nodeStatus.Outcome).To(Equal(supportv1alpha1.NodeOutcomeSucceeded))
+			}
+
 			if useExistingCluster {
 				By("Retrieving a list of all jobs that belong to this sosreport")
 				allSosreportJobs = &batchv1.JobList{}
@@ -626,6 +711,21 @@ var _ = Describe("Sosreport controller", func() {
 		})
 	})
 
+	Context("When naming the jobs of nodes with the same short hostname", func() {
+		It("Should give every node a job name of its own", func() {
+			maxLen := getMaxShortNameLength("sample")
+			a := getJobNodePart("worker-0.cluster-a.example.com", maxLen)
+			b := getJobNodePart("worker-0.cluster-b.example.com", maxLen)
+			Expect(a).To(HavePrefix("worker-0-"))
+			Expect(a).NotTo(Equal(b))
+
+			long := strings.Repeat("w", 63) + ".example.com"
+			Expect(len(getJobNodePart(long, maxLen))).To(Equal(maxLen))
+			Expect(getJobNodePart(long, maxLen)).NotTo(Equal(getJobNodePart(long+".", maxLen)))
+			Expect(getJobNodePart(long, 3)).To(HaveLen(3))
+		})
+	})
+
 })
 
 /*
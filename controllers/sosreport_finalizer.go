@@ -0,0 +1,402 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	SOSREPORT_FINALIZER      = "support.openshift.io/archives" // keeps a Sosreport until its uploads and exports are done
+	DEFAULT_DELETION_TIMEOUT = 30 * time.Minute
+	DELETION_REQUEUE_PERIOD  = 10 * time.Second
+	EXPORT_COMMAND           = "bash /scripts/export_archives.sh"
+)
+
+/*
+Get the action which is taken before a Sosreport is deleted
+*/
+func getDeletionAction(s *supportv1alpha1.Sosreport) supportv1alpha1.SosreportDeletionAction {
+	if s.Spec.DeletionPolicy == nil || s.Spec.DeletionPolicy.Action == "" {
+		return supportv1alpha1.DeletionActionWaitForUploads
+	}
+	return s.Spec.DeletionPolicy.Action
+}
+
+/*
+Get the time after which the deletion of a Sosreport stops waiting
+*/
+func getDeletionTimeout(s *supportv1alpha1.Sosreport) time.Duration {
+	if s.Spec.DeletionPolicy == nil || s.Spec.DeletionPolicy.Timeout == nil {
+		return DEFAULT_DELETION_TIMEOUT
+	}
+	return s.Spec.DeletionPolicy.Timeout.Duration
+}
+
+/*
+Add the finalizer to a Sosreport which does not carry it, yet. This includes Sosreports which were created by older
+versions of this operator.
+*/
+func (r *SosreportReconciler) ensureSosreportFinalizer(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
+	if controllerutil.ContainsFinalizer(s, SOSREPORT_FINALIZER) {
+		return nil
+	}
+	log.V(DEBUG).Info("Adding finalizer", "finalizer", SOSREPORT_FINALIZER)
+	controllerutil.AddFinalizer(s, SOSREPORT_FINALIZER)
+	return r.update(s, req)
+}
+
+/*
+Run the deletion action of a Sosreport which is being deleted. The finalizer is removed once the action is done or
+once the deletion timeout passed, and the outcome is recorded as an event. An action which can never succeed, or
+which keeps failing until the deletion timeout, does not keep the Sosreport.
+*/
+func (r *SosreportReconciler) finalizeSosreport(s *supportv1alpha1.Sosreport, req ctrl.Request) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(s, SOSREPORT_FINALIZER) {
+		return ctrl.Result{}, nil
+	}
+
+	var message string
+	done := true
+	var err error
+	switch getDeletionAction(s) {
+	case supportv1alpha1.DeletionActionWaitForUploads:
+		message, done, err = r.waitForSosreportUploads(s, req)
+	case supportv1alpha1.DeletionActionExport:
+		message, done, err = r.exportSosreportArchives(s, req)
+	default:
+		message = "Deleted without waiting for uploads"
+	}
+	if configErr, ok := err.(*sosreportConfigurationError); ok {
+		r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport deletion action failed", configErr.message)
+		message, done, err = configErr.message, true, nil
+	}
+
+	timeout := getDeletionTimeout(s)
+	if err != nil {
+		if time.Now().Before(s.DeletionTimestamp.Add(timeout)) {
+			log.Error(err, "unable to finalize sosreport")
+			return ctrl.Result{}, err
+		}
+		log.Error(err, "unable to finalize sosreport, giving up after the deletion timeout")
+		message, done = err.Error(), false
+	}
+	if !done {
+		untilDeadline := time.Until(s.DeletionTimestamp.Add(timeout))
+		if untilDeadline > 0 {
+			log.V(INFO).Info("Waiting before the Sosreport can be deleted", "message", message)
+			if err := r.updateStatus(s, req); err != nil {
+				return requeueOnConflict(err)
+			}
+			if untilDeadline > DELETION_REQUEUE_PERIOD {
+				untilDeadline = DELETION_REQUEUE_PERIOD
+			}
+			return ctrl.Result{RequeueAfter: untilDeadline}, nil
+		}
+		r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport deletion timed out",
+			fmt.Sprintf("Gave up after %s: %s", timeout, message))
+	} else {
+		r.recorder.Event(s, corev1.EventTypeNormal, "Sosreport finalized", message)
+	}
+
+	log.V(INFO).Info("Removing finalizer", "finalizer", SOSREPORT_FINALIZER, "message", message)
+	controllerutil.RemoveFinalizer(s, SOSREPORT_FINALIZER)
+	return requeueOnConflict(r.update(s, req))
+}
+
+/*
+Refresh the per-node records of a Sosreport which is being deleted. No further jobs are started. Returns the number
+of nodes whose jobs are still running.
+*/
+func (r *SosreportReconciler) synchronizeDeletedSosreportJobs(s *supportv1alpha1.Sosreport, req ctrl.Request) (int, error) {
+	sosreportJobs, err := r.getSosreportJobs(s, req)
+	if err != nil {
+		return 0, err
+	}
+	r.synchronizeNodeStatesWithJobs(s, sosreportJobs, req)
+	if _, err := r.synchronizeNodeStatesWithNodes(s); err != nil {
+		return 0, err
+	}
+	running := 0
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+			running++
+		}
+	}
+	return running, nil
+}
+
+/*
+Wait for running sosreport jobs and upload the archives which they collect. Returns a message which describes the
+state of the uploads and whether all of them are done.
+*/
+func (r *SosreportReconciler) waitForSosreportUploads(s *supportv1alpha1.Sosreport, req ctrl.Request) (string, bool, error) {
+	running, err := r.synchronizeDeletedSosreportJobs(s, req)
+	if err != nil {
+		return "", false, err
+	}
+	if !isUploadConfigured(s) {
+		return "No uploads are configured", true, nil
+	}
+	if err := r.synchronizeSosreportUploads(s); err != nil {
+		return "", false, err
+	}
+	// without a valid configuration, no further upload jobs are started but the running ones are waited for
+	conf, err := r.getSosreportConfiguration(s, req)
+	if err == nil {
+		if err := r.runSosreportUploads(s, conf, req); err != nil {
+			return "", false, err
+		}
+	} else if _, ok := err.(*sosreportConfigurationError); !ok {
+		return "", false, err
+	}
+	uploadMethod := getUploadMethods(s)
+	if running > 0 {
+		return fmt.Sprintf("Waiting for %d running node(s) before uploading via %s", running, uploadMethod), false, nil
+	}
+	if !isSosreportUploadsDone(s) {
+		return fmt.Sprintf("Waiting for the %s uploads: %s", uploadMethod, summarizeSosreportUploads(s)), false, nil
+	}
+	return summarizeSosreportUploads(s), true, nil
+}
+
+/*
+Count the results of the uploads of a Sosreport to all of its targets, e.g. "Uploads: 2 Succeeded, 1 Failed"
+*/
+func summarizeSosreportUploads(s *supportv1alpha1.Sosreport) string {
+	results := make(map[string]int)
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.Upload != nil && nodeStatus.Upload.Result != "" {
+			results[nodeStatus.Upload.Result]++
+		}
+		for _, upload := range nodeStatus.Uploads {
+			if upload.Result != "" {
+				results[upload.Result]++
+			}
+		}
+	}
+	if len(results) == 0 {
+		return "No archives were uploaded"
+	}
+	var counts []string
+	for result, count := range results {
+		counts = append(counts, fmt.Sprintf("%d %s", count, result))
+	}
+	sort.Strings(counts)
+	return "Uploads: " + strings.Join(counts, ", ")
+}
+
+/*
+Return the labels of export jobs. They differ from the labels of sosreport jobs, so that export jobs are neither
+mistaken for a node's job nor counted against the concurrency limits.
+*/
+func labelsForSosreportExport(name string) map[string]string {
+	return map[string]string{"app": "sosreport-export", "sosreport-cr": name}
+}
+
+/*
+Return the name of the export job of a PVC. PVC names may be longer than a job name, so they are hashed.
+*/
+func getExportJobName(s *supportv1alpha1.Sosreport, pvcName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(pvcName))
+	return fmt.Sprintf("%s-export-%08x", s.Name, h.Sum32())
+}
+
+/*
+Copy the archives on all PVCs of a Sosreport to the export PVC, with one export job per PVC. The export PVC may be
+ReadWriteOnce, so the export jobs run one after another. Running sosreport jobs and the collector are allowed to
+finish first. Returns a message which describes the state of the export and whether it is done.
+*/
+func (r *SosreportReconciler) exportSosreportArchives(s *supportv1alpha1.Sosreport, req ctrl.Request) (string, bool, error) {
+	// the webhook rejects this as well, but it may not be deployed
+	if s.Spec.DeletionPolicy == nil || s.Spec.DeletionPolicy.ExportPVCName == "" {
+		return "", false, &sosreportConfigurationError{
+			reason:  "ExportPVCMissing",
+			message: "Cannot export the archives, spec.deletionPolicy.exportPVCName is not set",
+		}
+	}
+	running, err := r.synchronizeDeletedSosreportJobs(s, req)
+	if err != nil {
+		return "", false, err
+	}
+	if running > 0 {
+		return fmt.Sprintf("Waiting for %d running node(s) before exporting the archives", running), false, nil
+	}
+	// the collector may hold a ReadWriteOnce shared PVC
+	if err := r.stopSosreportCollector(s); err != nil {
+		return "", false, err
+	}
+
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcList, client.InNamespace(s.Namespace),
+		client.MatchingLabels(r.labelsForSosreportJob(s.Name))); err != nil {
+		return "", false, err
+	}
+	var pvcNames []string
+	for _, pvc := range pvcList.Items {
+		if isOwnedBySosreport(pvc.ObjectMeta, s) {
+			pvcNames = append(pvcNames, pvc.Name)
+		}
+	}
+	exportPVCName := s.Spec.DeletionPolicy.ExportPVCName
+	if len(pvcNames) == 0 {
+		return "No archives to export", true, nil
+	}
+	// the PVCs are exported in a stable order
+	sort.Strings(pvcNames)
+
+	exported, failed := 0, 0
+	for _, pvcName := range pvcNames {
+		job := &batchv1.Job{}
+		jobName := getExportJobName(s, pvcName)
+		err := r.Get(ctx, types.NamespacedName{Namespace: s.Namespace, Name: jobName}, job)
+		if apierrors.IsNotFound(err) {
+			job, err := r.exportJobForSosreport(s, jobName, pvcName)
+			if err != nil {
+				return "", false, err
+			}
+			log.V(INFO).Info("Creating export job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "PVC", pvcName)
+			err = r.Create(ctx, job)
+			if apierrors.IsInvalid(err) {
+				// the job will never be accepted, e.g. because of an invalid export PVC name
+				log.Error(err, "Export job is invalid", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				failed++
+				continue
+			} else if err != nil && !apierrors.IsAlreadyExists(err) {
+				return "", false, err
+			}
+			return exportProgress(pvcName, exported+failed, len(pvcNames), exportPVCName), false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		switch done, condition := isJobDone(*job); {
+		case !done:
+			return exportProgress(pvcName, exported+failed, len(pvcNames), exportPVCName), false, nil
+		case condition == batchv1.JobComplete:
+			exported++
+		default:
+			failed++
+		}
+	}
+	return fmt.Sprintf("Exported the archives of %d PVC(s) to PVC %s, %d export(s) failed", exported, exportPVCName,
+		failed), true, nil
+}
+
+/*
+Describe a running export, e.g. "Exporting the archives of PVC sosreport-sample-worker-0 (2/3) to PVC exports"
+*/
+func exportProgress(pvcName string, done, total int, exportPVCName string) string {
+	return fmt.Sprintf("Exporting the archives of PVC %s (%d/%d) to PVC %s", pvcName, done+1, total, exportPVCName)
+}
+
+/*
+Create the definition of an export job, which copies the archives on a PVC to <namespace>/<sosreport>/<pvc> on the
+export PVC
+*/
+func (r *SosreportReconciler) exportJobForSosreport(s *supportv1alpha1.Sosreport, jobName, pvcName string) (*batchv1.Job, error) {
+	image := DEFAULT_IMAGE_NAME
+	imagePullPolicy := corev1.PullPolicy(DEFAULT_IMAGE_PULL_POLICY)
+	if ec := s.Status.EffectiveConfiguration; ec != nil {
+		image = ec.Image
+		imagePullPolicy = corev1.PullPolicy(ec.ImagePullPolicy)
+	}
+	labels := labelsForSosreportExport(s.Name)
+	privileged := true
+	backoffLimit := int32(2)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: s.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				"pvcName": pvcName,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Tolerations:   s.Spec.Tolerations,
+					Containers: []corev1.Container{
+						{
+							Name:            "export",
+							Image:           image,
+							ImagePullPolicy: imagePullPolicy,
+							Command:         strings.Split(EXPORT_COMMAND, " "),
+							Env: []corev1.EnvVar{
+								{Name: "EXPORT_DIR", Value: s.Namespace + "/" + s.Name + "/" + pvcName},
+							},
+							// the archives are only readable by root
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: &privileged,
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "pv", MountPath: "/pv", ReadOnly: true},
+								{Name: "export", MountPath: "/export"},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "pv",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvcName,
+									ReadOnly:  true,
+								},
+							},
+						},
+						{
+							Name: "export",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: s.Spec.DeletionPolicy.ExportPVCName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	// export jobs are deleted together with their Sosreport, once it is released
+	if err := ctrl.SetControllerReference(s, job, r.Scheme); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
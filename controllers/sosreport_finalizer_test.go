@@ -0,0 +1,170 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport finalizer", func() {
+
+	const (
+		FINALIZER_NAMESPACE = "default"
+		NODE_LABEL          = "sosreport-finalizer-test"
+		TIMEOUT             = time.Second * 10
+		INTERVAL            = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	Context("When a Sosreport without uploads is deleted", func() {
+		It("Should release it right away", func() {
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "finalizer-no-uploads",
+					Namespace: FINALIZER_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "none",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: FINALIZER_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the finalizer to be added")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Finalizers
+			}, TIMEOUT, INTERVAL).Should(ContainElement(SOSREPORT_FINALIZER))
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, namespacedName, &supportv1alpha1.Sosreport{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+		})
+	})
+
+	Context("When the Export deletion action has no export PVC", func() {
+		It("Should fail the export instead of retrying it", func() {
+			r := &SosreportReconciler{Client: k8sClient}
+			s := &supportv1alpha1.Sosreport{
+				Spec: supportv1alpha1.SosreportSpec{
+					DeletionPolicy: &supportv1alpha1.SosreportDeletionPolicy{
+						Action: supportv1alpha1.DeletionActionExport,
+					},
+				},
+			}
+			_, _, err := r.exportSosreportArchives(s, ctrl.Request{})
+			Expect(err).To(BeAssignableToTypeOf(&sosreportConfigurationError{}))
+		})
+	})
+
+	Context("When a Sosreport with the Export deletion action is deleted", func() {
+		It("Should wait for its nodes and export the archives of their PVCs", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "finalizer-0",
+					Labels: map[string]string{
+						NODE_LABEL:     "",
+						HOSTNAME_LABEL: "finalizer-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "finalizer-export",
+					Namespace: FINALIZER_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+					DeletionPolicy: &supportv1alpha1.SosreportDeletionPolicy{
+						Action:        supportv1alpha1.DeletionActionExport,
+						ExportPVCName: "finalizer-export-target",
+						// envtest runs no job controller, so the export job never finishes
+						Timeout: &metav1.Duration{Duration: 5 * time.Second},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: FINALIZER_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the sosreport job of the node to run")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"finalizer-0"}))
+			pvcName := s.Status.Nodes[0].PVCName
+
+			By("Deleting the Sosreport while its node is running")
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Consistently(func() error {
+				return k8sClient.Get(ctx, namespacedName, &supportv1alpha1.Sosreport{})
+			}, time.Second, INTERVAL).Should(Succeed())
+			jobList := &batchv1.JobList{}
+			Expect(k8sClient.List(ctx, jobList, client.InNamespace(FINALIZER_NAMESPACE),
+				client.MatchingLabels(labelsForSosreportExport(s.Name)))).Should(Succeed())
+			Expect(jobList.Items).To(BeEmpty())
+
+			By("Deleting the node so that the export starts")
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			exportJob := &batchv1.Job{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Namespace: FINALIZER_NAMESPACE, Name: getExportJobName(s, pvcName)}, exportJob)
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+			volumes := exportJob.Spec.Template.Spec.Volumes
+			Expect(volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(pvcName))
+			Expect(volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("finalizer-export-target"))
+			Expect(exportJob.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+				corev1.EnvVar{Name: "EXPORT_DIR", Value: FINALIZER_NAMESPACE + "/" + s.Name + "/" + pvcName}))
+
+			By("Waiting for the deletion to time out")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, namespacedName, &supportv1alpha1.Sosreport{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+		})
+	})
+})
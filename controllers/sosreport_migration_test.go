@@ -0,0 +1,176 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport migration", func() {
+
+	const (
+		MIGRATION_NAMESPACE = "default"
+		NODE_LABEL          = "sosreport-migration-test"
+		TIMEOUT             = time.Second * 10
+		INTERVAL            = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	Context("When a Sosreport of an older version of this operator only has the legacy status fields", func() {
+		It("Should not run it again if it finished", func() {
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "legacy-finished",
+					Namespace: MIGRATION_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL + "-none": "",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: MIGRATION_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the Sosreport to fail for the lack of nodes")
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+
+			By("Replacing its status with the status of an older version of this operator")
+			s.Status = supportv1alpha1.SosreportStatus{Finished: true}
+			Expect(k8sClient.Status().Update(ctx, s)).Should(Succeed())
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseSucceeded))
+			Expect(s.Status.Finished).To(BeFalse())
+			Expect(s.Status.Nodes).To(BeEmpty())
+			Expect(s.Status.EffectiveConfiguration).To(BeNil())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+		})
+	})
+
+	Context("When a Sosreport of an older version of this operator keeps its run lists in annotations", func() {
+		It("Should take the outcome of the finished nodes from their jobs", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "legacy-0",
+					Labels: map[string]string{
+						NODE_LABEL:     "",
+						HOSTNAME_LABEL: "legacy-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			By("Creating a Sosreport whose annotations cannot be migrated, yet")
+			// the migration fails until the annotations are valid, so the legacy job can be created first
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "legacy",
+					Namespace: MIGRATION_NAMESPACE,
+					Annotations: map[string]string{
+						JOB_TO_RUN_LIST_ANNOTATION:  "{}",
+						JOB_RUNNING_LIST_ANNOTATION: "not yet",
+					},
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: MIGRATION_NAMESPACE, Name: s.Name}
+
+			By("Creating the completed job of an older version, which has no labels")
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "legacy-legacy-0-20210305200645",
+					Namespace:   MIGRATION_NAMESPACE,
+					Annotations: map[string]string{"nodeName": "legacy-0"},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers:    []corev1.Container{{Name: "sosreport", Image: "sosreport"}},
+						},
+					},
+				},
+			}
+			Expect(ctrl.SetControllerReference(s, job, scheme.Scheme)).Should(Succeed())
+			Expect(k8sClient.Create(ctx, job)).Should(Succeed())
+			completionTime := metav1.Now()
+			job.Status.CompletionTime = &completionTime
+			job.Status.Conditions = []batchv1.JobCondition{{
+				Type:   batchv1.JobComplete,
+				Status: corev1.ConditionTrue,
+			}}
+			Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+			By("Fixing the annotations so that the Sosreport is migrated")
+			Expect(k8sClient.Get(ctx, namespacedName, s)).Should(Succeed())
+			s.Annotations[JOB_RUNNING_LIST_ANNOTATION] = "{}"
+			Expect(k8sClient.Update(ctx, s)).Should(Succeed())
+
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseSucceeded))
+			Expect(s.Annotations).NotTo(HaveKey(JOB_RUNNING_LIST_ANNOTATION))
+			Expect(s.Status.Nodes).To(HaveLen(1))
+			Expect(s.Status.Nodes[0].NodeName).To(Equal("legacy-0"))
+			Expect(s.Status.Nodes[0].Outcome).To(Equal(supportv1alpha1.NodeOutcomeSucceeded))
+			Expect(s.Status.Nodes[0].JobName).To(Equal(job.Name))
+
+			// envtest runs no garbage collector
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &batchv1.Job{}, client.InNamespace(MIGRATION_NAMESPACE),
+				client.MatchingLabels{"app": "sosreport", "sosreport-cr": s.Name})).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+		})
+	})
+})
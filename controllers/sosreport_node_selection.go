@@ -0,0 +1,111 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"hash/fnv"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+/*
+Combine the NodeSelector and the NodeLabelSelector of a Sosreport into a single label selector
+*/
+func getSosreportNodeLabelSelector(s *supportv1alpha1.Sosreport) (labels.Selector, error) {
+	selector := labels.SelectorFromSet(s.Spec.NodeSelector)
+	if s.Spec.NodeLabelSelector == nil {
+		return selector, nil
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(s.Spec.NodeLabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := labelSelector.Requirements()
+	return selector.Add(requirements...), nil
+}
+
+/*
+Determine if a node is selected by the Sosreport's NodeNames and ExcludeNodeNames. Nodes are matched by their name
+as well as by their hostname label.
+*/
+func isNodeNameSelected(s *supportv1alpha1.Sosreport, node corev1.Node) bool {
+	names := map[string]struct{}{
+		node.Name:                   {},
+		getSosreportNodeName(&node): {},
+	}
+	for _, excluded := range s.Spec.ExcludeNodeNames {
+		if _, ok := names[excluded]; ok {
+			return false
+		}
+	}
+	if len(s.Spec.NodeNames) == 0 {
+		return true
+	}
+	for _, nodeName := range s.Spec.NodeNames {
+		if _, ok := names[nodeName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Select spec.sample.count nodes out of each group of eligible nodes. The choice is stable for a given Sosreport, so
+that every reconcile loop picks the same nodes, but differs between Sosreports, so that repeated Sosreports do not
+always collect from the same nodes.
+*/
+func sampleSosreportNodes(s *supportv1alpha1.Sosreport, nodes []corev1.Node) []corev1.Node {
+	if s.Spec.Sample == nil {
+		return nodes
+	}
+
+	rank := func(node corev1.Node) uint32 {
+		h := fnv.New32a()
+		h.Write([]byte(string(s.UID) + "/" + node.Name))
+		return h.Sum32()
+	}
+	groups := make(map[string][]corev1.Node)
+	for _, node := range nodes {
+		group := ""
+		if s.Spec.Sample.GroupByLabel != "" {
+			group = node.Labels[s.Spec.Sample.GroupByLabel]
+		}
+		groups[group] = append(groups[group], node)
+	}
+
+	var sampled []corev1.Node
+	for group, groupNodes := range groups {
+		sort.Slice(groupNodes, func(i, j int) bool {
+			ri, rj := rank(groupNodes[i]), rank(groupNodes[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return groupNodes[i].Name < groupNodes[j].Name
+		})
+		if len(groupNodes) > int(s.Spec.Sample.Count) {
+			groupNodes = groupNodes[:s.Spec.Sample.Count]
+		}
+		log.V(DEBUG).Info("Sampled nodes", "group", group, "count", len(groupNodes))
+		sampled = append(sampled, groupNodes...)
+	}
+	return sampled
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	HOSTNAME_LABEL = "kubernetes.io/hostname" // the per-node records of a Sosreport are keyed by this label
+	// how long a node has to be NotReady before it is given up on, so that short hiccups do not fail its job
+	NODE_NOT_READY_GRACE_PERIOD = 5 * time.Minute
+)
+
+/*
+Get the name which a node is recorded with in the status of a Sosreport
+*/
+func getSosreportNodeName(o metav1.Object) string {
+	if hostname, ok := o.GetLabels()[HOSTNAME_LABEL]; ok {
+		return hostname
+	}
+	return o.GetName()
+}
+
+/*
+A node is NotReady if its Ready condition is False or Unknown. A node which did not report its readiness, yet, is
+not NotReady.
+*/
+func isNodeNotReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status != corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+/*
+Get how much longer a NotReady node may stay NotReady before it is given up on. The grace period starts with the
+last transition of the node's Ready condition. Returns 0 if the grace period passed or if the node is Ready.
+*/
+func getNodeNotReadyGracePeriod(node corev1.Node, now time.Time) time.Duration {
+	for _, c := range node.Status.Conditions {
+		if c.Type != corev1.NodeReady || c.Status == corev1.ConditionTrue || c.LastTransitionTime.IsZero() {
+			continue
+		}
+		if remaining := c.LastTransitionTime.Add(NODE_NOT_READY_GRACE_PERIOD).Sub(now); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+/*
+Determine if a node can no longer run its sosreport job. Returns a message which explains why, or "" if the node
+is fine. A NotReady node is only lost once it was NotReady for NODE_NOT_READY_GRACE_PERIOD, until then the time
+which is left is returned.
+*/
+func getNodeLostMessage(nodesByName map[string]corev1.Node, nodeName string, now time.Time) (string, time.Duration) {
+	node, ok := nodesByName[nodeName]
+	if !ok {
+		return fmt.Sprintf("Node %s was deleted", nodeName), 0
+	}
+	if isNodeNotReady(node) {
+		if remaining := getNodeNotReadyGracePeriod(node, now); remaining > 0 {
+			return "", remaining
+		}
+		return fmt.Sprintf("Node %s is NotReady for more than %s", nodeName, NODE_NOT_READY_GRACE_PERIOD), 0
+	}
+	return "", 0
+}
+
+/*
+Finish the per-node records of nodes which were deleted or are NotReady for longer than the grace period. Nodes
+which were not started, yet, are Skipped. The jobs of running nodes are deleted so that they no longer take up a
+concurrency slot and the nodes are recorded as NodeLost. Returns when the grace period of the next NotReady node
+ends, or 0 if there is none.
+*/
+func (r *SosreportReconciler) synchronizeNodeStatesWithNodes(s *supportv1alpha1.Sosreport) (time.Duration, error) {
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList); err != nil {
+		return 0, err
+	}
+	nodesByName := make(map[string]corev1.Node)
+	for _, node := range nodeList.Items {
+		nodesByName[getSosreportNodeName(&node)] = node
+	}
+
+	now := time.Now()
+	var nextCheck time.Duration
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		if nodeStatus.State == supportv1alpha1.NodeStateDone {
+			continue
+		}
+		message, remaining := getNodeLostMessage(nodesByName, nodeStatus.NodeName, now)
+		if remaining > 0 && (nextCheck == 0 || remaining < nextCheck) {
+			nextCheck = remaining
+		}
+		if message == "" {
+			continue
+		}
+
+		outcome := supportv1alpha1.NodeOutcomeSkipped
+		if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+			outcome = supportv1alpha1.NodeOutcomeNodeLost
+			if err := r.deleteSosreportJob(s.Namespace, nodeStatus.JobName, message); err != nil {
+				return 0, err
+			}
+		}
+
+		completionTime := metav1.Now()
+		nodeStatus.State = supportv1alpha1.NodeStateDone
+		nodeStatus.Outcome = outcome
+		nodeStatus.Reason = message
+		nodeStatus.CompletionTime = &completionTime
+		nodeStatus.NextAttemptTime = nil
+		r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport node lost", message)
+	}
+	return nextCheck, nil
+}
+
+/*
+Delete the sosreport job of a node which will not finish, if the job is known
+*/
+func (r *SosreportReconciler) deleteSosreportJob(namespace, jobName, message string) error {
+	if jobName == "" {
+		return nil
+	}
+	job := &batchv1.Job{}
+	job.Namespace = namespace
+	job.Name = jobName
+	log.V(INFO).Info("Deleting sosreport job", "Job.Namespace", namespace, "Job.Name", jobName, "message", message)
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil &&
+		!apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete sosreport job", "Job.Namespace", namespace, "Job.Name", jobName)
+		return err
+	}
+	return nil
+}
+
+/*
+Map a change of a node to the Sosreports which wait for it or run on it
+*/
+func (r *SosreportReconciler) mapNodeToSosreports(o handler.MapObject) []reconcile.Request {
+	nodeName := getSosreportNodeName(o.Meta)
+	return r.getUnfinishedSosreportRequests("", func(s *supportv1alpha1.Sosreport) bool {
+		for _, nodeStatus := range s.Status.Nodes {
+			if nodeStatus.NodeName == nodeName && nodeStatus.State != supportv1alpha1.NodeStateDone {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+/*
+Nodes update their status frequently. Only deletions and changes of their readiness are of interest.
+*/
+var nodeLostPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return isNodeNotReady(*oldNode) != isNodeNotReady(*newNode)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return true
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport node handling", func() {
+
+	const (
+		NODES_NAMESPACE = "default"
+		NODE_LABEL      = "sosreport-nodes-test"
+		TIMEOUT         = time.Second * 10
+		INTERVAL        = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	newNode := func(name string, unschedulable bool) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					NODE_LABEL:     "",
+					HOSTNAME_LABEL: name,
+				},
+			},
+			Spec: corev1.NodeSpec{
+				Unschedulable: unschedulable,
+			},
+		}
+	}
+
+	Context("When a node becomes NotReady", func() {
+		It("Should only give up on it after the grace period", func() {
+			now := time.Now()
+			node := newNode("not-ready-0", false)
+			node.Status.Conditions = []corev1.NodeCondition{{
+				Type:               corev1.NodeReady,
+				Status:             corev1.ConditionUnknown,
+				LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
+			}}
+			nodesByName := map[string]corev1.Node{"not-ready-0": *node}
+
+			message, remaining := getNodeLostMessage(nodesByName, "not-ready-0", now)
+			Expect(message).To(BeEmpty())
+			Expect(remaining).To(Equal(NODE_NOT_READY_GRACE_PERIOD - time.Minute))
+
+			message, remaining = getNodeLostMessage(nodesByName, "not-ready-0", now.Add(NODE_NOT_READY_GRACE_PERIOD))
+			Expect(message).To(ContainSubstring("NotReady"))
+			Expect(remaining).To(BeZero())
+
+			message, _ = getNodeLostMessage(nodesByName, "deleted-0", now)
+			Expect(message).To(ContainSubstring("deleted"))
+
+			node.Status.Conditions[0].Status = corev1.ConditionTrue
+			nodesByName["not-ready-0"] = *node
+			message, remaining = getNodeLostMessage(nodesByName, "not-ready-0", now.Add(time.Hour))
+			Expect(message).To(BeEmpty())
+			Expect(remaining).To(BeZero())
+		})
+	})
+
+	Context("When a node is lost while its sosreport job runs", func() {
+		It("Should skip cordoned nodes and record the lost node as NodeLost", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be deleted in an existing cluster")
+			}
+
+			lostNode := newNode("lost-0", false)
+			Expect(k8sClient.Create(ctx, lostNode)).Should(Succeed())
+			cordonedNode := newNode("cordoned-0", true)
+			Expect(k8sClient.Create(ctx, cordonedNode)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nodes-lost",
+					Namespace: NODES_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+					SkipUnschedulableNodes: true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: NODES_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the sosreport job of the node to run")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"lost-0"}))
+			Expect(s.Status.Nodes).To(HaveLen(1))
+
+			By("Deleting the node")
+			Expect(k8sClient.Delete(ctx, lostNode)).Should(Succeed())
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+			Expect(s.Status.Nodes[0].Outcome).To(Equal(supportv1alpha1.NodeOutcomeNodeLost))
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, cordonedNode)).Should(Succeed())
+		})
+	})
+
+	Context("When selecting nodes", func() {
+		It("Should honor label expressions, excluded node names and sampling", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			var nodes []*corev1.Node
+			for _, name := range []string{"pool-a-0", "pool-a-1", "pool-b-0", "pool-b-1", "pool-c-0"} {
+				node := newNode(name, false)
+				node.Labels[NODE_LABEL+"-pool"] = name[len("pool-") : len("pool-")+1]
+				Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+				nodes = append(nodes, node)
+			}
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nodes-sample",
+					Namespace: NODES_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeLabelSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{
+								Key:      NODE_LABEL + "-pool",
+								Operator: metav1.LabelSelectorOpIn,
+								Values:   []string{"a", "b"},
+							},
+						},
+					},
+					ExcludeNodeNames: []string{"pool-b-1"},
+					Sample: &supportv1alpha1.SosreportNodeSample{
+						Count:        1,
+						GroupByLabel: NODE_LABEL + "-pool",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: NODES_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the nodes to be selected")
+			Eventually(func() int {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return 0
+				}
+				return len(s.Status.Nodes)
+			}, TIMEOUT, INTERVAL).Should(Equal(2))
+			var selected []string
+			for _, nodeStatus := range s.Status.Nodes {
+				selected = append(selected, nodeStatus.NodeName)
+			}
+			Expect(selected).To(ContainElement("pool-b-0"))
+			Expect(selected).To(ContainElement(Or(Equal("pool-a-0"), Equal("pool-a-1"))))
+
+			By("Deleting the nodes so that the Sosreport finishes")
+			for _, node := range nodes {
+				Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			}
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return false
+				}
+				return s.Status.IsFinished()
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+		})
+	})
+})
@@ -0,0 +1,247 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+	"github.com/andreaskaris/sosreport-operator/pkg/sosreportpvc"
+)
+
+const (
+	DEFAULT_RETENTION_INTERVAL = time.Minute // how often the garbage collector looks for expired Sosreports
+)
+
+// RetentionPolicy limits how many finished Sosreports are kept. The zero value keeps everything.
+type RetentionPolicy struct {
+	// KeepLast is the number of finished Sosreports which are kept per namespace. 0 means no limit.
+	KeepLast int
+	// MaxAge is the time after their completion for which finished Sosreports are kept. 0 means no limit.
+	MaxAge time.Duration
+	// MaxPVCBytes limits the capacity of the PVCs of all Sosreports. The oldest finished Sosreports are deleted
+	// until their PVCs fit. nil means no limit.
+	MaxPVCBytes *resource.Quantity
+	// RetainPVCs keeps the PVCs of all Sosreports which are deleted, as if their spec.retainPVCs was set
+	RetainPVCs bool
+}
+
+// SosreportGarbageCollector deletes finished Sosreports once their TTLAfterFinished passed or once the retention
+// policy no longer keeps them.
+type SosreportGarbageCollector struct {
+	Client   client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Policy   RetentionPolicy
+	// Interval is the time between two runs. Defaults to DEFAULT_RETENTION_INTERVAL.
+	Interval time.Duration
+}
+
+/*
+Add the garbage collector to the manager. It only runs on the leader.
+*/
+func (g *SosreportGarbageCollector) SetupWithManager(mgr ctrl.Manager) error {
+	if g.Client == nil {
+		g.Client = mgr.GetClient()
+	}
+	if g.Recorder == nil {
+		g.Recorder = mgr.GetEventRecorderFor("sosreport-garbage-collector")
+	}
+	if g.Interval == 0 {
+		g.Interval = DEFAULT_RETENTION_INTERVAL
+	}
+	return mgr.Add(g)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (g *SosreportGarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable
+func (g *SosreportGarbageCollector) Start(stop <-chan struct{}) error {
+	g.Log.Info("Starting garbage collector", "interval", g.Interval, "keepLast", g.Policy.KeepLast,
+		"maxAge", g.Policy.MaxAge, "maxPVCBytes", g.Policy.MaxPVCBytes, "retainPVCs", g.Policy.RetainPVCs)
+	wait.Until(func() {
+		if err := g.collect(); err != nil {
+			g.Log.Error(err, "Garbage collection failed")
+		}
+	}, g.Interval, stop)
+	return nil
+}
+
+/*
+Delete all expired Sosreports
+*/
+func (g *SosreportGarbageCollector) collect() error {
+	sosreportList := &supportv1alpha1.SosreportList{}
+	if err := g.Client.List(ctx, sosreportList); err != nil {
+		return err
+	}
+	pvcBytes := make(map[types.UID]int64)
+	if g.Policy.MaxPVCBytes != nil {
+		pvcList := &corev1.PersistentVolumeClaimList{}
+		if err := g.Client.List(ctx, pvcList, client.MatchingLabels{"app": "sosreport"}); err != nil {
+			return err
+		}
+		pvcBytes = getPVCBytesBySosreport(pvcList.Items)
+	}
+
+	expired := selectExpiredSosreports(sosreportList.Items, pvcBytes, g.Policy, time.Now())
+	for i := range sosreportList.Items {
+		s := &sosreportList.Items[i]
+		reason, ok := expired[s.UID]
+		if !ok {
+			continue
+		}
+		if err := g.deleteSosreport(s, reason); err != nil {
+			g.Log.Error(err, "Could not delete expired Sosreport", "Sosreport.Namespace", s.Namespace,
+				"Sosreport.Name", s.Name)
+		}
+	}
+	return nil
+}
+
+/*
+Delete a Sosreport together with its jobs and pods. Its PVCs are deleted as well, unless they are retained.
+*/
+func (g *SosreportGarbageCollector) deleteSosreport(s *supportv1alpha1.Sosreport, reason string) error {
+	retainPVCs := s.Spec.RetainPVCs || g.Policy.RetainPVCs
+	g.Log.Info("Deleting expired Sosreport", "Sosreport.Namespace", s.Namespace, "Sosreport.Name", s.Name,
+		"reason", reason, "retainPVCs", retainPVCs)
+	message := fmt.Sprintf("Deleting Sosreport: %s", reason)
+	if retainPVCs {
+		pvcNames, err := sosreportpvc.Orphan(ctx, g.Client, s)
+		if err != nil {
+			return err
+		}
+		message = fmt.Sprintf("%s, retaining PVCs %v", message, pvcNames)
+	}
+	g.Recorder.Event(s, corev1.EventTypeNormal, "Sosreport expired", message)
+
+	uid := s.UID
+	err := g.Client.Delete(ctx, s, client.PropagationPolicy(metav1.DeletePropagationBackground),
+		client.Preconditions{UID: &uid})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+/*
+Sum up the capacity of the PVCs of each Sosreport. Bound PVCs count with their actual capacity, others with their
+request.
+*/
+func getPVCBytesBySosreport(pvcs []corev1.PersistentVolumeClaim) map[types.UID]int64 {
+	pvcBytes := make(map[types.UID]int64)
+	for _, pvc := range pvcs {
+		ownerReference := objectGetController(pvc.ObjectMeta)
+		if ownerReference == nil || ownerReference.Kind != "Sosreport" {
+			continue
+		}
+		capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+		if !ok {
+			capacity = pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		}
+		pvcBytes[ownerReference.UID] += capacity.Value()
+	}
+	return pvcBytes
+}
+
+/*
+Get the time when a Sosreport finished. Sosreports which were finished by older versions of this operator have no
+completion time and count from their creation.
+*/
+func getSosreportCompletionTime(s *supportv1alpha1.Sosreport) time.Time {
+	if s.Status.CompletionTime != nil {
+		return s.Status.CompletionTime.Time
+	}
+	return s.CreationTimestamp.Time
+}
+
+/*
+Select the finished Sosreports which are to be deleted. Returns the reason for the deletion of each by UID.
+Running Sosreports are never selected, but their PVCs count against MaxPVCBytes.
+*/
+func selectExpiredSosreports(sosreports []supportv1alpha1.Sosreport, pvcBytes map[types.UID]int64, policy RetentionPolicy, now time.Time) map[types.UID]string {
+	expired := make(map[types.UID]string)
+
+	// finished Sosreports, the newest first
+	var finished []*supportv1alpha1.Sosreport
+	for i := range sosreports {
+		if sosreports[i].Status.IsFinished() && sosreports[i].DeletionTimestamp == nil {
+			finished = append(finished, &sosreports[i])
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return getSosreportCompletionTime(finished[i]).After(getSosreportCompletionTime(finished[j]))
+	})
+
+	for _, s := range finished {
+		age := now.Sub(getSosreportCompletionTime(s))
+		if s.Spec.TTLAfterFinished != nil && age >= s.Spec.TTLAfterFinished.Duration {
+			expired[s.UID] = fmt.Sprintf("finished more than %s ago (ttlAfterFinished)", s.Spec.TTLAfterFinished.Duration)
+		} else if policy.MaxAge > 0 && age >= policy.MaxAge {
+			expired[s.UID] = fmt.Sprintf("finished more than %s ago (retention policy)", policy.MaxAge)
+		}
+	}
+
+	if policy.KeepLast > 0 {
+		kept := make(map[string]int)
+		for _, s := range finished {
+			if _, ok := expired[s.UID]; ok {
+				continue
+			}
+			kept[s.Namespace]++
+			if kept[s.Namespace] > policy.KeepLast {
+				expired[s.UID] = fmt.Sprintf("only the last %d finished Sosreports of a namespace are kept", policy.KeepLast)
+			}
+		}
+	}
+
+	if policy.MaxPVCBytes != nil {
+		var total int64
+		for i := range sosreports {
+			if _, ok := expired[sosreports[i].UID]; !ok {
+				total += pvcBytes[sosreports[i].UID]
+			}
+		}
+		// delete the oldest finished Sosreports first
+		for i := len(finished) - 1; i >= 0 && total > policy.MaxPVCBytes.Value(); i-- {
+			s := finished[i]
+			if _, ok := expired[s.UID]; ok || pvcBytes[s.UID] == 0 {
+				continue
+			}
+			expired[s.UID] = fmt.Sprintf("the PVCs of all Sosreports exceed %s", policy.MaxPVCBytes.String())
+			total -= pvcBytes[s.UID]
+		}
+	}
+	return expired
+}
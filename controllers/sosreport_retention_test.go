@@ -0,0 +1,192 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+	"github.com/andreaskaris/sosreport-operator/pkg/sosreportpvc"
+)
+
+var _ = Describe("Sosreport retention", func() {
+
+	const (
+		RETENTION_NAMESPACE = "default"
+		TIMEOUT             = time.Second * 10
+		INTERVAL            = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// a Sosreport which finished the given time before now
+	finishedSosreport := func(namespace, name string, ago time.Duration) supportv1alpha1.Sosreport {
+		completionTime := metav1.NewTime(now.Add(-ago))
+		return supportv1alpha1.Sosreport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				UID:       types.UID(namespace + "/" + name),
+			},
+			Status: supportv1alpha1.SosreportStatus{
+				Phase:          supportv1alpha1.SosreportPhaseSucceeded,
+				CompletionTime: &completionTime,
+			},
+		}
+	}
+
+	Context("When selecting expired Sosreports", func() {
+		It("Should apply the TTL, the maximum age and the number of kept Sosreports per namespace", func() {
+			withTTL := finishedSosreport("a", "ttl", time.Hour)
+			withTTL.Spec.TTLAfterFinished = &metav1.Duration{Duration: 30 * time.Minute}
+			running := finishedSosreport("a", "running", 0)
+			running.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+			sosreports := []supportv1alpha1.Sosreport{
+				withTTL,
+				finishedSosreport("a", "new", time.Minute),
+				finishedSosreport("a", "older", 2*time.Hour),
+				finishedSosreport("a", "oldest", 3*time.Hour),
+				finishedSosreport("b", "old", 48*time.Hour),
+				running,
+			}
+
+			expired := selectExpiredSosreports(sosreports, nil, RetentionPolicy{}, now)
+			Expect(expired).To(HaveLen(1))
+			Expect(expired).To(HaveKey(types.UID("a/ttl")))
+
+			expired = selectExpiredSosreports(sosreports, nil, RetentionPolicy{KeepLast: 2, MaxAge: 24 * time.Hour}, now)
+			Expect(expired).To(HaveLen(3))
+			Expect(expired).To(HaveKey(types.UID("a/ttl")))
+			Expect(expired).To(HaveKey(types.UID("a/oldest")))
+			Expect(expired).To(HaveKey(types.UID("b/old")))
+		})
+
+		It("Should delete the oldest finished Sosreports until the PVCs fit", func() {
+			running := finishedSosreport("a", "running", 0)
+			running.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+			sosreports := []supportv1alpha1.Sosreport{
+				running,
+				finishedSosreport("a", "new", time.Minute),
+				finishedSosreport("a", "older", 2*time.Hour),
+				finishedSosreport("b", "oldest", 3*time.Hour),
+			}
+			gi := resource.MustParse("1Gi")
+			pvcBytes := map[types.UID]int64{
+				"a/running": 2 * gi.Value(),
+				"a/new":     gi.Value(),
+				"a/older":   gi.Value(),
+				"b/oldest":  gi.Value(),
+			}
+			maxPVCBytes := resource.MustParse("3Gi")
+
+			expired := selectExpiredSosreports(sosreports, pvcBytes, RetentionPolicy{MaxPVCBytes: &maxPVCBytes}, now)
+			Expect(expired).To(HaveLen(2))
+			Expect(expired).To(HaveKey(types.UID("a/older")))
+			Expect(expired).To(HaveKey(types.UID("b/oldest")))
+		})
+	})
+
+	Context("When a Sosreport finishes", func() {
+		It("Should delete it once its ttlAfterFinished passed", func() {
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "retention-ttl",
+					Namespace: RETENTION_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					// no node carries this label, so the Sosreport fails right away
+					NodeSelector: map[string]string{
+						"sosreport-retention-test": "none",
+					},
+					TTLAfterFinished: &metav1.Duration{Duration: time.Second},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: RETENTION_NAMESPACE, Name: s.Name}
+
+			By("Waiting for the Sosreport to finish")
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return false
+				}
+				return s.Status.IsFinished()
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+			Expect(s.Status.CompletionTime).NotTo(BeNil())
+
+			By("Waiting for the garbage collector to delete it")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, namespacedName, &supportv1alpha1.Sosreport{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+		})
+
+		It("Should remove the Sosreport's owner reference from retained PVCs", func() {
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "retention-pvcs",
+					Namespace: RETENTION_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						"sosreport-retention-test": "none",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "retention-pvcs-pvc",
+					Namespace: RETENTION_NAMESPACE,
+					Labels:    map[string]string{"app": "sosreport", "sosreport-cr": s.Name},
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("1Gi"),
+						},
+					},
+				},
+			}
+			Expect(ctrl.SetControllerReference(s, pvc, scheme.Scheme)).Should(Succeed())
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+			Expect(getPVCBytesBySosreport([]corev1.PersistentVolumeClaim{*pvc})).To(HaveKeyWithValue(s.UID, int64(1<<30)))
+
+			pvcNames, err := sosreportpvc.Orphan(ctx, k8sClient, s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pvcNames).To(Equal([]string{pvc.Name}))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: RETENTION_NAMESPACE, Name: pvc.Name}, pvc)).Should(Succeed())
+			Expect(pvc.OwnerReferences).To(BeEmpty())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, pvc)).Should(Succeed())
+		})
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	ATTEMPT_ANNOTATION    = "attempt"        // annotation of a sosreport job with the attempt number of its node
+	DEFAULT_RETRY_BACKOFF = 30 * time.Second // time to wait before the second attempt if the retryPolicy does not say
+)
+
+/*
+Get the attempt number of a sosreport job. Jobs of older versions of this operator do not have one and are
+always the first attempt.
+*/
+func getJobAttempt(job batchv1.Job) int32 {
+	attempt, err := strconv.Atoi(job.Annotations[ATTEMPT_ANNOTATION])
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return int32(attempt)
+}
+
+/*
+Get the attempt number of the job that a node is currently waiting for. A running node waits for the job
+which was recorded last, all other nodes wait for the job of their next attempt.
+*/
+func getExpectedAttempt(nodeStatus *supportv1alpha1.SosreportNodeStatus) int32 {
+	if nodeStatus.State == supportv1alpha1.NodeStateRunning && nodeStatus.Attempts > 0 {
+		return nodeStatus.Attempts
+	}
+	return nodeStatus.Attempts + 1
+}
+
+/*
+Get the number of attempts that the Sosreport's retryPolicy allows per node
+*/
+func getMaxAttempts(s *supportv1alpha1.Sosreport) int32 {
+	if s.Spec.RetryPolicy == nil || s.Spec.RetryPolicy.MaxAttempts < 1 {
+		return 1
+	}
+	return s.Spec.RetryPolicy.MaxAttempts
+}
+
+/*
+Get the time to wait after a failed attempt. The backoff doubles with every attempt.
+*/
+func getRetryBackoff(s *supportv1alpha1.Sosreport, attempt int32) time.Duration {
+	backoff := DEFAULT_RETRY_BACKOFF
+	if s.Spec.RetryPolicy != nil && s.Spec.RetryPolicy.Backoff != nil {
+		backoff = s.Spec.RetryPolicy.Backoff.Duration
+	}
+	for i := int32(1); i < attempt; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+/*
+Put a failed or timed out node back into the run queue if its retryPolicy allows for another attempt.
+Returns false if the attempts are exhausted and the node stays failed.
+*/
+func scheduleSosreportRetry(s *supportv1alpha1.Sosreport, nodeStatus *supportv1alpha1.SosreportNodeStatus) bool {
+	if (nodeStatus.Outcome != supportv1alpha1.NodeOutcomeFailed && nodeStatus.Outcome != supportv1alpha1.NodeOutcomeTimedOut) ||
+		nodeStatus.Attempts >= getMaxAttempts(s) {
+		return false
+	}
+	nextAttemptTime := metav1.NewTime(time.Now().Add(getRetryBackoff(s, nodeStatus.Attempts)))
+	nodeStatus.State = supportv1alpha1.NodeStateOutstanding
+	nodeStatus.Outcome = ""
+	nodeStatus.Reason = fmt.Sprintf("Attempt %d of %d failed: %s", nodeStatus.Attempts, getMaxAttempts(s), nodeStatus.Reason)
+	nodeStatus.NextAttemptTime = &nextAttemptTime
+	return true
+}
+
+/*
+Determine if a node must wait before its next attempt
+*/
+func isWaitingForRetry(nodeStatus *supportv1alpha1.SosreportNodeStatus) bool {
+	return nodeStatus.NextAttemptTime != nil && time.Now().Before(nodeStatus.NextAttemptTime.Time)
+}
+
+/*
+Get the time until the next node or upload may be retried, or 0 if nothing waits for a retry
+*/
+func getNextRetryDelay(s *supportv1alpha1.Sosreport) time.Duration {
+	var delay time.Duration
+	var nextAttemptTimes []*metav1.Time
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		if nodeStatus.State != supportv1alpha1.NodeStateDone && isWaitingForRetry(nodeStatus) {
+			nextAttemptTimes = append(nextAttemptTimes, nodeStatus.NextAttemptTime)
+		}
+		for j := range nodeStatus.Uploads {
+			upload := &nodeStatus.Uploads[j]
+			if upload.Result == supportv1alpha1.UploadResultPending && isUploadWaitingForRetry(upload) {
+				nextAttemptTimes = append(nextAttemptTimes, upload.NextAttemptTime)
+			}
+		}
+	}
+	for _, nextAttemptTime := range nextAttemptTimes {
+		d := time.Until(nextAttemptTime.Time)
+		if delay == 0 || d < delay {
+			delay = d
+		}
+	}
+	return delay
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+/*
+A sosreport is pending as long as the controller did not select any nodes for it
+*/
+func isSosreportPending(s *supportv1alpha1.Sosreport) bool {
+	return s.Status.Phase == "" || s.Status.Phase == supportv1alpha1.SosreportPhasePending
+}
+
+/*
+Set or update a condition in the Sosreport's status
+*/
+func setSosreportCondition(s *supportv1alpha1.Sosreport, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: s.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+/*
+Determine the final phase and conditions of a Sosreport once all of its jobs and uploads are done.
+The outcome of each node is taken from its per-node record. If uploads are configured, a node whose archive was not
+uploaded to all of its targets counts as failed.
+*/
+func (r *SosreportReconciler) setSosreportFinishedStatus(s *supportv1alpha1.Sosreport, req ctrl.Request) {
+	succeeded := 0
+	failed := 0
+	uploaded := 0
+	for _, nodeStatus := range s.Status.Nodes {
+		if nodeStatus.State != supportv1alpha1.NodeStateDone {
+			continue
+		}
+		if nodeStatus.Outcome == supportv1alpha1.NodeOutcomeSucceeded {
+			succeeded++
+		} else {
+			failed++
+		}
+		if isNodeUploaded(s, &nodeStatus) {
+			uploaded++
+		}
+	}
+	total := succeeded + failed
+
+	switch {
+	case failed == 0:
+		setSosreportCondition(s, supportv1alpha1.ConditionCollected, metav1.ConditionTrue,
+			"AllNodesCollected", fmt.Sprintf("Collected sosreports from %d node(s)", total))
+	case succeeded == 0:
+		setSosreportCondition(s, supportv1alpha1.ConditionCollected, metav1.ConditionFalse,
+			"AllNodesFailed", fmt.Sprintf("Sosreport jobs failed on all %d node(s)", total))
+	default:
+		setSosreportCondition(s, supportv1alpha1.ConditionCollected, metav1.ConditionFalse,
+			"SomeNodesFailed", fmt.Sprintf("Sosreport jobs failed on %d of %d node(s)", failed, total))
+	}
+	if s.Spec.Cancel {
+		setSosreportCondition(s, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse,
+			"Cancelled", "The Sosreport was cancelled")
+	} else {
+		setSosreportCondition(s, supportv1alpha1.ConditionJobsRunning, metav1.ConditionFalse,
+			"JobsFinished", "All sosreport jobs finished")
+	}
+
+	// the archive of a failed node is never uploaded
+	completed := succeeded
+	uploadMethod := getUploadMethods(s)
+	switch {
+	case !isUploadConfigured(s):
+		setSosreportCondition(s, supportv1alpha1.ConditionUploaded, metav1.ConditionFalse,
+			"UploadNotConfigured", "No upload-method is configured")
+	case uploaded == total:
+		completed = uploaded
+		setSosreportCondition(s, supportv1alpha1.ConditionUploaded, metav1.ConditionTrue,
+			"UploadsCompleted", fmt.Sprintf("Uploaded sosreports from %d node(s) via %s", total, uploadMethod))
+	default:
+		completed = uploaded
+		setSosreportCondition(s, supportv1alpha1.ConditionUploaded, metav1.ConditionFalse,
+			"UploadsFailed", fmt.Sprintf("Uploads via %s failed or did not happen on %d of %d node(s)", uploadMethod, total-uploaded, total))
+	}
+
+	switch {
+	case completed == total:
+		s.Status.Phase = supportv1alpha1.SosreportPhaseSucceeded
+	case completed == 0:
+		s.Status.Phase = supportv1alpha1.SosreportPhaseFailed
+	default:
+		s.Status.Phase = supportv1alpha1.SosreportPhasePartiallyFailed
+	}
+}
+
+/*
+Return the upload method of the Sosreport's effective configuration, or "" if none is configured
+*/
+func getUploadMethod(s *supportv1alpha1.Sosreport) string {
+	if s.Status.EffectiveConfiguration == nil {
+		return ""
+	}
+	return s.Status.EffectiveConfiguration.Environment["UPLOAD_METHOD"]
+}
+
+/*
+Return the per-node record of nodeName. A new record is appended to the status if none exists, yet.
+*/
+func getSosreportNodeStatus(s *supportv1alpha1.Sosreport, nodeName string) *supportv1alpha1.SosreportNodeStatus {
+	for i := range s.Status.Nodes {
+		if s.Status.Nodes[i].NodeName == nodeName {
+			return &s.Status.Nodes[i]
+		}
+	}
+	s.Status.Nodes = append(s.Status.Nodes, supportv1alpha1.SosreportNodeStatus{NodeName: nodeName})
+	return &s.Status.Nodes[len(s.Status.Nodes)-1]
+}
+
+/*
+Record a newly created sosreport job in the per-node status
+*/
+func recordSosreportJobStarted(s *supportv1alpha1.Sosreport, job *batchv1.Job) {
+	nodeStatus := getSosreportNodeStatus(s, job.Annotations["nodeName"])
+	// jobs which are read back from the API know when they were created
+	startTime := metav1.Now()
+	if !job.CreationTimestamp.IsZero() {
+		startTime = job.CreationTimestamp
+	}
+	nodeStatus.State = supportv1alpha1.NodeStateRunning
+	nodeStatus.Attempts = getJobAttempt(*job)
+	nodeStatus.NextAttemptTime = nil
+	nodeStatus.JobName = job.Name
+	nodeStatus.PVCName = job.Annotations["pvcName"]
+	nodeStatus.StartTime = &startTime
+	nodeStatus.CompletionTime = nil
+	nodeStatus.Outcome = ""
+	nodeStatus.Reason = ""
+	nodeStatus.Archive = ""
+	nodeStatus.ArchiveURL = ""
+	nodeStatus.Upload = nil
+	nodeStatus.Uploads = nil
+}
+
+/*
+Record the result of a finished sosreport job in the per-node status.
+The outcome and exit reason are taken from the job's conditions and from its pod's container state.
+The archive name is reported by the entrypoint via the container's termination message. Jobs of older versions of
+this operator uploaded the archive themselves and report the upload result, too.
+*/
+func (r *SosreportReconciler) recordSosreportJobResult(s *supportv1alpha1.Sosreport, job batchv1.Job) {
+	nodeStatus := getSosreportNodeStatus(s, job.Annotations["nodeName"])
+	nodeStatus.State = supportv1alpha1.NodeStateDone
+	nodeStatus.JobName = job.Name
+	if pvcName, ok := job.Annotations["pvcName"]; ok {
+		nodeStatus.PVCName = pvcName
+	}
+	nodeStatus.Attempts = getJobAttempt(job)
+	nodeStatus.Reason = ""
+
+	completionTime := metav1.Now()
+	if job.Status.CompletionTime != nil {
+		completionTime = *job.Status.CompletionTime
+	}
+	nodeStatus.Outcome = supportv1alpha1.NodeOutcomeSucceeded
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			nodeStatus.Outcome = supportv1alpha1.NodeOutcomeFailed
+			// the job ran for longer than its activeDeadlineSeconds
+			if c.Reason == DEADLINE_EXCEEDED {
+				nodeStatus.Outcome = supportv1alpha1.NodeOutcomeTimedOut
+			}
+			nodeStatus.Reason = c.Reason
+			if job.Status.CompletionTime == nil && !c.LastTransitionTime.IsZero() {
+				completionTime = c.LastTransitionTime
+			}
+		}
+	}
+	nodeStatus.CompletionTime = &completionTime
+
+	pod, err := r.getSosreportJobPod(job)
+	if err != nil || pod == nil {
+		log.V(DEBUG).Info("Could not find the pod of sosreport job", "Job.Name", job.Name, "err", err)
+		return
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		terminated := cs.State.Terminated
+		if terminated == nil {
+			continue
+		}
+		if nodeStatus.Reason == "" || terminated.ExitCode != 0 {
+			nodeStatus.Reason = fmt.Sprintf("%s (exit code %d)", terminated.Reason, terminated.ExitCode)
+		}
+		terminationMessage := parseTerminationMessage(terminated.Message)
+		nodeStatus.Archive = terminationMessage["archive"]
+		// archives on the shared PVC are stored in a directory per job
+		if archiveDir, ok := job.Annotations[ARCHIVE_DIR_ANNOTATION]; ok && nodeStatus.Archive != "" {
+			nodeStatus.Archive = archiveDir + "/" + nodeStatus.Archive
+		}
+		if nodeStatus.Archive != "" && r.ArtifactServerURL != "" {
+			nodeStatus.ArchiveURL = getArchiveURL(r.ArtifactServerURL, s, nodeStatus.NodeName)
+		}
+		if method, ok := terminationMessage["upload-method"]; ok {
+			nodeStatus.Upload = &supportv1alpha1.SosreportUploadStatus{
+				Method:   method,
+				Result:   terminationMessage["upload-result"],
+				Message:  terminationMessage["upload-message"],
+				Location: terminationMessage["upload-location"],
+			}
+		}
+	}
+}
+
+/*
+Get the most recent pod of a sosreport job. Returns nil if the job has no pods (anymore).
+Pods are read from the API server, as listing them with the cached client would start an informer for all pods in the
+cluster.
+*/
+func (r *SosreportReconciler) getSosreportJobPod(job batchv1.Job) (*corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name},
+	}
+	if err := r.APIReader.List(ctx, podList, listOpts...); err != nil {
+		return nil, err
+	}
+	var pod *corev1.Pod
+	for i := range podList.Items {
+		if pod == nil || pod.CreationTimestamp.Before(&podList.Items[i].CreationTimestamp) {
+			pod = &podList.Items[i]
+		}
+	}
+	return pod, nil
+}
+
+/*
+Parse the termination message which is written by the sosreport entrypoint.
+The message consists of key=value lines, e.g.:
+archive=sosreport-worker-0-2021-03-05-xmcqjwu.tar.xz
+Entrypoints of older versions of this operator add the upload result:
+upload-method=s3
+upload-result=Succeeded
+upload-location=s3://sosreports/cluster-a/sosreport-worker-0-2021-03-05-xmcqjwu.tar.xz
+*/
+func parseTerminationMessage(message string) map[string]string {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result
+}
+
+/*
+Finish all nodes of a cancelled Sosreport which are not done, yet. Their running jobs are deleted.
+*/
+func (r *SosreportReconciler) cancelSosreportJobs(s *supportv1alpha1.Sosreport) error {
+	cancelled := 0
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		if nodeStatus.State == supportv1alpha1.NodeStateDone {
+			continue
+		}
+		if nodeStatus.State == supportv1alpha1.NodeStateRunning {
+			if err := r.deleteSosreportJob(s.Namespace, nodeStatus.JobName, "Sosreport was cancelled"); err != nil {
+				return err
+			}
+		}
+		completionTime := metav1.Now()
+		nodeStatus.State = supportv1alpha1.NodeStateDone
+		nodeStatus.Outcome = supportv1alpha1.NodeOutcomeCancelled
+		nodeStatus.Reason = "The Sosreport was cancelled"
+		nodeStatus.CompletionTime = &completionTime
+		nodeStatus.NextAttemptTime = nil
+		cancelled++
+	}
+	if cancelled > 0 {
+		r.recorder.Event(s, corev1.EventTypeWarning, "Sosreport cancelled",
+			fmt.Sprintf("Cancelled the sosreport jobs of %d node(s)", cancelled))
+	}
+	return nil
+}
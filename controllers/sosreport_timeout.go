@@ -0,0 +1,124 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	DEFAULT_PENDING_TIMEOUT = 10 * time.Minute   // how long the pod of a sosreport job may be Pending by default
+	DEFAULT_UPLOAD_TIMEOUT  = time.Hour          // how long an upload job may run by default
+	PENDING_CHECK_PERIOD    = time.Minute        // how often running Sosreports look for stuck jobs
+	DEADLINE_EXCEEDED       = "DeadlineExceeded" // reason of the JobFailed condition if activeDeadlineSeconds passed
+)
+
+/*
+Get the activeDeadlineSeconds of a sosreport job from the Sosreport's timeout, or nil if there is none
+*/
+func getActiveDeadlineSeconds(s *supportv1alpha1.Sosreport) *int64 {
+	if s.Spec.Timeout == nil || s.Spec.Timeout.Duration <= 0 {
+		return nil
+	}
+	activeDeadlineSeconds := int64(s.Spec.Timeout.Duration.Seconds())
+	if activeDeadlineSeconds < 1 {
+		activeDeadlineSeconds = 1
+	}
+	return &activeDeadlineSeconds
+}
+
+/*
+Get the activeDeadlineSeconds of an upload job from the Sosreport's uploadTimeout
+*/
+func getUploadActiveDeadlineSeconds(s *supportv1alpha1.Sosreport) *int64 {
+	uploadTimeout := DEFAULT_UPLOAD_TIMEOUT
+	if s.Spec.UploadTimeout != nil && s.Spec.UploadTimeout.Duration > 0 {
+		uploadTimeout = s.Spec.UploadTimeout.Duration
+	}
+	activeDeadlineSeconds := int64(uploadTimeout.Seconds())
+	if activeDeadlineSeconds < 1 {
+		activeDeadlineSeconds = 1
+	}
+	return &activeDeadlineSeconds
+}
+
+/*
+Get how long the pod of a sosreport job may be Pending
+*/
+func getPendingTimeout(s *supportv1alpha1.Sosreport) time.Duration {
+	if s.Spec.PendingTimeout == nil || s.Spec.PendingTimeout.Duration <= 0 {
+		return DEFAULT_PENDING_TIMEOUT
+	}
+	return s.Spec.PendingTimeout.Duration
+}
+
+/*
+Determine if the pod of a running sosreport job is stuck in phase Pending for longer than the Sosreport's
+pendingTimeout. Returns a message which explains why, or "" if the job is not stuck.
+*/
+func (r *SosreportReconciler) getStuckSosreportJobMessage(s *supportv1alpha1.Sosreport, job batchv1.Job) string {
+	pod, err := r.getSosreportJobPod(job)
+	if err != nil || pod == nil {
+		return ""
+	}
+	if pod.Status.Phase != corev1.PodPending {
+		return ""
+	}
+	pendingTimeout := getPendingTimeout(s)
+	if time.Since(pod.CreationTimestamp.Time) < pendingTimeout {
+		return ""
+	}
+	message := fmt.Sprintf("Pod %s was Pending for more than %s", pod.Name, pendingTimeout)
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			message = fmt.Sprintf("%s: %s %s", message, c.Reason, c.Message)
+		}
+	}
+	return message
+}
+
+/*
+Give up on a stuck sosreport job: delete it so that it no longer takes up a concurrency slot and record the node
+as TimedOut
+*/
+func (r *SosreportReconciler) timeOutSosreportJob(s *supportv1alpha1.Sosreport, job batchv1.Job, message string) error {
+	log.V(INFO).Info("Deleting stuck sosreport job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "message", message)
+	if err := r.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil &&
+		!apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete stuck sosreport job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return err
+	}
+
+	nodeStatus := getSosreportNodeStatus(s, job.Annotations["nodeName"])
+	completionTime := metav1.Now()
+	nodeStatus.State = supportv1alpha1.NodeStateDone
+	nodeStatus.JobName = job.Name
+	nodeStatus.Attempts = getJobAttempt(job)
+	nodeStatus.Outcome = supportv1alpha1.NodeOutcomeTimedOut
+	nodeStatus.Reason = message
+	nodeStatus.CompletionTime = &completionTime
+	return nil
+}
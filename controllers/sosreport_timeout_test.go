@@ -0,0 +1,128 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport timeouts", func() {
+
+	const (
+		TIMEOUT_NAMESPACE = "default"
+		NODE_LABEL        = "sosreport-timeout-test"
+		TIMEOUT           = time.Second * 10
+		INTERVAL          = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	Context("When the pod of a sosreport job stays Pending", func() {
+		It("Should delete the job and record the node as TimedOut", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "pending-0",
+					Labels: map[string]string{
+						NODE_LABEL:     "",
+						HOSTNAME_LABEL: "pending-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pending",
+					Namespace: TIMEOUT_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+					PendingTimeout: &metav1.Duration{Duration: time.Second},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: TIMEOUT_NAMESPACE, Name: s.Name}
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"pending-0"}))
+			jobName := s.Status.Nodes[0].JobName
+
+			By("Creating a pod of the job which cannot be scheduled")
+			// envtest runs no job controller, so the job's pod is created by hand. New pods are Pending.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      jobName + "-abcde",
+					Namespace: TIMEOUT_NAMESPACE,
+					Labels:    map[string]string{"job-name": jobName},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: "sosreport", Image: "sosreport"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			pod.Status.Phase = corev1.PodPending
+			pod.Status.Conditions = []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  corev1.PodReasonUnschedulable,
+				Message: "0/1 nodes are available",
+			}}
+			Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+			By("Waiting for the pending timeout to pass")
+			Eventually(func() supportv1alpha1.SosreportNodeOutcome {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Nodes[0].Outcome
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.NodeOutcomeTimedOut))
+			Expect(s.Status.Nodes[0].State).To(Equal(supportv1alpha1.NodeStateDone))
+			Expect(s.Status.Nodes[0].Reason).To(ContainSubstring(corev1.PodReasonUnschedulable))
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: TIMEOUT_NAMESPACE, Name: jobName}, &batchv1.Job{})
+				return apierrors.IsNotFound(err)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+
+			// envtest runs no garbage collector, which would delete the pod of the deleted job
+			Expect(k8sClient.Delete(ctx, pod)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+		})
+	})
+})
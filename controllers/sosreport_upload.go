@@ -0,0 +1,671 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	UPLOADER_COMMAND     = "/usr/local/bin/sosreport-uploader" // binary of the sosreport image which uploads an archive
+	UPLOAD_CONTAINER     = "uploader"                          // name of the container of upload jobs
+	UPLOAD_ARCHIVE_DIR   = "/pv"                               // mount path of the archive's PVC in upload jobs
+	MAX_UPLOAD_NAME_BASE = 63 - len("-upload-") - 8 - 4        // the node hash has 8 characters, the attempt up to 3
+
+	DEFAULT_UPLOAD_TARGET    = "default"      // target of the upload method of the configuration
+	UPLOAD_TARGET_ANNOTATION = "uploadTarget" // annotation of upload jobs with the name of their target
+)
+
+// uploadTarget is a destination which the archives of a Sosreport are uploaded to
+type uploadTarget struct {
+	name   string
+	method string
+	// upload holds the settings of a target of the Sosreport's spec. It is nil for the upload method of the
+	// configuration, whose settings are part of the effective configuration.
+	upload *supportv1alpha1.SosreportConfigUpload
+}
+
+// uploadJobKey identifies the upload job of a node's attempt to upload to a target
+type uploadJobKey struct {
+	nodeName string
+	target   string
+	attempt  int32
+}
+
+// uploadResult is the termination message of an upload job, see cmd/sosreport-uploader
+type uploadResult struct {
+	Method    string `json:"method"`
+	Result    string `json:"result"`
+	Message   string `json:"message,omitempty"`
+	Location  string `json:"location,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+/*
+Return the labels of upload jobs. They differ from the labels of sosreport jobs, so that upload jobs are neither
+mistaken for a node's job nor counted against the concurrency limits.
+*/
+func labelsForSosreportUpload(name string) map[string]string {
+	return map[string]string{"app": "sosreport-upload", "sosreport-cr": name}
+}
+
+/*
+Return the targets which the archives of a Sosreport are uploaded to. The upload targets of the spec replace the
+upload method of the effective configuration.
+*/
+func getUploadTargets(s *supportv1alpha1.Sosreport) []uploadTarget {
+	var targets []uploadTarget
+	if len(s.Spec.UploadTargets) > 0 {
+		for i := range s.Spec.UploadTargets {
+			target := &s.Spec.UploadTargets[i]
+			targets = append(targets, uploadTarget{
+				name:   target.Name,
+				method: target.Method,
+				upload: &target.SosreportConfigUpload,
+			})
+		}
+		return targets
+	}
+	uploadMethod := getUploadMethod(s)
+	if uploadMethod != "" && uploadMethod != "none" {
+		targets = append(targets, uploadTarget{name: DEFAULT_UPLOAD_TARGET, method: uploadMethod})
+	}
+	return targets
+}
+
+/*
+Return the upload methods of a Sosreport's targets, e.g. "case, nfs"
+*/
+func getUploadMethods(s *supportv1alpha1.Sosreport) string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, target := range getUploadTargets(s) {
+		if !seen[target.method] {
+			seen[target.method] = true
+			methods = append(methods, target.method)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+/*
+Determine if the archives of the Sosreport are uploaded anywhere
+*/
+func isUploadConfigured(s *supportv1alpha1.Sosreport) bool {
+	return len(getUploadTargets(s)) > 0
+}
+
+/*
+Return the node's upload to target, or nil if there is none
+*/
+func getNodeUpload(nodeStatus *supportv1alpha1.SosreportNodeStatus, target string) *supportv1alpha1.SosreportUploadStatus {
+	for i := range nodeStatus.Uploads {
+		if nodeStatus.Uploads[i].Target == target {
+			return &nodeStatus.Uploads[i]
+		}
+	}
+	return nil
+}
+
+/*
+Determine if the archive of a node reached all upload targets. Sosreport jobs of older versions of this operator
+uploaded the archive themselves.
+*/
+func isNodeUploaded(s *supportv1alpha1.Sosreport, nodeStatus *supportv1alpha1.SosreportNodeStatus) bool {
+	if nodeStatus.Upload != nil {
+		return nodeStatus.Upload.Result == supportv1alpha1.UploadResultSucceeded
+	}
+	targets := getUploadTargets(s)
+	if len(targets) == 0 {
+		return false
+	}
+	for _, target := range targets {
+		upload := getNodeUpload(nodeStatus, target.name)
+		if upload == nil || upload.Result != supportv1alpha1.UploadResultSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Describe an upload in events and messages, e.g. "worker-0" or "worker-0 to archive" for a target of the spec
+*/
+func describeUpload(nodeName string, upload *supportv1alpha1.SosreportUploadStatus) string {
+	if upload.Target == "" || upload.Target == DEFAULT_UPLOAD_TARGET {
+		return nodeName
+	}
+	return nodeName + " to " + upload.Target
+}
+
+/*
+Determine if no upload of the Sosreport is waiting to be started or running
+*/
+func isSosreportUploadsDone(s *supportv1alpha1.Sosreport) bool {
+	for _, nodeStatus := range s.Status.Nodes {
+		for _, upload := range nodeStatus.Uploads {
+			if upload.Result == supportv1alpha1.UploadResultPending || upload.Result == supportv1alpha1.UploadResultRunning {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+Determine if a failed upload must wait before its next attempt
+*/
+func isUploadWaitingForRetry(upload *supportv1alpha1.SosreportUploadStatus) bool {
+	return upload.NextAttemptTime != nil && time.Now().Before(upload.NextAttemptTime.Time)
+}
+
+/*
+Get the upload jobs which belong to a Sosreport
+*/
+func (r *SosreportReconciler) getSosreportUploadJobs(s *supportv1alpha1.Sosreport) (*batchv1.JobList, error) {
+	allUploadJobs := &batchv1.JobList{}
+	uploadJobs := &batchv1.JobList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(s.Namespace),
+		client.MatchingLabels(labelsForSosreportUpload(s.Name)),
+	}
+	if err := r.List(ctx, allUploadJobs, listOpts...); err != nil {
+		log.Error(err, "unable to list upload Jobs for sosreport")
+		return nil, err
+	}
+	for _, uploadJob := range allUploadJobs.Items {
+		if isOwnedBySosreport(uploadJob.ObjectMeta, s) {
+			uploadJobs.Items = append(uploadJobs.Items, uploadJob)
+		}
+	}
+	return uploadJobs, nil
+}
+
+/*
+Index upload jobs by node, target and attempt. Jobs without a target annotation upload to the default target.
+*/
+func uploadJobsByKey(uploadJobs *batchv1.JobList) map[uploadJobKey]batchv1.Job {
+	jobsByKey := make(map[uploadJobKey]batchv1.Job)
+	for _, uploadJob := range uploadJobs.Items {
+		target, ok := uploadJob.Annotations[UPLOAD_TARGET_ANNOTATION]
+		if !ok {
+			target = DEFAULT_UPLOAD_TARGET
+		}
+		key := uploadJobKey{uploadJob.Annotations["nodeName"], target, getJobAttempt(uploadJob)}
+		if j, ok := jobsByKey[key]; ok && uploadJob.CreationTimestamp.Before(&j.CreationTimestamp) {
+			continue
+		}
+		jobsByKey[key] = uploadJob
+	}
+	return jobsByKey
+}
+
+/*
+Derive the state of every upload from the upload jobs of this Sosreport. Nodes whose archive was collected get a
+pending upload per upload target. The result of a finished upload job is recorded and a failed upload is retried if
+the retryPolicy allows for another attempt.
+*/
+func (r *SosreportReconciler) synchronizeSosreportUploads(s *supportv1alpha1.Sosreport) error {
+	uploadJobs, err := r.getSosreportUploadJobs(s)
+	if err != nil {
+		return err
+	}
+	jobsByKey := uploadJobsByKey(uploadJobs)
+	targets := getUploadTargets(s)
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		// sosreport jobs of older versions of this operator uploaded the archive themselves
+		if nodeStatus.Upload == nil && nodeStatus.State == supportv1alpha1.NodeStateDone &&
+			nodeStatus.Outcome == supportv1alpha1.NodeOutcomeSucceeded && nodeStatus.Archive != "" {
+			for _, target := range targets {
+				if getNodeUpload(nodeStatus, target.name) == nil {
+					nodeStatus.Uploads = append(nodeStatus.Uploads, supportv1alpha1.SosreportUploadStatus{
+						Target: target.name,
+						Method: target.method,
+						Result: supportv1alpha1.UploadResultPending,
+					})
+				}
+			}
+		}
+
+		for j := range nodeStatus.Uploads {
+			upload := &nodeStatus.Uploads[j]
+			var attempt int32
+			switch upload.Result {
+			case supportv1alpha1.UploadResultRunning:
+				attempt = upload.Attempts
+			case supportv1alpha1.UploadResultPending:
+				attempt = upload.Attempts + 1
+			default:
+				continue
+			}
+			uploadJob, ok := jobsByKey[uploadJobKey{nodeStatus.NodeName, upload.Target, attempt}]
+			if !ok {
+				continue
+			}
+			if done, _ := isJobDone(uploadJob); !done {
+				// the status update which recorded the job's creation was lost
+				if upload.Result == supportv1alpha1.UploadResultPending {
+					recordUploadJobStarted(upload, &uploadJob)
+				}
+				continue
+			}
+
+			retryable := r.recordUploadJobResult(upload, uploadJob)
+			description := describeUpload(nodeStatus.NodeName, upload)
+			if scheduleUploadRetry(s, upload, retryable) {
+				r.recorder.Event(s, corev1.EventTypeWarning, "Upload retry scheduled",
+					"Upload of "+description+" failed, retrying at "+upload.NextAttemptTime.Format(time.RFC3339))
+			} else if upload.Result == supportv1alpha1.UploadResultSucceeded {
+				r.recorder.Event(s, corev1.EventTypeNormal, "Upload finished", "Uploaded the sosreport of "+description)
+			} else {
+				r.recorder.Event(s, corev1.EventTypeWarning, "Upload failed",
+					"Upload of "+description+" failed: "+upload.Message)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Record a newly created upload job in the node's upload status
+*/
+func recordUploadJobStarted(upload *supportv1alpha1.SosreportUploadStatus, job *batchv1.Job) {
+	startTime := metav1.Now()
+	if !job.CreationTimestamp.IsZero() {
+		startTime = job.CreationTimestamp
+	}
+	upload.Result = supportv1alpha1.UploadResultRunning
+	upload.Attempts = getJobAttempt(*job)
+	upload.JobName = job.Name
+	upload.Message = ""
+	upload.StartTime = &startTime
+	upload.CompletionTime = nil
+	upload.NextAttemptTime = nil
+}
+
+/*
+Record the result of a finished upload job in the node's upload status. The result is reported by the uploader via
+the container's termination message. Returns false if another attempt cannot succeed either.
+*/
+func (r *SosreportReconciler) recordUploadJobResult(upload *supportv1alpha1.SosreportUploadStatus, job batchv1.Job) bool {
+	completionTime := metav1.Now()
+	if job.Status.CompletionTime != nil {
+		completionTime = *job.Status.CompletionTime
+	}
+	upload.CompletionTime = &completionTime
+	upload.Result = supportv1alpha1.UploadResultSucceeded
+	upload.Message = ""
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			upload.Result = supportv1alpha1.UploadResultFailed
+			upload.Message = fmt.Sprintf("Upload job failed: %s", c.Reason)
+			// the uploader was killed or never started, another attempt may be faster
+			if c.Reason == DEADLINE_EXCEEDED {
+				upload.Message = "Upload job exceeded its uploadTimeout"
+				return true
+			}
+		}
+	}
+
+	pod, err := r.getSosreportJobPod(job)
+	if err != nil || pod == nil {
+		log.V(DEBUG).Info("Could not find the pod of upload job", "Job.Name", job.Name, "err", err)
+		return true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Terminated == nil {
+			continue
+		}
+		result, ok := parseUploadResult(cs.State.Terminated.Message)
+		if !ok {
+			continue
+		}
+		if result.Result == supportv1alpha1.UploadResultSucceeded || result.Result == supportv1alpha1.UploadResultFailed {
+			upload.Result = result.Result
+		}
+		upload.Message = result.Message
+		upload.Location = result.Location
+		upload.Size = result.Size
+		return result.Retryable
+	}
+	return true
+}
+
+/*
+Parse the JSON termination message of the uploader. Returns false if the message is not an upload result.
+*/
+func parseUploadResult(message string) (uploadResult, bool) {
+	result := uploadResult{}
+	if err := json.Unmarshal([]byte(message), &result); err != nil || result.Result == "" {
+		return uploadResult{}, false
+	}
+	return result, true
+}
+
+/*
+Make a failed upload pending again if its retryPolicy allows for another attempt and if another attempt can succeed.
+Returns false if the upload stays failed.
+*/
+func scheduleUploadRetry(s *supportv1alpha1.Sosreport, upload *supportv1alpha1.SosreportUploadStatus, retryable bool) bool {
+	if upload.Result != supportv1alpha1.UploadResultFailed || !retryable || upload.Attempts >= getMaxAttempts(s) {
+		return false
+	}
+	nextAttemptTime := metav1.NewTime(time.Now().Add(getRetryBackoff(s, upload.Attempts)))
+	upload.Result = supportv1alpha1.UploadResultPending
+	upload.Message = fmt.Sprintf("Attempt %d of %d failed: %s", upload.Attempts, getMaxAttempts(s), upload.Message)
+	upload.NextAttemptTime = &nextAttemptTime
+	return true
+}
+
+/*
+Check if the upload jobs of several nodes or targets can mount a PVC at the same time. Only the shared PVC of the
+Shared storage mode may have an access mode which allows it, the PVCs of the PerNode storage mode are ReadWriteOnce.
+*/
+func isPVCShareable(s *supportv1alpha1.Sosreport, pvcName string) bool {
+	if getStorageMode(s) != supportv1alpha1.StorageModeShared || pvcName != getSharedPVCName(s) {
+		return false
+	}
+	accessMode := s.Spec.Storage.AccessMode
+	return accessMode == "" || accessMode == corev1.ReadWriteMany || accessMode == corev1.ReadOnlyMany
+}
+
+/*
+Start upload jobs for all pending uploads which do not wait for their backoff. In the Shared storage mode, uploads
+start once the collector was stopped, as the shared PVC may not be mountable by more than one pod. For the same
+reason, only one upload job at a time mounts a PVC which is not shareable, and the targets of a node are uploaded to
+one after another.
+*/
+func (r *SosreportReconciler) runSosreportUploads(s *supportv1alpha1.Sosreport, conf *sosreportConfiguration, req ctrl.Request) error {
+	if getStorageMode(s) == supportv1alpha1.StorageModeShared && !r.isSosreportJobsDone(s) {
+		return nil
+	}
+
+	targets := make(map[string]uploadTarget)
+	for _, target := range getUploadTargets(s) {
+		targets[target.name] = target
+	}
+	// PVCs which are mounted by a running upload job
+	busyPVCs := make(map[string]bool)
+	for _, nodeStatus := range s.Status.Nodes {
+		for _, upload := range nodeStatus.Uploads {
+			if upload.Result == supportv1alpha1.UploadResultRunning {
+				busyPVCs[nodeStatus.PVCName] = true
+			}
+		}
+	}
+	configurationMaps := make(map[string]map[string]string)
+	for i := range s.Status.Nodes {
+		nodeStatus := &s.Status.Nodes[i]
+		for j := range nodeStatus.Uploads {
+			upload := &nodeStatus.Uploads[j]
+			if upload.Result != supportv1alpha1.UploadResultPending || isUploadWaitingForRetry(upload) {
+				continue
+			}
+			if busyPVCs[nodeStatus.PVCName] && !isPVCShareable(s, nodeStatus.PVCName) {
+				log.V(DEBUG).Info("Waiting for the upload job which mounts the PVC", "nodeName", nodeStatus.NodeName,
+					"target", upload.Target, "pvcName", nodeStatus.PVCName)
+				continue
+			}
+			target, ok := targets[upload.Target]
+			if !ok {
+				log.V(DEBUG).Info("Upload target does not exist", "nodeName", nodeStatus.NodeName, "target", upload.Target)
+				continue
+			}
+
+			// the upload credentials are only read if there is something to upload
+			configurationMap, ok := configurationMaps[target.name]
+			if !ok {
+				configurationMap = r.getUploadTargetConfiguration(s, target, conf, req)
+				configurationMaps[target.name] = configurationMap
+			}
+
+			job, err := r.uploadJobForSosreport(s, nodeStatus, upload, upload.Attempts+1, configurationMap, conf)
+			if err != nil {
+				log.Error(err, "Could not generate upload job", "nodeName", nodeStatus.NodeName, "target", upload.Target)
+				continue
+			}
+			log.V(INFO).Info("Creating new upload job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			err = r.Create(ctx, job)
+			if apierrors.IsAlreadyExists(err) {
+				log.V(DEBUG).Info("Upload job already exists", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			} else if err != nil {
+				log.Error(err, "Failed to create new upload job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				continue
+			} else {
+				r.recorder.Event(s, corev1.EventTypeNormal, "Upload job started",
+					"Uploading the sosreport of "+describeUpload(nodeStatus.NodeName, upload)+" via "+upload.Method)
+			}
+			recordUploadJobStarted(upload, job)
+			busyPVCs[nodeStatus.PVCName] = true
+		}
+	}
+	return nil
+}
+
+/*
+Return the environment of the upload jobs of a target. The settings of a target of the spec replace the upload
+settings of the effective configuration, and its credentials are read from its own Secret.
+*/
+func (r *SosreportReconciler) getUploadTargetConfiguration(s *supportv1alpha1.Sosreport, target uploadTarget, conf *sosreportConfiguration, req ctrl.Request) map[string]string {
+	configurationMap := make(map[string]string)
+	for k, v := range conf.environment {
+		configurationMap[k] = v
+	}
+	uploadSecret := conf.uploadSecret
+	if target.upload != nil {
+		for _, k := range uploadEnvironmentKeys {
+			delete(configurationMap, k)
+		}
+		for k, v := range getUploadEnvironment(*target.upload) {
+			configurationMap[k] = v
+		}
+		uploadSecret = target.upload.SecretName
+	}
+	if uploadSecret == "" {
+		uploadSecret = UPLOAD_SECRET_NAME
+	}
+	for k, v := range r.getEnvConfigurationFromSecret(uploadSecret, s, req) {
+		configurationMap[k] = v
+	}
+	return configurationMap
+}
+
+/*
+Skip all uploads of a cancelled Sosreport which are not done, yet. Their running upload jobs are deleted.
+*/
+func (r *SosreportReconciler) cancelSosreportUploads(s *supportv1alpha1.Sosreport) error {
+	for i := range s.Status.Nodes {
+		for j := range s.Status.Nodes[i].Uploads {
+			upload := &s.Status.Nodes[i].Uploads[j]
+			if upload.Result != supportv1alpha1.UploadResultPending && upload.Result != supportv1alpha1.UploadResultRunning {
+				continue
+			}
+			if upload.Result == supportv1alpha1.UploadResultRunning {
+				if err := r.deleteSosreportJob(s.Namespace, upload.JobName, "Sosreport was cancelled"); err != nil {
+					return err
+				}
+			}
+			completionTime := metav1.Now()
+			upload.Result = supportv1alpha1.UploadResultSkipped
+			upload.Message = "The Sosreport was cancelled"
+			upload.CompletionTime = &completionTime
+			upload.NextAttemptTime = nil
+		}
+	}
+	return nil
+}
+
+/*
+Retry the failed uploads of a Sosreport on request of its RetryUploadsAnnotation. A finished Sosreport is running
+again until the retried uploads are done. The annotation is removed afterwards.
+*/
+func (r *SosreportReconciler) retrySosreportUploads(s *supportv1alpha1.Sosreport, req ctrl.Request) error {
+	retried := 0
+	for i := range s.Status.Nodes {
+		for j := range s.Status.Nodes[i].Uploads {
+			upload := &s.Status.Nodes[i].Uploads[j]
+			if upload.Result != supportv1alpha1.UploadResultFailed {
+				continue
+			}
+			upload.Result = supportv1alpha1.UploadResultPending
+			upload.Message = "Retry requested"
+			upload.CompletionTime = nil
+			upload.NextAttemptTime = nil
+			retried++
+		}
+	}
+	if retried > 0 {
+		log.V(INFO).Info("Retrying failed uploads", "count", retried)
+		s.Status.Phase = supportv1alpha1.SosreportPhaseRunning
+		s.Status.CompletionTime = nil
+		setSosreportCondition(s, supportv1alpha1.ConditionUploaded, metav1.ConditionUnknown,
+			"UploadsRetried", fmt.Sprintf("Retrying %d failed upload(s)", retried))
+		if err := r.updateStatus(s, req); err != nil {
+			return err
+		}
+		r.recorder.Event(s, corev1.EventTypeNormal, "Uploads retried",
+			fmt.Sprintf("Retrying %d failed upload(s)", retried))
+	}
+
+	patch := client.MergeFrom(s.DeepCopy())
+	delete(s.Annotations, supportv1alpha1.RetryUploadsAnnotation)
+	return r.Patch(ctx, s, patch)
+}
+
+/*
+Return the name of the upload job of a node and target. Node and target names may be longer than a job name, so they
+are hashed.
+*/
+func getUploadJobName(s *supportv1alpha1.Sosreport, nodeName, target string, attempt int32) (string, error) {
+	if len(s.Name) > MAX_UPLOAD_NAME_BASE {
+		return "", fmt.Errorf("Sosreport name %s is too long to generate upload job names", s.Name)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(nodeName))
+	if target != DEFAULT_UPLOAD_TARGET {
+		h.Write([]byte("/" + target))
+	}
+	return fmt.Sprintf("%s-upload-%08x-%d", s.Name, h.Sum32(), attempt), nil
+}
+
+/*
+Create the definition of the job which uploads the archive of a node to a target. The job mounts the archive's PVC
+read-only and runs the uploader of the sosreport image. Unlike sosreport jobs, it does not need the host's network or
+PID namespace.
+*/
+func (r *SosreportReconciler) uploadJobForSosreport(s *supportv1alpha1.Sosreport, nodeStatus *supportv1alpha1.SosreportNodeStatus, upload *supportv1alpha1.SosreportUploadStatus, attempt int32, environmentMap map[string]string, conf *sosreportConfiguration) (*batchv1.Job, error) {
+	jobName, err := getUploadJobName(s, nodeStatus.NodeName, upload.Target, attempt)
+	if err != nil {
+		return nil, err
+	}
+	if nodeStatus.PVCName == "" {
+		return nil, fmt.Errorf("The archive of node %s is not stored on a PVC", nodeStatus.NodeName)
+	}
+
+	env := mapToEnvVarArr(environmentMap)
+	// e.g. for the remote path template of the sftp upload method
+	env = append(env,
+		corev1.EnvVar{Name: "SOSREPORT_NAMESPACE", Value: s.Namespace},
+		corev1.EnvVar{Name: "SOSREPORT_NAME", Value: s.Name},
+		corev1.EnvVar{Name: "NODE_NAME", Value: nodeStatus.NodeName},
+		corev1.EnvVar{Name: "ARCHIVE_PATH", Value: UPLOAD_ARCHIVE_DIR + "/" + nodeStatus.Archive},
+	)
+	container := corev1.Container{
+		Name:    UPLOAD_CONTAINER,
+		Image:   conf.imageName,
+		Command: []string{UPLOADER_COMMAND},
+		Env:     env,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "archive",
+				MountPath: UPLOAD_ARCHIVE_DIR,
+				ReadOnly:  true,
+			},
+		},
+	}
+	if conf.imagePullPolicy != "" {
+		container.ImagePullPolicy = corev1.PullPolicy(conf.imagePullPolicy)
+	}
+	// the nfs upload method mounts the share
+	if upload.Method == "nfs" {
+		privileged := true
+		container.SecurityContext = &corev1.SecurityContext{Privileged: &privileged}
+	}
+
+	// the controller retries failed uploads itself, with the backoff of the retryPolicy
+	var backoffLimit int32
+	labels := labelsForSosreportUpload(s.Name)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: s.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				"nodeName":               nodeStatus.NodeName,
+				UPLOAD_TARGET_ANNOTATION: upload.Target,
+				ATTEMPT_ANNOTATION:       strconv.Itoa(int(attempt)),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			// the pod of a stuck upload job, e.g. one which cannot be scheduled, is removed after the deadline
+			ActiveDeadlineSeconds: getUploadActiveDeadlineSeconds(s),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Tolerations:   s.Spec.Tolerations,
+					Containers:    []corev1.Container{container},
+					Volumes: []corev1.Volume{
+						{
+							Name: "archive",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: nodeStatus.PVCName,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := ctrl.SetControllerReference(s, job, r.Scheme); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
@@ -0,0 +1,397 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport uploads", func() {
+
+	const (
+		UPLOAD_NAMESPACE = "default"
+		NODE_LABEL       = "sosreport-upload-test"
+		TIMEOUT          = time.Second * 10
+		INTERVAL         = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	// envtest runs no job controller and no kubelet, so jobs are finished by hand with a pod which carries the
+	// termination message of the container
+	finishJob := func(job *batchv1.Job, conditionType batchv1.JobConditionType, message string) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      job.Name + "-pod",
+				Namespace: job.Namespace,
+				Labels:    map[string]string{"job-name": job.Name},
+			},
+			Spec: job.Spec.Template.Spec,
+		}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  pod.Spec.Containers[0].Name,
+			Image: pod.Spec.Containers[0].Image,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{Message: message},
+			},
+		}}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type:   conditionType,
+			Status: corev1.ConditionTrue,
+		})
+		Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+	}
+
+	Context("When reading the result of an upload job", func() {
+		It("Should only accept the uploader's JSON result", func() {
+			result, ok := parseUploadResult(`{"method":"s3","result":"Succeeded","location":"s3://sosreports/a.tar.xz","size":42}`)
+			Expect(ok).To(BeTrue())
+			Expect(result.Location).To(Equal("s3://sosreports/a.tar.xz"))
+			Expect(result.Size).To(Equal(int64(42)))
+			Expect(result.Retryable).To(BeFalse())
+
+			_, ok = parseUploadResult("archive=sosreport-worker-0.tar.xz")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Should only retry failed uploads which can succeed", func() {
+			s := &supportv1alpha1.Sosreport{
+				Spec: supportv1alpha1.SosreportSpec{
+					RetryPolicy: &supportv1alpha1.SosreportRetryPolicy{MaxAttempts: 2},
+				},
+			}
+			upload := &supportv1alpha1.SosreportUploadStatus{Result: supportv1alpha1.UploadResultFailed, Attempts: 1}
+			Expect(scheduleUploadRetry(s, upload, false)).To(BeFalse())
+			Expect(scheduleUploadRetry(s, upload, true)).To(BeTrue())
+			Expect(upload.Result).To(Equal(supportv1alpha1.UploadResultPending))
+			Expect(upload.NextAttemptTime).NotTo(BeNil())
+
+			upload = &supportv1alpha1.SosreportUploadStatus{Result: supportv1alpha1.UploadResultFailed, Attempts: 2}
+			Expect(scheduleUploadRetry(s, upload, true)).To(BeFalse())
+		})
+	})
+
+	Context("When the archive of a node was collected", func() {
+		It("Should upload it with a separate upload job which can be retried", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			sosreportConfig := &supportv1alpha1.SosreportConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "upload-test",
+				},
+				Spec: supportv1alpha1.SosreportConfigSpec{
+					Upload: &supportv1alpha1.SosreportConfigUpload{
+						Method:    "ftp",
+						FTPServer: "ftp.example.com",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, sosreportConfig)).Should(Succeed())
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "upload-0",
+					Labels: map[string]string{
+						NODE_LABEL:     "",
+						HOSTNAME_LABEL: "upload-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "upload",
+					Namespace: UPLOAD_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					ConfigRef: sosreportConfig.Name,
+					NodeSelector: map[string]string{
+						NODE_LABEL: "",
+					},
+					RetryPolicy: &supportv1alpha1.SosreportRetryPolicy{
+						MaxAttempts: 2,
+						Backoff:     &metav1.Duration{Duration: time.Second},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: s.Name}
+			getUpload := func() *supportv1alpha1.SosreportUploadStatus {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil || len(s.Status.Nodes) == 0 {
+					return nil
+				}
+				return getNodeUpload(&s.Status.Nodes[0], DEFAULT_UPLOAD_TARGET)
+			}
+			getUploadJob := func(attempt int32) (*batchv1.Job, error) {
+				jobName, err := getUploadJobName(s, "upload-0", DEFAULT_UPLOAD_TARGET, attempt)
+				Expect(err).NotTo(HaveOccurred())
+				job := &batchv1.Job{}
+				return job, k8sClient.Get(ctx, types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: jobName}, job)
+			}
+
+			By("Finishing the sosreport job of the node")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"upload-0"}))
+			Expect(s.Status.EffectiveConfiguration.Environment).To(HaveKeyWithValue("UPLOAD_METHOD", "ftp"))
+			sosreportJob := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: s.Status.Nodes[0].JobName},
+				sosreportJob)).Should(Succeed())
+			finishJob(sosreportJob, batchv1.JobComplete, "archive=sosreport-upload-0.tar.xz")
+
+			By("Waiting for the upload job")
+			uploadJob := &batchv1.Job{}
+			Eventually(func() error {
+				var err error
+				uploadJob, err = getUploadJob(1)
+				return err
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+			container := uploadJob.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).To(Equal([]string{UPLOADER_COMMAND}))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "ARCHIVE_PATH", Value: "/pv/sosreport-upload-0.tar.xz"}))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "FTP_SERVER", Value: "ftp.example.com"}))
+			Expect(container.SecurityContext).To(BeNil())
+			Expect(uploadJob.Spec.Template.Spec.HostNetwork).To(BeFalse())
+			Expect(*uploadJob.Spec.ActiveDeadlineSeconds).To(Equal(int64(DEFAULT_UPLOAD_TIMEOUT.Seconds())))
+			volume := uploadJob.Spec.Template.Spec.Volumes[0]
+			Expect(volume.PersistentVolumeClaim.ClaimName).To(Equal(sosreportJob.Annotations["pvcName"]))
+			Expect(volume.PersistentVolumeClaim.ReadOnly).To(BeTrue())
+
+			Eventually(func() string {
+				if upload := getUpload(); upload != nil {
+					return upload.Result
+				}
+				return ""
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.UploadResultRunning))
+			Expect(s.Status.Phase).To(Equal(supportv1alpha1.SosreportPhaseRunning))
+			Expect(meta.FindStatusCondition(s.Status.Conditions, supportv1alpha1.ConditionUploaded).Reason).To(Equal("UploadsRunning"))
+
+			By("Letting the first upload exceed its deadline, which is retried after the backoff")
+			uploadJob.Status.Conditions = append(uploadJob.Status.Conditions, batchv1.JobCondition{
+				Type:   batchv1.JobFailed,
+				Status: corev1.ConditionTrue,
+				Reason: DEADLINE_EXCEEDED,
+			})
+			Expect(k8sClient.Status().Update(ctx, uploadJob)).Should(Succeed())
+			Eventually(func() error {
+				var err error
+				uploadJob, err = getUploadJob(2)
+				return err
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+
+			By("Failing the second upload for good")
+			finishJob(uploadJob, batchv1.JobFailed, `{"method":"ftp","result":"Failed","message":"connection refused","retryable":true}`)
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+			Expect(meta.IsStatusConditionTrue(s.Status.Conditions, supportv1alpha1.ConditionCollected)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(s.Status.Conditions, supportv1alpha1.ConditionUploaded)).To(BeTrue())
+			Expect(s.Status.Nodes[0].Uploads).To(HaveLen(1))
+			Expect(s.Status.Nodes[0].Uploads[0].Result).To(Equal(supportv1alpha1.UploadResultFailed))
+			Expect(s.Status.Nodes[0].Uploads[0].Attempts).To(Equal(int32(2)))
+
+			By("Retrying the failed upload on request")
+			s.Annotations = map[string]string{supportv1alpha1.RetryUploadsAnnotation: ""}
+			Expect(k8sClient.Update(ctx, s)).Should(Succeed())
+			Eventually(func() error {
+				var err error
+				uploadJob, err = getUploadJob(3)
+				return err
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+			Eventually(func() map[string]string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Annotations
+			}, TIMEOUT, INTERVAL).ShouldNot(HaveKey(supportv1alpha1.RetryUploadsAnnotation))
+
+			finishJob(uploadJob, batchv1.JobComplete,
+				`{"method":"ftp","result":"Succeeded","location":"ftp://ftp.example.com/sosreport-upload-0.tar.xz","size":42}`)
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseSucceeded))
+			Expect(meta.IsStatusConditionTrue(s.Status.Conditions, supportv1alpha1.ConditionUploaded)).To(BeTrue())
+			upload := s.Status.Nodes[0].Uploads[0]
+			Expect(upload.Result).To(Equal(supportv1alpha1.UploadResultSucceeded))
+			Expect(upload.Location).To(Equal("ftp://ftp.example.com/sosreport-upload-0.tar.xz"))
+			Expect(upload.Size).To(Equal(int64(42)))
+			Expect(upload.Attempts).To(Equal(int32(3)))
+			Expect(s.Status.CompletionTime).NotTo(BeNil())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, sosreportConfig)).Should(Succeed())
+		})
+	})
+
+	Context("When a Sosreport has several upload targets", func() {
+		It("Should upload every archive to each target and report each target separately", func() {
+			if os.Getenv("USE_EXISTING_CLUSTER") == "true" {
+				Skip("nodes cannot be created in an existing cluster")
+			}
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "upload-targets-case",
+					Namespace: UPLOAD_NAMESPACE,
+				},
+				StringData: map[string]string{
+					"username": "user",
+					"password": "secret",
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).Should(Succeed())
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "upload-targets-0",
+					Labels: map[string]string{
+						NODE_LABEL + "-targets": "",
+						HOSTNAME_LABEL:          "upload-targets-0",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, node)).Should(Succeed())
+
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "upload-targets",
+					Namespace: UPLOAD_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					NodeSelector: map[string]string{
+						NODE_LABEL + "-targets": "",
+					},
+					UploadTargets: []supportv1alpha1.SosreportUploadTarget{
+						{
+							Name: "vendor",
+							SosreportConfigUpload: supportv1alpha1.SosreportConfigUpload{
+								Method:     "case",
+								CaseNumber: "01234567",
+								SecretName: secret.Name,
+							},
+						},
+						{
+							Name: "archive",
+							SosreportConfigUpload: supportv1alpha1.SosreportConfigUpload{
+								Method:   "nfs",
+								NFSShare: "192.168.122.1:/sosreports",
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: s.Name}
+			getUploadJob := func(target string) (*batchv1.Job, error) {
+				jobName, err := getUploadJobName(s, "upload-targets-0", target, 1)
+				Expect(err).NotTo(HaveOccurred())
+				job := &batchv1.Job{}
+				return job, k8sClient.Get(ctx, types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: jobName}, job)
+			}
+
+			By("Finishing the sosreport job of the node")
+			Eventually(func() []string {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return nil
+				}
+				return s.Status.CurrentlyRunningNodes
+			}, TIMEOUT, INTERVAL).Should(Equal([]string{"upload-targets-0"}))
+			sosreportJob := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: UPLOAD_NAMESPACE, Name: s.Status.Nodes[0].JobName},
+				sosreportJob)).Should(Succeed())
+			finishJob(sosreportJob, batchv1.JobComplete, "archive=sosreport-upload-targets-0.tar.xz")
+
+			By("Waiting for the upload job of the first target")
+			var vendorJob, archiveJob *batchv1.Job
+			Eventually(func() error {
+				var err error
+				vendorJob, err = getUploadJob("vendor")
+				return err
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+			// the upload jobs of a node take turns with its ReadWriteOnce PVC
+			Consistently(func() bool {
+				_, err := getUploadJob("archive")
+				return apierrors.IsNotFound(err)
+			}, time.Second, INTERVAL).Should(BeTrue())
+			Expect(vendorJob.Annotations).To(HaveKeyWithValue(UPLOAD_TARGET_ANNOTATION, "vendor"))
+			vendorContainer := vendorJob.Spec.Template.Spec.Containers[0]
+			Expect(vendorContainer.Env).To(ContainElement(corev1.EnvVar{Name: "UPLOAD_METHOD", Value: "case"}))
+			Expect(vendorContainer.Env).To(ContainElement(corev1.EnvVar{Name: "CASE_NUMBER", Value: "01234567"}))
+			Expect(vendorContainer.Env).To(ContainElement(corev1.EnvVar{Name: "USERNAME", Value: "user"}))
+			Expect(vendorContainer.SecurityContext).To(BeNil())
+
+			By("Failing the vendor upload and waiting for the upload job of the second target")
+			finishJob(vendorJob, batchv1.JobFailed, `{"method":"case","result":"Failed","message":"unauthorized","retryable":false}`)
+			Eventually(func() error {
+				var err error
+				archiveJob, err = getUploadJob("archive")
+				return err
+			}, TIMEOUT, INTERVAL).Should(Succeed())
+			archiveContainer := archiveJob.Spec.Template.Spec.Containers[0]
+			Expect(archiveContainer.Env).To(ContainElement(corev1.EnvVar{Name: "UPLOAD_METHOD", Value: "nfs"}))
+			Expect(archiveContainer.Env).NotTo(ContainElement(corev1.EnvVar{Name: "CASE_NUMBER", Value: "01234567"}))
+			Expect(archiveContainer.Env).NotTo(ContainElement(corev1.EnvVar{Name: "USERNAME", Value: "user"}))
+			Expect(*archiveContainer.SecurityContext.Privileged).To(BeTrue())
+
+			By("Uploading to the archive")
+			finishJob(archiveJob, batchv1.JobComplete, `{"method":"nfs","result":"Succeeded","size":42}`)
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, namespacedName, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+			Expect(s.Status.Nodes[0].Uploads).To(HaveLen(2))
+			Expect(getNodeUpload(&s.Status.Nodes[0], "vendor").Result).To(Equal(supportv1alpha1.UploadResultFailed))
+			Expect(getNodeUpload(&s.Status.Nodes[0], "vendor").Message).To(Equal("unauthorized"))
+			Expect(getNodeUpload(&s.Status.Nodes[0], "archive").Result).To(Equal(supportv1alpha1.UploadResultSucceeded))
+			Expect(meta.FindStatusCondition(s.Status.Conditions, supportv1alpha1.ConditionUploaded).Message).
+				To(ContainSubstring("via case, nfs"))
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, node)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).Should(Succeed())
+		})
+	})
+})
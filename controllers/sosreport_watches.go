@@ -0,0 +1,122 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+// the ConfigMaps which configure the Sosreports of their namespace
+var CONFIGURATION_CONFIG_MAP_NAMES = []string{
+	GLOBAL_CONFIG_MAP_NAME,
+	DEVELOPMENT_CONFIG_MAP_NAME,
+	UPLOAD_CONFIG_MAP_NAME,
+}
+
+/*
+Create an informer for the core objects of a resource with a given name in all namespaces and let the manager run
+it. Unlike a watch of the whole resource, it does not cache the other objects of the cluster, e.g. all Secrets.
+*/
+func newNamedInformer(mgr ctrl.Manager, clientset kubernetes.Interface, resource, name string, object runtime.Object) (toolscache.SharedIndexInformer, error) {
+	listWatch := toolscache.NewFilteredListWatchFromClient(clientset.CoreV1().RESTClient(), resource,
+		metav1.NamespaceAll, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		})
+	informer := toolscache.NewSharedIndexInformer(listWatch, object, 0, toolscache.Indexers{})
+	err := mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		informer.Run(stop)
+		return nil
+	}))
+	return informer, err
+}
+
+/*
+Get the reconcile requests of all Sosreports which are not finished, yet. An empty namespace matches all namespaces.
+*/
+func (r *SosreportReconciler) getUnfinishedSosreportRequests(namespace string, filter func(s *supportv1alpha1.Sosreport) bool) []reconcile.Request {
+	sosreportList := &supportv1alpha1.SosreportList{}
+	if err := r.List(ctx, sosreportList, client.InNamespace(namespace)); err != nil {
+		log.Error(err, "unable to list Sosreports", "namespace", namespace)
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range sosreportList.Items {
+		s := &sosreportList.Items[i]
+		if s.Status.IsFinished() || (filter != nil && !filter(s)) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: s.Namespace, Name: s.Name},
+		})
+	}
+	return requests
+}
+
+/*
+Map a change of one of the configuration ConfigMaps to the Sosreports in its namespace
+*/
+func (r *SosreportReconciler) mapConfigMapToSosreports(o handler.MapObject) []reconcile.Request {
+	for _, name := range CONFIGURATION_CONFIG_MAP_NAMES {
+		if o.Meta.GetName() == name {
+			log.V(DEBUG).Info("Configuration ConfigMap changed", "namespace", o.Meta.GetNamespace(), "name", name)
+			return r.getUnfinishedSosreportRequests(o.Meta.GetNamespace(), nil)
+		}
+	}
+	return nil
+}
+
+/*
+Map a change of an upload Secret to the Sosreports in its namespace which use it
+*/
+func (r *SosreportReconciler) mapSecretToSosreports(o handler.MapObject) []reconcile.Request {
+	return r.getUnfinishedSosreportRequests(o.Meta.GetNamespace(), func(s *supportv1alpha1.Sosreport) bool {
+		uploadSecret := UPLOAD_SECRET_NAME
+		if s.Status.EffectiveConfiguration != nil && s.Status.EffectiveConfiguration.UploadSecret != "" {
+			uploadSecret = s.Status.EffectiveConfiguration.UploadSecret
+		}
+		if o.Meta.GetName() == uploadSecret {
+			return true
+		}
+		for _, target := range s.Spec.UploadTargets {
+			if o.Meta.GetName() == target.SecretName || (target.SecretName == "" && o.Meta.GetName() == UPLOAD_SECRET_NAME) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+/*
+Map a change of a SosreportConfig to the Sosreports in all namespaces, as the namespaces and references which it
+applies to may have changed as well
+*/
+func (r *SosreportReconciler) mapSosreportConfigToSosreports(o handler.MapObject) []reconcile.Request {
+	log.V(DEBUG).Info("SosreportConfig changed", "name", o.Meta.GetName())
+	return r.getUnfinishedSosreportRequests("", nil)
+}
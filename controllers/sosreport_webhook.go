@@ -0,0 +1,332 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	VALIDATING_WEBHOOK_PATH = "/validate-support-openshift-io-v1alpha1-sosreport"
+)
+
+var (
+	// sos plugin names consist of lower case letters, digits and underscores
+	sosPluginNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// sos plugin options are <plugin>.<option>
+	sosPluginOptionRegexp = regexp.MustCompile(`^[a-z0-9_]+\.[a-zA-Z0-9_-]+$`)
+	// plugin options are passed to sos report as a comma separated list of <plugin>.<option>=<value>
+	sosPluginOptionValueRegexp = regexp.MustCompile(`^[^,=\s]+$`)
+)
+
+// +kubebuilder:webhook:path=/validate-support-openshift-io-v1alpha1-sosreport,mutating=false,failurePolicy=fail,groups=support.openshift.io,resources=sosreports,verbs=create;update,versions=v1alpha1,name=vsosreport.kb.io
+
+// SosreportValidator validates Sosreports on creation and update.
+// It is a plain admission.Handler rather than a webhook.Validator, as it needs a client in order to look up nodes
+// and returns warnings.
+type SosreportValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+/*
+Register the validating webhook with the manager's webhook server
+*/
+func (v *SosreportValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if v.Client == nil {
+		v.Client = mgr.GetClient()
+	}
+	mgr.GetWebhookServer().Register(VALIDATING_WEBHOOK_PATH, &webhook.Admission{Handler: v})
+	return nil
+}
+
+// InjectDecoder injects the decoder
+func (v *SosreportValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates a Sosreport admission request
+func (v *SosreportValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	s := &supportv1alpha1.Sosreport{}
+	if err := v.decoder.Decode(req, s); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var errs []string
+	errs = append(errs, validateSosreportName(s)...)
+	errs = append(errs, validateSosreportNodeSelector(s)...)
+	errs = append(errs, validateSosreportTolerations(s)...)
+	errs = append(errs, validateSosreportPlugins(s)...)
+	errs = append(errs, validateSosreportStorage(s)...)
+	errs = append(errs, validateSosreportUploadTargets(s)...)
+	if s.Spec.TTLAfterFinished != nil && s.Spec.TTLAfterFinished.Duration < 0 {
+		errs = append(errs, "spec.ttlAfterFinished: must not be negative")
+	}
+	if p := s.Spec.DeletionPolicy; p != nil && p.Action == supportv1alpha1.DeletionActionExport {
+		for _, msg := range validation.IsDNS1123Subdomain(p.ExportPVCName) {
+			errs = append(errs, fmt.Sprintf("spec.deletionPolicy.exportPVCName: %s", msg))
+		}
+	}
+
+	if req.Operation == admissionv1beta1.Update {
+		oldSosreport := &supportv1alpha1.Sosreport{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldSosreport); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = append(errs, validateSosreportSpecUpdate(oldSosreport, s)...)
+	}
+
+	if len(errs) > 0 {
+		return admission.Denied(strings.Join(errs, "; "))
+	}
+
+	response := admission.Allowed("")
+	if warning := v.getNodeSelectorWarning(ctx, s); warning != "" {
+		response.Warnings = append(response.Warnings, warning)
+	}
+	return response
+}
+
+/*
+The name of a Sosreport is part of the names of its jobs and PVCs, which must not exceed 63 characters
+*/
+func validateSosreportName(s *supportv1alpha1.Sosreport) []string {
+	if getMaxShortNameLength(s.Name) < 1 {
+		return []string{fmt.Sprintf("metadata.name: %s is too long, the name of a Sosreport must not exceed %d characters",
+			s.Name, len(s.Name)+getMaxShortNameLength(s.Name)-1)}
+	}
+	return nil
+}
+
+/*
+NodeSelector keys and values must be valid label keys and values, the NodeLabelSelector must be a valid label
+selector and NodeNames must be valid node names
+*/
+func validateSosreportNodeSelector(s *supportv1alpha1.Sosreport) []string {
+	var errs []string
+	for k, v := range s.Spec.NodeSelector {
+		for _, msg := range validation.IsQualifiedName(k) {
+			errs = append(errs, fmt.Sprintf("spec.nodeSelector: invalid key %q: %s", k, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			errs = append(errs, fmt.Sprintf("spec.nodeSelector[%s]: invalid value %q: %s", k, v, msg))
+		}
+	}
+	if s.Spec.NodeLabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(s.Spec.NodeLabelSelector); err != nil {
+			errs = append(errs, fmt.Sprintf("spec.nodeLabelSelector: %s", err))
+		}
+	}
+	nodeNameLists := map[string][]string{
+		"spec.nodeNames":        s.Spec.NodeNames,
+		"spec.excludeNodeNames": s.Spec.ExcludeNodeNames,
+	}
+	for path, nodeNames := range nodeNameLists {
+		for _, nodeName := range nodeNames {
+			for _, msg := range validation.IsDNS1123Subdomain(nodeName) {
+				errs = append(errs, fmt.Sprintf("%s: invalid node name %q: %s", path, nodeName, msg))
+			}
+		}
+	}
+	if s.Spec.Sample != nil && s.Spec.Sample.GroupByLabel != "" {
+		for _, msg := range validation.IsQualifiedName(s.Spec.Sample.GroupByLabel) {
+			errs = append(errs, fmt.Sprintf("spec.sample.groupByLabel: invalid label %q: %s", s.Spec.Sample.GroupByLabel, msg))
+		}
+	}
+	return errs
+}
+
+/*
+Tolerations must follow the same rules as the tolerations of a pod
+*/
+func validateSosreportTolerations(s *supportv1alpha1.Sosreport) []string {
+	var errs []string
+	for i, t := range s.Spec.Tolerations {
+		path := fmt.Sprintf("spec.tolerations[%d]", i)
+		if t.Key != "" {
+			for _, msg := range validation.IsQualifiedName(t.Key) {
+				errs = append(errs, fmt.Sprintf("%s.key: invalid key %q: %s", path, t.Key, msg))
+			}
+		}
+		switch t.Operator {
+		case corev1.TolerationOpEqual, "":
+			if t.Key == "" {
+				errs = append(errs, fmt.Sprintf("%s.operator: an empty key requires operator Exists", path))
+			}
+			for _, msg := range validation.IsValidLabelValue(t.Value) {
+				errs = append(errs, fmt.Sprintf("%s.value: invalid value %q: %s", path, t.Value, msg))
+			}
+		case corev1.TolerationOpExists:
+			if t.Value != "" {
+				errs = append(errs, fmt.Sprintf("%s.value: must be empty when operator is Exists", path))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("%s.operator: unsupported operator %q, must be Equal or Exists", path, t.Operator))
+		}
+		switch t.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			errs = append(errs, fmt.Sprintf("%s.effect: unsupported effect %q", path, t.Effect))
+		}
+		if t.TolerationSeconds != nil && t.Effect != corev1.TaintEffectNoExecute {
+			errs = append(errs, fmt.Sprintf("%s.tolerationSeconds: requires effect NoExecute", path))
+		}
+	}
+	return errs
+}
+
+/*
+Plugin names and options are passed to sos report as comma separated lists and must be well formed
+*/
+func validateSosreportPlugins(s *supportv1alpha1.Sosreport) []string {
+	var errs []string
+	pluginLists := map[string][]string{
+		"spec.onlyPlugins":   s.Spec.OnlyPlugins,
+		"spec.skipPlugins":   s.Spec.SkipPlugins,
+		"spec.enablePlugins": s.Spec.EnablePlugins,
+		"spec.profiles":      s.Spec.Profiles,
+	}
+	for path, plugins := range pluginLists {
+		for _, plugin := range plugins {
+			if !sosPluginNameRegexp.MatchString(plugin) {
+				errs = append(errs, fmt.Sprintf("%s: invalid name %q", path, plugin))
+			}
+		}
+	}
+	for _, plugin := range s.Spec.OnlyPlugins {
+		for _, skipped := range s.Spec.SkipPlugins {
+			if plugin == skipped {
+				errs = append(errs, fmt.Sprintf("spec.skipPlugins: %s is also listed in spec.onlyPlugins", plugin))
+			}
+		}
+	}
+	for k, v := range s.Spec.PluginOptions {
+		if !sosPluginOptionRegexp.MatchString(k) {
+			errs = append(errs, fmt.Sprintf("spec.pluginOptions: invalid option %q, must be <plugin>.<option>", k))
+		}
+		if !sosPluginOptionValueRegexp.MatchString(v) {
+			errs = append(errs, fmt.Sprintf("spec.pluginOptions[%s]: invalid value %q, must not be empty or contain ',', '=' or whitespace", k, v))
+		}
+	}
+	return errs
+}
+
+/*
+The options of the shared PVC only apply to the Shared storage mode. The name of the collector's Service is derived
+from the Sosreport's name and must be a valid DNS label.
+*/
+func validateSosreportStorage(s *supportv1alpha1.Sosreport) []string {
+	storage := s.Spec.Storage
+	if storage == nil {
+		return nil
+	}
+	var errs []string
+	if getStorageMode(s) != supportv1alpha1.StorageModeShared {
+		if storage.LocalVolume != "" || storage.AccessMode != "" || storage.Capacity != nil {
+			errs = append(errs, "spec.storage: localVolume, accessMode and capacity require mode Shared")
+		}
+		return errs
+	}
+	if storage.Capacity != nil && storage.Capacity.Sign() <= 0 {
+		errs = append(errs, fmt.Sprintf("spec.storage.capacity: %s must be greater than 0", storage.Capacity.String()))
+	}
+	for _, msg := range validation.IsDNS1035Label(getCollectorName(s)) {
+		errs = append(errs, fmt.Sprintf("metadata.name: the collector Service %s is invalid: %s", getCollectorName(s), msg))
+	}
+	return errs
+}
+
+/*
+Upload targets must have unique names and the same settings as the upload of a SosreportConfig. A target which does
+not upload is pointless.
+*/
+func validateSosreportUploadTargets(s *supportv1alpha1.Sosreport) []string {
+	var errs []string
+	names := make(map[string]bool)
+	for i, target := range s.Spec.UploadTargets {
+		path := fmt.Sprintf("spec.uploadTargets[%d]", i)
+		if names[target.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name: duplicate target %q", path, target.Name))
+		}
+		names[target.Name] = true
+		if target.Method == "none" {
+			errs = append(errs, fmt.Sprintf("%s.method: none is not supported for upload targets", path))
+		}
+		errs = append(errs, validateSosreportConfigUpload(target.SosreportConfigUpload, path)...)
+	}
+	return errs
+}
+
+/*
+The spec of a Sosreport cannot change once its nodes were selected, except for cancel and the cleanup and deletion
+settings
+*/
+func validateSosreportSpecUpdate(oldSosreport, s *supportv1alpha1.Sosreport) []string {
+	if isSosreportPending(oldSosreport) {
+		return nil
+	}
+	oldSpec := oldSosreport.Spec.DeepCopy()
+	newSpec := s.Spec.DeepCopy()
+	for _, spec := range []*supportv1alpha1.SosreportSpec{oldSpec, newSpec} {
+		spec.Cancel = false
+		spec.TTLAfterFinished = nil
+		spec.RetainPVCs = false
+		spec.DeletionPolicy = nil
+	}
+	if !equality.Semantic.DeepEqual(oldSpec, newSpec) {
+		return []string{fmt.Sprintf("spec: is immutable once the Sosreport is in phase %s", oldSosreport.Status.Phase)}
+	}
+	return nil
+}
+
+/*
+A node selection which matches no node is allowed, e.g. for nodes which are not there, yet, but the Sosreport will fail
+*/
+func (v *SosreportValidator) getNodeSelectorWarning(ctx context.Context, s *supportv1alpha1.Sosreport) string {
+	selector, err := getSosreportNodeLabelSelector(s)
+	if err != nil {
+		return ""
+	}
+	nodeList := &corev1.NodeList{}
+	if err := v.Client.List(ctx, nodeList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.V(DEBUG).Info("Could not list nodes in order to validate the nodeSelector", "err", err)
+		return ""
+	}
+	for _, node := range nodeList.Items {
+		if isNodeNameSelected(s, node) {
+			return ""
+		}
+	}
+	return "spec.nodeSelector, spec.nodeLabelSelector and spec.nodeNames match no node, the Sosreport will fail with NoEligibleNodes"
+}
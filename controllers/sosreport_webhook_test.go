@@ -0,0 +1,198 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("Sosreport webhook", func() {
+
+	const (
+		WEBHOOK_NAMESPACE = "default"
+		TIMEOUT           = time.Second * 10
+		INTERVAL          = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	newSosreport := func(name string) *supportv1alpha1.Sosreport {
+		return &supportv1alpha1.Sosreport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: WEBHOOK_NAMESPACE,
+			},
+			Spec: supportv1alpha1.SosreportSpec{
+				// no node carries this label, so the Sosreport fails right away
+				NodeSelector: map[string]string{
+					"sosreport-webhook-test": "none",
+				},
+			},
+		}
+	}
+
+	Context("When creating a Sosreport", func() {
+		It("Should reject names which are too long for the job naming scheme", func() {
+			s := newSosreport(strings.Repeat("a", 40))
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject invalid tolerations", func() {
+			s := newSosreport("webhook-tolerations")
+			s.Spec.Tolerations = []corev1.Toleration{
+				corev1.Toleration{
+					Key:      "node-role.kubernetes.io/master",
+					Operator: "In",
+					Effect:   corev1.TaintEffectNoSchedule,
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.Tolerations = []corev1.Toleration{
+				corev1.Toleration{
+					Operator: corev1.TolerationOpEqual,
+					Value:    "true",
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject invalid node selections", func() {
+			s := newSosreport("webhook-node-selection")
+			s.Spec.NodeLabelSelector = &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      "node-role.kubernetes.io/worker",
+						Operator: "Contains",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.NodeLabelSelector = nil
+			s.Spec.ExcludeNodeNames = []string{"Not_A_Node"}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject invalid plugin options", func() {
+			s := newSosreport("webhook-plugin-options")
+			s.Spec.PluginOptions = map[string]string{
+				"crio": "on",
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.PluginOptions = map[string]string{
+				"crio.logs": "on,off",
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject storage options without the Shared storage mode", func() {
+			s := newSosreport("webhook-storage")
+			s.Spec.Storage = &supportv1alpha1.SosreportStorage{
+				LocalVolume: supportv1alpha1.LocalVolumeHostPath,
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			capacity := resource.MustParse("0")
+			s.Spec.Storage = &supportv1alpha1.SosreportStorage{
+				Mode:     supportv1alpha1.StorageModeShared,
+				Capacity: &capacity,
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject invalid upload targets", func() {
+			s := newSosreport("webhook-upload-targets")
+			s.Spec.UploadTargets = []supportv1alpha1.SosreportUploadTarget{
+				{
+					Name:                  "archive",
+					SosreportConfigUpload: supportv1alpha1.SosreportConfigUpload{Method: "nfs"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.UploadTargets[0].NFSShare = "192.168.122.1:/sosreports"
+			s.Spec.UploadTargets = append(s.Spec.UploadTargets, supportv1alpha1.SosreportUploadTarget{
+				Name:                  "archive",
+				SosreportConfigUpload: supportv1alpha1.SosreportConfigUpload{Method: "ftp", FTPServer: "ftp.example.com"},
+			})
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.UploadTargets[1].Name = "vendor"
+			s.Spec.UploadTargets[1].Method = "none"
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should reject the Export deletion action without a valid export PVC", func() {
+			s := newSosreport("webhook-deletion-policy")
+			s.Spec.DeletionPolicy = &supportv1alpha1.SosreportDeletionPolicy{
+				Action: supportv1alpha1.DeletionActionExport,
+			}
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+
+			s.Spec.DeletionPolicy.ExportPVCName = "Invalid_PVC"
+			Expect(k8sClient.Create(ctx, s)).ShouldNot(Succeed())
+		})
+
+		It("Should allow a NodeSelector which matches no node and make the spec immutable after scheduling", func() {
+			s := newSosreport("webhook-immutable")
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+
+			By("Waiting for the Sosreport to leave the Pending phase")
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: WEBHOOK_NAMESPACE, Name: s.Name}, s); err != nil {
+					return false
+				}
+				return !isSosreportPending(s)
+			}, TIMEOUT, INTERVAL).Should(BeTrue())
+
+			By("Updating the spec")
+			s.Spec.AllLogs = true
+			Expect(k8sClient.Update(ctx, s)).ShouldNot(Succeed())
+
+			By("Updating the metadata only")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: WEBHOOK_NAMESPACE, Name: s.Name}, s)).Should(Succeed())
+			s.Labels = map[string]string{"webhook": "test"}
+			Expect(k8sClient.Update(ctx, s)).Should(Succeed())
+
+			By("Changing the cleanup settings, which is allowed at any time")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: WEBHOOK_NAMESPACE, Name: s.Name}, s)).Should(Succeed())
+			s.Spec.RetainPVCs = true
+			s.Spec.TTLAfterFinished = &metav1.Duration{Duration: time.Hour}
+			Expect(k8sClient.Update(ctx, s)).Should(Succeed())
+
+			By("Cancelling the Sosreport, which is allowed at any time")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: WEBHOOK_NAMESPACE, Name: s.Name}, s)).Should(Succeed())
+			s.Spec.Cancel = true
+			Expect(k8sClient.Update(ctx, s)).Should(Succeed())
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+		})
+	})
+})
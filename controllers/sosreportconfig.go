@@ -0,0 +1,295 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	resourcev1 "k8s.io/apimachinery/pkg/api/resource"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	S3_MIN_PART_SIZE = 5 * 1024 * 1024 // S3 rejects multipart uploads with smaller parts
+)
+
+// sosreportConfigurationError means that the configuration which applies to a Sosreport is invalid
+type sosreportConfigurationError struct {
+	reason  string
+	message string
+}
+
+func (e *sosreportConfigurationError) Error() string {
+	return e.message
+}
+
+/*
+Parse the PVC capacity of the configuration. The pvc-capacity of the configuration ConfigMap is a plain string, which
+may not be a valid quantity.
+*/
+func getPVCCapacity(conf *sosreportConfiguration) (resourcev1.Quantity, error) {
+	capacity, err := resourcev1.ParseQuantity(conf.pvcCapacity)
+	if err != nil {
+		return capacity, &sosreportConfigurationError{
+			reason:  "InvalidPVCCapacity",
+			message: fmt.Sprintf("The PVC capacity %q is invalid: %v", conf.pvcCapacity, err),
+		}
+	}
+	return capacity, nil
+}
+
+/*
+Get the SosreportConfigs which apply to a Sosreport, in the order of increasing precedence:
+the SosreportConfig named "default", the SosreportConfigs which list the Sosreport's namespace and the SosreportConfig
+which is referenced by the Sosreport's spec.configRef.
+Returns a *sosreportConfigurationError if any of them is invalid or if the referenced SosreportConfig does not exist.
+*/
+func (r *SosreportReconciler) getSosreportConfigs(s *supportv1alpha1.Sosreport) ([]supportv1alpha1.SosreportConfig, error) {
+	sosreportConfigList := &supportv1alpha1.SosreportConfigList{}
+	if err := r.List(ctx, sosreportConfigList); err != nil {
+		log.Error(err, "unable to list SosreportConfigs")
+		return nil, err
+	}
+	sort.Slice(sosreportConfigList.Items, func(i, j int) bool {
+		return sosreportConfigList.Items[i].Name < sosreportConfigList.Items[j].Name
+	})
+
+	var defaultConfigs, namespaceConfigs, referencedConfigs []supportv1alpha1.SosreportConfig
+	for _, sosreportConfig := range sosreportConfigList.Items {
+		switch {
+		case sosreportConfig.Name == s.Spec.ConfigRef:
+			referencedConfigs = append(referencedConfigs, sosreportConfig)
+		case sosreportConfig.Name == supportv1alpha1.DefaultSosreportConfigName:
+			defaultConfigs = append(defaultConfigs, sosreportConfig)
+		case isSosreportConfigForNamespace(sosreportConfig, s.Namespace):
+			namespaceConfigs = append(namespaceConfigs, sosreportConfig)
+		}
+	}
+	if s.Spec.ConfigRef != "" && len(referencedConfigs) == 0 {
+		return nil, &sosreportConfigurationError{
+			reason:  "ConfigNotFound",
+			message: fmt.Sprintf("SosreportConfig %s does not exist", s.Spec.ConfigRef),
+		}
+	}
+
+	sosreportConfigs := append(append(defaultConfigs, namespaceConfigs...), referencedConfigs...)
+	for _, sosreportConfig := range sosreportConfigs {
+		if errs := validateSosreportConfig(sosreportConfig, sosreportConfigList.Items); len(errs) > 0 {
+			return nil, &sosreportConfigurationError{
+				reason:  "InvalidConfig",
+				message: fmt.Sprintf("SosreportConfig %s is invalid: %s", sosreportConfig.Name, strings.Join(errs, "; ")),
+			}
+		}
+	}
+	return sosreportConfigs, nil
+}
+
+/*
+Determine if a SosreportConfig overrides the configuration of a namespace
+*/
+func isSosreportConfigForNamespace(sosreportConfig supportv1alpha1.SosreportConfig, namespace string) bool {
+	for _, ns := range sosreportConfig.Spec.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Validate the parts of a SosreportConfig which the CRD schema cannot validate.
+Returns a list of error messages, which is empty if the SosreportConfig is valid.
+*/
+func validateSosreportConfig(sosreportConfig supportv1alpha1.SosreportConfig, allConfigs []supportv1alpha1.SosreportConfig) []string {
+	var errs []string
+	if sosreportConfig.Name == supportv1alpha1.DefaultSosreportConfigName && len(sosreportConfig.Spec.Namespaces) > 0 {
+		errs = append(errs, "spec.namespaces: must be empty for the default SosreportConfig, which applies to all namespaces")
+	}
+	for _, ns := range sosreportConfig.Spec.Namespaces {
+		for _, other := range allConfigs {
+			if other.Name != sosreportConfig.Name && isSosreportConfigForNamespace(other, ns) {
+				errs = append(errs, fmt.Sprintf("spec.namespaces: namespace %s is also listed in SosreportConfig %s", ns, other.Name))
+			}
+		}
+	}
+	if upload := sosreportConfig.Spec.Upload; upload != nil {
+		errs = append(errs, validateSosreportConfigUpload(*upload, "spec.upload")...)
+	}
+	return errs
+}
+
+/*
+Validate the upload settings of a SosreportConfig or of an upload target of a Sosreport, at the given field path
+*/
+func validateSosreportConfigUpload(upload supportv1alpha1.SosreportConfigUpload, path string) []string {
+	var errs []string
+	if upload.Method == "case" && upload.CaseNumber == "" {
+		errs = append(errs, path+".caseNumber: is required for upload method case")
+	}
+	if upload.Method == "nfs" && upload.NFSShare == "" {
+		errs = append(errs, path+".nfsShare: is required for upload method nfs")
+	}
+	if upload.Method == "ftp" && upload.FTPServer == "" {
+		errs = append(errs, path+".ftpServer: is required for upload method ftp")
+	}
+	if upload.Method == "s3" && upload.S3Bucket == "" {
+		errs = append(errs, path+".s3Bucket: is required for upload method s3")
+	}
+	if upload.Method == "sftp" && upload.SFTPServer == "" {
+		errs = append(errs, path+".sftpServer: is required for upload method sftp")
+	}
+	if upload.Method == "sftp" && upload.SFTPKnownHosts == "" {
+		errs = append(errs, path+".sftpKnownHosts: is required for upload method sftp")
+	}
+	if upload.Method == "http" && !isHTTPURL(upload.HTTPURL) {
+		errs = append(errs, path+".httpURL: must be an http or https URL for upload method http")
+	}
+	if upload.S3PartSize != nil && upload.S3PartSize.Value() < S3_MIN_PART_SIZE {
+		errs = append(errs, path+".s3PartSize: must be at least 5Mi")
+	}
+	for _, code := range upload.HTTPExpectedStatusCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, fmt.Sprintf("%s.httpExpectedStatusCodes: %d is not an HTTP status code", path, code))
+		}
+	}
+	for name, value := range upload.HTTPHeaders {
+		if name == "" || strings.ContainsAny(name, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			errs = append(errs, fmt.Sprintf("%s.httpHeaders: invalid header %q", path, name))
+		}
+	}
+	return errs
+}
+
+/*
+Check if the URL template of the http upload method is an absolute http or https URL
+*/
+func isHTTPURL(urlTemplate string) bool {
+	u, err := url.Parse(urlTemplate)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+/*
+Apply the fields which are set in a SosreportConfig to the configuration
+*/
+func applySosreportConfig(conf *sosreportConfiguration, sosreportConfig supportv1alpha1.SosreportConfig) {
+	spec := sosreportConfig.Spec
+	if conf.environment == nil {
+		conf.environment = make(map[string]string)
+	}
+	if spec.Concurrency != nil {
+		conf.sosreportConcurrency = int(*spec.Concurrency)
+	}
+	if spec.Debug != nil {
+		conf.debug = *spec.Debug
+		conf.environment["DEBUG"] = strconv.FormatBool(*spec.Debug)
+	}
+	if spec.PVCStorageClass != nil {
+		conf.pvcStorageClass = *spec.PVCStorageClass
+	}
+	if spec.PVCCapacity != nil {
+		conf.pvcCapacity = spec.PVCCapacity.String()
+	}
+	if spec.Image != nil {
+		conf.imageName = *spec.Image
+	}
+	if spec.Command != nil {
+		conf.sosreportCommand = *spec.Command
+	}
+	if spec.ImagePullPolicy != nil {
+		conf.imagePullPolicy = string(*spec.ImagePullPolicy)
+	}
+	if spec.SimulationMode != nil {
+		conf.environment["SIMULATION_MODE"] = strconv.FormatBool(*spec.SimulationMode)
+	}
+	if upload := spec.Upload; upload != nil {
+		// the upload settings replace each other as a whole
+		for _, k := range uploadEnvironmentKeys {
+			delete(conf.environment, k)
+		}
+		for k, v := range getUploadEnvironment(*upload) {
+			conf.environment[k] = v
+		}
+		conf.uploadSecret = UPLOAD_SECRET_NAME
+		if upload.SecretName != "" {
+			conf.uploadSecret = upload.SecretName
+		}
+	}
+	conf.sources = append(conf.sources, "SosreportConfig/"+sosreportConfig.Name)
+}
+
+// the environment variables of the entrypoint and the uploader which configure the upload
+var uploadEnvironmentKeys = []string{"UPLOAD_METHOD", "CASE_NUMBER", "OBFUSCATE", "NFS_SHARE", "NFS_OPTIONS", "FTP_SERVER",
+	"S3_BUCKET", "S3_PREFIX", "S3_REGION", "S3_ENDPOINT", "S3_PART_SIZE",
+	"SFTP_SERVER", "SFTP_KNOWN_HOSTS", "SFTP_PATH",
+	"HTTP_URL", "HTTP_METHOD", "HTTP_FORM_FIELD", "HTTP_HEADERS", "HTTP_CA_BUNDLE", "HTTP_EXPECTED_STATUS"}
+
+/*
+Translate upload settings into the environment variables of the uploader. Settings which are not set are left out.
+*/
+func getUploadEnvironment(upload supportv1alpha1.SosreportConfigUpload) map[string]string {
+	environment := make(map[string]string)
+	uploadEnvironment := map[string]string{
+		"UPLOAD_METHOD":    upload.Method,
+		"CASE_NUMBER":      upload.CaseNumber,
+		"NFS_SHARE":        upload.NFSShare,
+		"NFS_OPTIONS":      upload.NFSOptions,
+		"FTP_SERVER":       upload.FTPServer,
+		"S3_BUCKET":        upload.S3Bucket,
+		"S3_PREFIX":        upload.S3Prefix,
+		"S3_REGION":        upload.S3Region,
+		"S3_ENDPOINT":      upload.S3Endpoint,
+		"SFTP_SERVER":      upload.SFTPServer,
+		"SFTP_KNOWN_HOSTS": upload.SFTPKnownHosts,
+		"SFTP_PATH":        upload.SFTPPath,
+		"HTTP_URL":         upload.HTTPURL,
+		"HTTP_METHOD":      upload.HTTPMethod,
+		"HTTP_FORM_FIELD":  upload.HTTPFormField,
+		"HTTP_CA_BUNDLE":   upload.HTTPCABundle,
+	}
+	for k, v := range uploadEnvironment {
+		if v != "" {
+			environment[k] = v
+		}
+	}
+	if len(upload.HTTPHeaders) > 0 {
+		var headers []string
+		for name, value := range upload.HTTPHeaders {
+			headers = append(headers, name+": "+value)
+		}
+		sort.Strings(headers)
+		environment["HTTP_HEADERS"] = strings.Join(headers, "\n")
+	}
+	if len(upload.HTTPExpectedStatusCodes) > 0 {
+		var codes []string
+		for _, code := range upload.HTTPExpectedStatusCodes {
+			codes = append(codes, strconv.Itoa(int(code)))
+		}
+		environment["HTTP_EXPECTED_STATUS"] = strings.Join(codes, ",")
+	}
+	if upload.S3PartSize != nil {
+		environment["S3_PART_SIZE"] = strconv.FormatInt(upload.S3PartSize.Value(), 10)
+	}
+	if upload.Obfuscate {
+		environment["OBFUSCATE"] = "true"
+	}
+	return environment
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+// SosreportConfigReconciler validates SosreportConfig objects and reports the result in their status
+type SosreportConfigReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=support.openshift.io,resources=sosreportconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=support.openshift.io,resources=sosreportconfigs/status,verbs=get;update;patch
+
+/*
+Validate all SosreportConfigs whenever one of them changes. A change of one SosreportConfig can make another one
+invalid, e.g. if both list the same namespace.
+*/
+func (r *SosreportConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("sosreportconfig", req.NamespacedName)
+
+	log.V(DEBUG).Info("Reconciler loop triggered")
+
+	sosreportConfigList := &supportv1alpha1.SosreportConfigList{}
+	if err := r.List(ctx, sosreportConfigList); err != nil {
+		log.Error(err, "unable to list SosreportConfigs")
+		return ctrl.Result{}, err
+	}
+
+	for i := range sosreportConfigList.Items {
+		sosreportConfig := &sosreportConfigList.Items[i]
+		condition := metav1.Condition{
+			Type:               supportv1alpha1.ConditionValid,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: sosreportConfig.Generation,
+			Reason:             "Valid",
+			Message:            "The configuration is valid",
+		}
+		if errs := validateSosreportConfig(*sosreportConfig, sosreportConfigList.Items); len(errs) > 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "Invalid"
+			condition.Message = strings.Join(errs, "; ")
+		}
+
+		existing := meta.FindStatusCondition(sosreportConfig.Status.Conditions, condition.Type)
+		if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message &&
+			sosreportConfig.Status.ObservedGeneration == sosreportConfig.Generation {
+			continue
+		}
+		// SetStatusCondition does not update the ObservedGeneration of an existing condition
+		meta.RemoveStatusCondition(&sosreportConfig.Status.Conditions, condition.Type)
+		meta.SetStatusCondition(&sosreportConfig.Status.Conditions, condition)
+		sosreportConfig.Status.ObservedGeneration = sosreportConfig.Generation
+		log.V(DEBUG).Info("Updating SosreportConfig status", "name", sosreportConfig.Name, "valid", condition.Status)
+		if err := r.Status().Update(ctx, sosreportConfig); err != nil {
+			log.V(DEBUG).Info("unable to update SosreportConfig status", "err", err)
+			return requeueOnConflict(err)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+/*
+Trigger reconcile loop whenever a SosreportConfig is created, updated or deleted
+*/
+func (r *SosreportConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&supportv1alpha1.SosreportConfig{}).
+		Complete(r)
+}
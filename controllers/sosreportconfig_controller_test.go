@@ -0,0 +1,200 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("SosreportConfig controller", func() {
+
+	const (
+		SOSREPORT_CONFIG_NAME = "test-sosreportconfig"
+		CONFIG_NAMESPACE      = "default"
+		TIMEOUT               = time.Second * 10
+		INTERVAL              = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	getValidCondition := func(name string) metav1.ConditionStatus {
+		sosreportConfig := &supportv1alpha1.SosreportConfig{}
+		if err := k8sClient.Get(ctx, types.NamespacedName{Name: name}, sosreportConfig); err != nil {
+			return metav1.ConditionUnknown
+		}
+		condition := meta.FindStatusCondition(sosreportConfig.Status.Conditions, supportv1alpha1.ConditionValid)
+		if condition == nil || condition.ObservedGeneration != sosreportConfig.Generation {
+			return metav1.ConditionUnknown
+		}
+		return condition.Status
+	}
+
+	Context("When creating a SosreportConfig", func() {
+		It("Should report if the configuration is valid", func() {
+			sosreportConfig := &supportv1alpha1.SosreportConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: SOSREPORT_CONFIG_NAME,
+				},
+				Spec: supportv1alpha1.SosreportConfigSpec{
+					Upload: &supportv1alpha1.SosreportConfigUpload{
+						Method: "nfs",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, sosreportConfig)).Should(Succeed())
+			Eventually(func() metav1.ConditionStatus {
+				return getValidCondition(SOSREPORT_CONFIG_NAME)
+			}, TIMEOUT, INTERVAL).Should(Equal(metav1.ConditionFalse))
+
+			By("Setting the NFS share")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: SOSREPORT_CONFIG_NAME}, sosreportConfig)).Should(Succeed())
+			sosreportConfig.Spec.Upload.NFSShare = "192.168.122.1:/nfs"
+			Expect(k8sClient.Update(ctx, sosreportConfig)).Should(Succeed())
+			Eventually(func() metav1.ConditionStatus {
+				return getValidCondition(SOSREPORT_CONFIG_NAME)
+			}, TIMEOUT, INTERVAL).Should(Equal(metav1.ConditionTrue))
+
+			Expect(k8sClient.Delete(ctx, sosreportConfig)).Should(Succeed())
+		})
+
+		It("Should require a bucket for the s3 upload method and pass the S3 settings to the jobs", func() {
+			partSize := resource.MustParse("1Mi")
+			sosreportConfig := supportv1alpha1.SosreportConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "s3",
+				},
+				Spec: supportv1alpha1.SosreportConfigSpec{
+					Upload: &supportv1alpha1.SosreportConfigUpload{
+						Method:     "s3",
+						S3Prefix:   "cluster-a/",
+						S3Endpoint: "http://minio.minio.svc:9000",
+						S3PartSize: &partSize,
+					},
+				},
+			}
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(ConsistOf(
+				"spec.upload.s3Bucket: is required for upload method s3",
+				"spec.upload.s3PartSize: must be at least 5Mi"))
+			sosreportConfig.Spec.Upload.S3Bucket = "sosreports"
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(
+				ConsistOf("spec.upload.s3PartSize: must be at least 5Mi"))
+			partSize = resource.MustParse("128Mi")
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(BeEmpty())
+
+			conf := &sosreportConfiguration{}
+			applySosreportConfig(conf, sosreportConfig)
+			Expect(conf.environment).To(Equal(map[string]string{
+				"UPLOAD_METHOD": "s3",
+				"S3_BUCKET":     "sosreports",
+				"S3_PREFIX":     "cluster-a/",
+				"S3_ENDPOINT":   "http://minio.minio.svc:9000",
+				"S3_PART_SIZE":  "134217728",
+			}))
+		})
+
+		It("Should require a server and pinned host keys for the sftp upload method", func() {
+			sosreportConfig := supportv1alpha1.SosreportConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "sftp",
+				},
+				Spec: supportv1alpha1.SosreportConfigSpec{
+					Upload: &supportv1alpha1.SosreportConfigUpload{
+						Method:     "sftp",
+						SFTPServer: "sftp.example.com:2222",
+						SFTPPath:   "/upload/{{sosreport}}",
+					},
+				},
+			}
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(
+				ConsistOf("spec.upload.sftpKnownHosts: is required for upload method sftp"))
+			sosreportConfig.Spec.Upload.SFTPKnownHosts = "[sftp.example.com]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample"
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(BeEmpty())
+
+			conf := &sosreportConfiguration{}
+			applySosreportConfig(conf, sosreportConfig)
+			Expect(conf.environment).To(HaveKeyWithValue("SFTP_SERVER", "sftp.example.com:2222"))
+			Expect(conf.environment).To(HaveKeyWithValue("SFTP_KNOWN_HOSTS", sosreportConfig.Spec.Upload.SFTPKnownHosts))
+			Expect(conf.environment).To(HaveKeyWithValue("SFTP_PATH", "/upload/{{sosreport}}"))
+		})
+
+		It("Should validate the URL, headers and status codes of the http upload method", func() {
+			sosreportConfig := supportv1alpha1.SosreportConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "http",
+				},
+				Spec: supportv1alpha1.SosreportConfigSpec{
+					Upload: &supportv1alpha1.SosreportConfigUpload{
+						Method:                  "http",
+						HTTPURL:                 "portal.example.com/upload",
+						HTTPHeaders:             map[string]string{"X-Case": "123", "Bad:Header": "x"},
+						HTTPExpectedStatusCodes: []int32{201, 1000},
+					},
+				},
+			}
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(HaveLen(3))
+
+			sosreportConfig.Spec.Upload.HTTPURL = "https://portal.example.com/upload/{{namespace}}/{{node}}/{{archive}}"
+			sosreportConfig.Spec.Upload.HTTPHeaders = map[string]string{"X-Case": "123", "X-Cluster": "a"}
+			sosreportConfig.Spec.Upload.HTTPExpectedStatusCodes = []int32{201, 202}
+			Expect(validateSosreportConfig(sosreportConfig, nil)).To(BeEmpty())
+
+			conf := &sosreportConfiguration{}
+			applySosreportConfig(conf, sosreportConfig)
+			Expect(conf.environment).To(HaveKeyWithValue("HTTP_URL", sosreportConfig.Spec.Upload.HTTPURL))
+			Expect(conf.environment).To(HaveKeyWithValue("HTTP_HEADERS", "X-Case: 123\nX-Cluster: a"))
+			Expect(conf.environment).To(HaveKeyWithValue("HTTP_EXPECTED_STATUS", "201,202"))
+			Expect(conf.environment).NotTo(HaveKey("HTTP_METHOD"))
+		})
+	})
+
+	Context("When a Sosreport references a SosreportConfig", func() {
+		It("Should fail the Sosreport if the SosreportConfig does not exist", func() {
+			s := &supportv1alpha1.Sosreport{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "configref-not-found",
+					Namespace: CONFIG_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportSpec{
+					ConfigRef: "does-not-exist",
+				},
+			}
+			Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			Eventually(func() supportv1alpha1.SosreportPhase {
+				if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: CONFIG_NAMESPACE, Name: s.Name}, s); err != nil {
+					return ""
+				}
+				return s.Status.Phase
+			}, TIMEOUT, INTERVAL).Should(Equal(supportv1alpha1.SosreportPhaseFailed))
+			condition := meta.FindStatusCondition(s.Status.Conditions, supportv1alpha1.ConditionConfigurationValid)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("ConfigNotFound"))
+
+			Expect(k8sClient.Delete(ctx, s)).Should(Succeed())
+		})
+	})
+})
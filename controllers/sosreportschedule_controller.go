@@ -0,0 +1,400 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+const (
+	DEFAULT_SUCCESSFUL_HISTORY_LIMIT = 3
+	DEFAULT_FAILED_HISTORY_LIMIT     = 1
+	MAX_MISSED_SCHEDULES             = 100 // more missed runs than this point to a clock skew or operator downtime
+)
+
+// SosreportScheduleReconciler creates Sosreports from SosreportSchedules, like the CronJob controller creates Jobs
+type SosreportScheduleReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// Now returns the current time. Defaults to time.Now.
+	Now      func() time.Time
+	recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=support.openshift.io,resources=sosreportschedules,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=support.openshift.io,resources=sosreportschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=support.openshift.io,resources=sosreportschedules/finalizers,verbs=update
+
+/*
+Create the Sosreport of the last missed run of a SosreportSchedule, clean up old Sosreports and requeue for the next
+run
+*/
+func (r *SosreportScheduleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("sosreportschedule", req.NamespacedName)
+
+	log.V(DEBUG).Info("Reconciler loop triggered")
+
+	schedule := &supportv1alpha1.SosreportSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to get SosreportSchedule")
+		return ctrl.Result{}, err
+	}
+
+	sosreports, err := r.getScheduledSosreports(schedule)
+	if err != nil {
+		log.Error(err, "unable to list Sosreports")
+		return ctrl.Result{}, err
+	}
+
+	var active, successful, failed []*supportv1alpha1.Sosreport
+	for _, s := range sosreports {
+		switch s.Status.Phase {
+		case supportv1alpha1.SosreportPhaseSucceeded:
+			successful = append(successful, s)
+		case supportv1alpha1.SosreportPhaseFailed, supportv1alpha1.SosreportPhasePartiallyFailed:
+			failed = append(failed, s)
+		default:
+			if s.DeletionTimestamp.IsZero() {
+				active = append(active, s)
+			}
+		}
+	}
+
+	schedule.Status.Active = nil
+	for _, s := range active {
+		schedule.Status.Active = append(schedule.Status.Active, corev1.ObjectReference{
+			APIVersion: supportv1alpha1.GroupVersion.String(),
+			Kind:       "Sosreport",
+			Namespace:  s.Namespace,
+			Name:       s.Name,
+			UID:        s.UID,
+		})
+	}
+	if len(successful) > 0 {
+		lastSuccessfulTime := metav1.NewTime(getScheduledTime(successful[len(successful)-1]))
+		schedule.Status.LastSuccessfulTime = &lastSuccessfulTime
+	}
+
+	// the oldest Sosreports beyond the history limits are deleted
+	successfulLimit := DEFAULT_SUCCESSFUL_HISTORY_LIMIT
+	if schedule.Spec.SuccessfulSosreportsHistoryLimit != nil {
+		successfulLimit = int(*schedule.Spec.SuccessfulSosreportsHistoryLimit)
+	}
+	failedLimit := DEFAULT_FAILED_HISTORY_LIMIT
+	if schedule.Spec.FailedSosreportsHistoryLimit != nil {
+		failedLimit = int(*schedule.Spec.FailedSosreportsHistoryLimit)
+	}
+	for _, history := range []struct {
+		sosreports []*supportv1alpha1.Sosreport
+		limit      int
+	}{{successful, successfulLimit}, {failed, failedLimit}} {
+		for i := 0; i < len(history.sosreports)-history.limit; i++ {
+			if err := r.deleteScheduledSosreport(history.sosreports[i], "history limit"); err != nil {
+				log.Error(err, "unable to delete old Sosreport", "Sosreport.Name", history.sosreports[i].Name)
+			}
+		}
+	}
+
+	result, err := r.runSosreportSchedule(schedule, active, log)
+	if err != nil {
+		return result, err
+	}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		log.V(DEBUG).Info("unable to update SosreportSchedule status", "err", err)
+		return requeueOnConflict(err)
+	}
+	return result, nil
+}
+
+/*
+Create a Sosreport if a run of the schedule is due. The status of the schedule is updated in place, but not written.
+Returns a result which requeues for the next run.
+*/
+func (r *SosreportScheduleReconciler) runSosreportSchedule(schedule *supportv1alpha1.SosreportSchedule, active []*supportv1alpha1.Sosreport, log logr.Logger) (ctrl.Result, error) {
+	// retrying does not help, the schedule must be changed
+	if msg := validateSosreportScheduleName(schedule); msg != "" {
+		log.V(INFO).Info("Invalid schedule name", "message", msg)
+		setSosreportScheduleCondition(schedule, metav1.ConditionFalse, "NameTooLong", msg)
+		r.recorder.Event(schedule, corev1.EventTypeWarning, "Invalid schedule", msg)
+		return ctrl.Result{}, nil
+	}
+	cronSchedule, err := parseCronSchedule(schedule.Spec.Schedule)
+	if err != nil {
+		log.Error(err, "invalid schedule")
+		setSosreportScheduleCondition(schedule, metav1.ConditionFalse, "InvalidSchedule", err.Error())
+		r.recorder.Event(schedule, corev1.EventTypeWarning, "Invalid schedule", err.Error())
+		return ctrl.Result{}, nil
+	}
+	setSosreportScheduleCondition(schedule, metav1.ConditionTrue, "ScheduleValid", "Sosreports can be created")
+	if schedule.Spec.Suspend {
+		log.V(DEBUG).Info("SosreportSchedule is suspended")
+		return ctrl.Result{}, nil
+	}
+
+	now := r.Now()
+	missedRun, nextRun, tooManyMissed := getNextScheduleTime(schedule, cronSchedule, now)
+	if tooManyMissed {
+		// like the CronJob controller, only the latest missed run is started
+		log.V(INFO).Info("Too many missed runs", "latest missed run", missedRun)
+		r.recorder.Event(schedule, corev1.EventTypeWarning, "Too many missed runs",
+			fmt.Sprintf("More than %d runs were missed, starting only the latest of them. Check the clock or set "+
+				"startingDeadlineSeconds.", MAX_MISSED_SCHEDULES))
+	}
+	result := ctrl.Result{}
+	if !nextRun.IsZero() {
+		result.RequeueAfter = nextRun.Sub(now)
+	}
+	if missedRun.IsZero() {
+		log.V(DEBUG).Info("No run is due", "next run", nextRun)
+		return result, nil
+	}
+
+	switch schedule.Spec.ConcurrencyPolicy {
+	case supportv1alpha1.ConcurrencyPolicyAllow:
+	case supportv1alpha1.ConcurrencyPolicyReplace:
+		for _, s := range active {
+			if err := r.deleteScheduledSosreport(s, "replaced by the next run"); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	default:
+		if len(active) > 0 {
+			log.V(INFO).Info("Skipping run, an earlier Sosreport is still running", "scheduled time", missedRun)
+			r.recorder.Event(schedule, corev1.EventTypeNormal, "Run skipped",
+				fmt.Sprintf("Skipped the run of %s, Sosreport %s is still running", missedRun.Format(time.RFC3339),
+					active[0].Name))
+			scheduleTime := metav1.NewTime(missedRun)
+			schedule.Status.LastScheduleTime = &scheduleTime
+			return result, nil
+		}
+	}
+
+	s, err := r.sosreportForSchedule(schedule, missedRun)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	log.V(INFO).Info("Creating Sosreport", "Sosreport.Name", s.Name, "scheduled time", missedRun)
+	if err := r.Create(ctx, s); err != nil && !apierrors.IsAlreadyExists(err) {
+		// e.g. the Sosreport was rejected by the webhook
+		log.Error(err, "unable to create Sosreport", "Sosreport.Name", s.Name)
+		r.recorder.Event(schedule, corev1.EventTypeWarning, "Sosreport creation failed", err.Error())
+		return ctrl.Result{}, err
+	}
+	r.recorder.Event(schedule, corev1.EventTypeNormal, "Sosreport created", fmt.Sprintf("Created Sosreport %s", s.Name))
+	scheduleTime := metav1.NewTime(missedRun)
+	schedule.Status.LastScheduleTime = &scheduleTime
+	return result, nil
+}
+
+/*
+Set the Valid condition of a SosreportSchedule
+*/
+func setSosreportScheduleCondition(schedule *supportv1alpha1.SosreportSchedule, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:               supportv1alpha1.ConditionValid,
+		Status:             status,
+		ObservedGeneration: schedule.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+/*
+The name of a schedule is part of the names of its Sosreports, whose names are limited by the job naming scheme.
+Returns a message if the name is too long, or "" otherwise.
+*/
+func validateSosreportScheduleName(schedule *supportv1alpha1.SosreportSchedule) string {
+	// the suffix has the same length until the year 2160
+	name := getScheduledSosreportName(schedule, time.Now())
+	if maxLen := getMaxShortNameLength(name); maxLen < 1 {
+		return fmt.Sprintf("metadata.name: %s is too long, the name of a SosreportSchedule must not exceed %d characters",
+			schedule.Name, len(schedule.Name)+maxLen-1)
+	}
+	return ""
+}
+
+/*
+Get the name of the Sosreport of a run, which is derived from the scheduled time
+*/
+func getScheduledSosreportName(schedule *supportv1alpha1.SosreportSchedule, scheduledTime time.Time) string {
+	return fmt.Sprintf("%s-%d", schedule.Name, scheduledTime.Unix()/60)
+}
+
+/*
+Return the latest run of the schedule which is due but was not started, and the next run after now. The missed run
+is the zero time if none is due. Only runs since the last run, the creation of the schedule or the starting deadline,
+whichever is the latest, are considered. Reports if more than MAX_MISSED_SCHEDULES runs were missed, in which case
+the latest missed run is searched for backwards from now instead of counting all of them.
+*/
+func getNextScheduleTime(schedule *supportv1alpha1.SosreportSchedule, cronSchedule *cronSchedule, now time.Time) (time.Time, time.Time, bool) {
+	earliest := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		earliest = schedule.Status.LastScheduleTime.Time
+	}
+	if schedule.Spec.StartingDeadlineSeconds != nil {
+		deadline := now.Add(-time.Duration(*schedule.Spec.StartingDeadlineSeconds) * time.Second)
+		if deadline.After(earliest) {
+			earliest = deadline
+		}
+	}
+	if earliest.After(now) {
+		return time.Time{}, cronSchedule.Next(now.UTC()), false
+	}
+
+	var missedRun time.Time
+	missed := 0
+	for t := cronSchedule.Next(earliest.UTC()); !t.IsZero() && !t.After(now); t = cronSchedule.Next(t) {
+		missedRun = t
+		missed++
+		if missed > MAX_MISSED_SCHEDULES {
+			return getLatestRun(cronSchedule, earliest, now), cronSchedule.Next(now.UTC()), true
+		}
+	}
+	return missedRun, cronSchedule.Next(now.UTC()), false
+}
+
+/*
+Return the latest run of a schedule after earliest which is not after now. The window before now is doubled until it
+contains a run, so that only the runs within the window are computed.
+*/
+func getLatestRun(cronSchedule *cronSchedule, earliest, now time.Time) time.Time {
+	var latestRun time.Time
+	for window := time.Hour; latestRun.IsZero(); window *= 2 {
+		start := now.Add(-window)
+		if start.Before(earliest) {
+			start = earliest
+		}
+		for t := cronSchedule.Next(start.UTC()); !t.IsZero() && !t.After(now); t = cronSchedule.Next(t) {
+			latestRun = t
+		}
+		if !start.After(earliest) {
+			break
+		}
+	}
+	return latestRun
+}
+
+/*
+Get the Sosreports which were created by a schedule, sorted by their scheduled time, the oldest first
+*/
+func (r *SosreportScheduleReconciler) getScheduledSosreports(schedule *supportv1alpha1.SosreportSchedule) ([]*supportv1alpha1.Sosreport, error) {
+	sosreportList := &supportv1alpha1.SosreportList{}
+	if err := r.List(ctx, sosreportList, client.InNamespace(schedule.Namespace),
+		client.MatchingLabels{supportv1alpha1.ScheduleLabel: schedule.Name}); err != nil {
+		return nil, err
+	}
+	var sosreports []*supportv1alpha1.Sosreport
+	for i := range sosreportList.Items {
+		s := &sosreportList.Items[i]
+		if owner := metav1.GetControllerOf(s); owner != nil && owner.UID == schedule.UID {
+			sosreports = append(sosreports, s)
+		}
+	}
+	sort.SliceStable(sosreports, func(i, j int) bool {
+		return getScheduledTime(sosreports[i]).Before(getScheduledTime(sosreports[j]))
+	})
+	return sosreports, nil
+}
+
+/*
+Get the time which a Sosreport was scheduled for. Falls back to its creation time.
+*/
+func getScheduledTime(s *supportv1alpha1.Sosreport) time.Time {
+	if t, err := time.Parse(time.RFC3339, s.Annotations[supportv1alpha1.ScheduledTimeAnnotation]); err == nil {
+		return t
+	}
+	return s.CreationTimestamp.Time
+}
+
+/*
+Delete a Sosreport of a schedule in the background. Its finalizer still waits for its uploads.
+*/
+func (r *SosreportScheduleReconciler) deleteScheduledSosreport(s *supportv1alpha1.Sosreport, reason string) error {
+	if !s.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	r.Log.V(INFO).Info("Deleting Sosreport", "Sosreport.Namespace", s.Namespace, "Sosreport.Name", s.Name,
+		"reason", reason)
+	err := r.Delete(ctx, s, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+/*
+Create the definition of the Sosreport of a run. The name is derived from the scheduled time, so that a run is never
+created twice.
+*/
+func (r *SosreportScheduleReconciler) sosreportForSchedule(schedule *supportv1alpha1.SosreportSchedule, scheduledTime time.Time) (*supportv1alpha1.Sosreport, error) {
+	labels := make(map[string]string)
+	for k, v := range schedule.Spec.SosreportTemplate.Labels {
+		labels[k] = v
+	}
+	labels[supportv1alpha1.ScheduleLabel] = schedule.Name
+	annotations := make(map[string]string)
+	for k, v := range schedule.Spec.SosreportTemplate.Annotations {
+		annotations[k] = v
+	}
+	annotations[supportv1alpha1.ScheduledTimeAnnotation] = scheduledTime.UTC().Format(time.RFC3339)
+
+	s := &supportv1alpha1.Sosreport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        getScheduledSosreportName(schedule, scheduledTime),
+			Namespace:   schedule.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *schedule.Spec.SosreportTemplate.Spec.DeepCopy(),
+	}
+	if err := ctrl.SetControllerReference(schedule, s, r.Scheme); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/*
+Trigger reconcile loop whenever a SosreportSchedule or one of its Sosreports changes
+*/
+func (r *SosreportScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("SosreportSchedule")
+	if r.Now == nil {
+		r.Now = time.Now
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&supportv1alpha1.SosreportSchedule{}).
+		Owns(&supportv1alpha1.Sosreport{}).
+		Complete(r)
+}
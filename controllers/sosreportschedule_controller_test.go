@@ -0,0 +1,240 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+var _ = Describe("SosreportSchedule controller", func() {
+
+	const (
+		SCHEDULE_NAMESPACE = "default"
+		TIMEOUT            = time.Second * 10
+		INTERVAL           = time.Millisecond * 250
+	)
+
+	ctx := context.Background()
+
+	// a time in UTC, e.g. date(2021, 1, 3, 3, 0) is Sunday at 03:00
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	Context("When parsing cron expressions", func() {
+		It("Should compute the next run", func() {
+			for spec, next := range map[string]time.Time{
+				"0 3 * * 0":         date(2021, 1, 3, 3, 0),
+				"0 3 * * SUN":       date(2021, 1, 3, 3, 0),
+				"*/15 * * * *":      date(2021, 1, 1, 12, 15),
+				"30 1-2 * * *":      date(2021, 1, 2, 1, 30),
+				"0 0 1,15 * *":      date(2021, 1, 15, 0, 0),
+				"0 0 1 mar *":       date(2021, 3, 1, 0, 0),
+				"0 0 13 * 5":        date(2021, 1, 8, 0, 0),
+				"@weekly":           date(2021, 1, 3, 0, 0),
+				"@hourly":           date(2021, 1, 1, 13, 0),
+				"0 0 29 feb *":      date(2024, 2, 29, 0, 0),
+				" 5/20 12 * * 1-5 ": date(2021, 1, 1, 12, 25),
+			} {
+				cronSchedule, err := parseCronSchedule(spec)
+				Expect(err).NotTo(HaveOccurred(), spec)
+				Expect(cronSchedule.Next(date(2021, 1, 1, 12, 5))).To(Equal(next), spec)
+			}
+		})
+
+		It("Should reject invalid expressions", func() {
+			for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *",
+				"* * * foo *", "@every 1h"} {
+				_, err := parseCronSchedule(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+
+	Context("When computing the runs of a schedule", func() {
+		It("Should only start the latest missed run within the starting deadline", func() {
+			cronSchedule, err := parseCronSchedule("0 * * * *")
+			Expect(err).NotTo(HaveOccurred())
+			schedule := &supportv1alpha1.SosreportSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(date(2021, 1, 1, 9, 30)),
+				},
+			}
+			now := date(2021, 1, 1, 12, 5)
+
+			missedRun, nextRun, tooManyMissed := getNextScheduleTime(schedule, cronSchedule, now)
+			Expect(tooManyMissed).To(BeFalse())
+			Expect(missedRun).To(Equal(date(2021, 1, 1, 12, 0)))
+			Expect(nextRun).To(Equal(date(2021, 1, 1, 13, 0)))
+
+			lastScheduleTime := metav1.NewTime(date(2021, 1, 1, 12, 0))
+			schedule.Status.LastScheduleTime = &lastScheduleTime
+			missedRun, _, _ = getNextScheduleTime(schedule, cronSchedule, now)
+			Expect(missedRun.IsZero()).To(BeTrue())
+
+			startingDeadlineSeconds := int64(60)
+			schedule.Status.LastScheduleTime = nil
+			schedule.Spec.StartingDeadlineSeconds = &startingDeadlineSeconds
+			missedRun, _, _ = getNextScheduleTime(schedule, cronSchedule, now)
+			Expect(missedRun.IsZero()).To(BeTrue())
+		})
+
+		It("Should start the latest run if too many runs were missed", func() {
+			cronSchedule, err := parseCronSchedule("* * * * *")
+			Expect(err).NotTo(HaveOccurred())
+			// e.g. the operator was down for a day
+			lastScheduleTime := metav1.NewTime(date(2021, 1, 1, 9, 30))
+			schedule := &supportv1alpha1.SosreportSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(date(2021, 1, 1, 9, 0)),
+				},
+				Status: supportv1alpha1.SosreportScheduleStatus{
+					LastScheduleTime: &lastScheduleTime,
+				},
+			}
+			now := date(2021, 1, 2, 9, 30).Add(30 * time.Second)
+
+			missedRun, nextRun, tooManyMissed := getNextScheduleTime(schedule, cronSchedule, now)
+			Expect(tooManyMissed).To(BeTrue())
+			Expect(missedRun).To(Equal(date(2021, 1, 2, 9, 30)))
+			Expect(nextRun).To(Equal(date(2021, 1, 2, 9, 31)))
+
+			// the window before now is widened until it contains a run
+			cronSchedule, err = parseCronSchedule("@yearly")
+			Expect(err).NotTo(HaveOccurred())
+			schedule.CreationTimestamp = metav1.NewTime(date(1900, 1, 1, 9, 0))
+			schedule.Status.LastScheduleTime = nil
+			missedRun, _, tooManyMissed = getNextScheduleTime(schedule, cronSchedule, now)
+			Expect(tooManyMissed).To(BeTrue())
+			Expect(missedRun).To(Equal(date(2021, 1, 1, 0, 0)))
+		})
+	})
+
+	Context("When the name of a SosreportSchedule is too long for the names of its Sosreports", func() {
+		It("Should report the schedule as invalid", func() {
+			schedule := &supportv1alpha1.SosreportSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedule-with-a-name-of-31-char",
+					Namespace: SCHEDULE_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportScheduleSpec{
+					Schedule: "* * * * *",
+				},
+			}
+			Expect(validateSosreportScheduleName(schedule)).NotTo(BeEmpty())
+			Expect(k8sClient.Create(ctx, schedule)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: SCHEDULE_NAMESPACE, Name: schedule.Name}
+
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, namespacedName, schedule); err != nil {
+					return ""
+				}
+				if c := meta.FindStatusCondition(schedule.Status.Conditions, supportv1alpha1.ConditionValid); c != nil {
+					return c.Reason
+				}
+				return ""
+			}, TIMEOUT, INTERVAL).Should(Equal("NameTooLong"))
+			sosreportList := &supportv1alpha1.SosreportList{}
+			Expect(k8sClient.List(ctx, sosreportList, client.InNamespace(SCHEDULE_NAMESPACE),
+				client.MatchingLabels{supportv1alpha1.ScheduleLabel: schedule.Name})).Should(Succeed())
+			Expect(sosreportList.Items).To(BeEmpty())
+
+			schedule.Name = schedule.Name[:30]
+			Expect(validateSosreportScheduleName(schedule)).To(BeEmpty())
+
+			Expect(k8sClient.Delete(ctx, &supportv1alpha1.SosreportSchedule{ObjectMeta: metav1.ObjectMeta{
+				Name: namespacedName.Name, Namespace: SCHEDULE_NAMESPACE}})).Should(Succeed())
+		})
+	})
+
+	Context("When a run of a SosreportSchedule is due", func() {
+		It("Should create a Sosreport from the template and keep the history limits", func() {
+			failedHistoryLimit := int32(1)
+			schedule := &supportv1alpha1.SosreportSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedule",
+					Namespace: SCHEDULE_NAMESPACE,
+				},
+				Spec: supportv1alpha1.SosreportScheduleSpec{
+					Schedule:                     "* * * * *",
+					Suspend:                      true,
+					FailedSosreportsHistoryLimit: &failedHistoryLimit,
+					SosreportTemplate: supportv1alpha1.SosreportTemplateSpec{
+						Labels: map[string]string{"baseline": "weekly"},
+						Spec: supportv1alpha1.SosreportSpec{
+							// no node carries this label, so the Sosreports fail right away
+							NodeSelector: map[string]string{
+								"sosreport-schedule-test": "none",
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, schedule)).Should(Succeed())
+			namespacedName := types.NamespacedName{Namespace: SCHEDULE_NAMESPACE, Name: schedule.Name}
+
+			By("Creating Sosreports of earlier runs")
+			for i := 3; i > 0; i-- {
+				scheduledTime := time.Now().Add(-time.Duration(i) * time.Hour).UTC()
+				s, err := (&SosreportScheduleReconciler{Scheme: scheme.Scheme}).sosreportForSchedule(schedule, scheduledTime)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Create(ctx, s)).Should(Succeed())
+			}
+
+			By("Resuming the schedule with a missed run")
+			Expect(k8sClient.Get(ctx, namespacedName, schedule)).Should(Succeed())
+			lastScheduleTime := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+			schedule.Status.LastScheduleTime = &lastScheduleTime
+			Expect(k8sClient.Status().Update(ctx, schedule)).Should(Succeed())
+			Expect(k8sClient.Get(ctx, namespacedName, schedule)).Should(Succeed())
+			schedule.Spec.Suspend = false
+			Expect(k8sClient.Update(ctx, schedule)).Should(Succeed())
+
+			By("Waiting for the Sosreport of the missed run and for the old Sosreports to be deleted")
+			sosreportList := &supportv1alpha1.SosreportList{}
+			Eventually(func() int {
+				if err := k8sClient.List(ctx, sosreportList, client.InNamespace(SCHEDULE_NAMESPACE),
+					client.MatchingLabels{supportv1alpha1.ScheduleLabel: schedule.Name}); err != nil {
+					return -1
+				}
+				return len(sosreportList.Items)
+			}, TIMEOUT, INTERVAL).Should(Equal(int(failedHistoryLimit)))
+			s := sosreportList.Items[0]
+			Expect(s.Labels).To(HaveKeyWithValue("baseline", "weekly"))
+			Expect(getScheduledTime(&s).After(lastScheduleTime.Time)).To(BeTrue())
+			Expect(s.Spec.NodeSelector).To(HaveKeyWithValue("sosreport-schedule-test", "none"))
+
+			Expect(k8sClient.Get(ctx, namespacedName, schedule)).Should(Succeed())
+			Expect(schedule.Status.LastScheduleTime.Time).To(Equal(getScheduledTime(&s)))
+
+			By("Deleting the schedule")
+			Expect(k8sClient.Delete(ctx, schedule)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, &s)).Should(Succeed())
+		})
+	})
+})
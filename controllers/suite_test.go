@@ -17,9 +17,13 @@ limitations under the License.
 package controllers
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net"
 	"path/filepath"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -61,7 +65,7 @@ var _ = BeforeSuite(func(done Done) {
 
 	// dynamically change loglevel by only printing if the level is higher than loglevel.Minlevel
 	var levelEnablerFunc = upstreamzap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= logLevel.MinLevel
+		return logLevel.Enabled(lvl)
 	})
 
 	logf.SetLogger(
@@ -75,6 +79,9 @@ var _ = BeforeSuite(func(done Done) {
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths: []string{filepath.Join("..", "config", "crd", "bases")},
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			DirectoryPaths: []string{filepath.Join("..", "config", "webhook")},
+		},
 	}
 
 	var err error
@@ -91,24 +98,65 @@ var _ = BeforeSuite(func(done Done) {
 	// Expect(err).ToNot(HaveOccurred())
 	// Expect(k8sClient).ToNot(BeNil())
 
+	webhookInstallOptions := &testEnv.WebhookInstallOptions
 	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
-		Scheme: scheme.Scheme,
+		Scheme:             scheme.Scheme,
+		Host:               webhookInstallOptions.LocalServingHost,
+		Port:               webhookInstallOptions.LocalServingPort,
+		CertDir:            webhookInstallOptions.LocalServingCertDir,
+		MetricsBindAddress: "0",
 	})
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&SosreportReconciler{
-		Client:          k8sManager.GetClient(),
-		Log:             ctrl.Log.WithName("controllers").WithName("Sosreport"),
-		DynamicLogLevel: logLevel,
-		Scheme:          k8sManager.GetScheme(),
+		Client:                  k8sManager.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("Sosreport"),
+		DynamicLogLevel:         logLevel,
+		Scheme:                  k8sManager.GetScheme(),
+		MaxConcurrentReconciles: 2,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
+	err = (&SosreportConfigReconciler{
+		Client: k8sManager.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SosreportConfig"),
+		Scheme: k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&SosreportScheduleReconciler{
+		Client: k8sManager.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SosreportSchedule"),
+		Scheme: k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&SosreportGarbageCollector{
+		Log:      ctrl.Log.WithName("retention"),
+		Interval: time.Second,
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&SosreportValidator{}).SetupWebhookWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
 	go func() {
 		err = k8sManager.Start(ctrl.SetupSignalHandler())
 		Expect(err).ToNot(HaveOccurred())
 	}()
 
+	// wait for the webhook server to get ready
+	dialer := &net.Dialer{Timeout: time.Second}
+	addrPort := fmt.Sprintf("%s:%d", webhookInstallOptions.LocalServingHost, webhookInstallOptions.LocalServingPort)
+	Eventually(func() error {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addrPort, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}).Should(Succeed())
+
 	k8sClient = k8sManager.GetClient()
 	Expect(k8sClient).ToNot(BeNil())
 
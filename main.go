@@ -19,9 +19,12 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	upstreamzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -49,10 +52,54 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var maxConcurrentReconciles int
+	var clusterConcurrency int
+	var nodeRoleConcurrencyFlag string
+	var enableWebhooks bool
+	var artifactServerAddr string
+	var artifactServerURL string
+	var artifactServerCertDir string
+	var readerNamespaceSelectorFlag string
+	var retentionPolicy controllers.RetentionPolicy
+	var retentionMaxPVCBytes string
+	var retentionInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of Sosreports which can be reconciled at the same time.")
+	flag.IntVar(&clusterConcurrency, "cluster-concurrency", 0,
+		"The number of sosreport jobs which can run at the same time across all Sosreports. 0 means no limit.")
+	flag.StringVar(&nodeRoleConcurrencyFlag, "node-role-concurrency", "",
+		"The number of sosreport jobs which can run at the same time on nodes of a role across all Sosreports, "+
+			"e.g. master=1,worker=3.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating webhook for Sosreports. "+
+			"Requires a serving certificate in /tmp/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&artifactServerAddr, "artifact-server-addr", "0",
+		"The address the artifact server binds to, e.g. :8082. 0 disables the artifact server.")
+	flag.StringVar(&artifactServerURL, "artifact-server-url", "",
+		"The external URL of the artifact server. The URLs of the archives are recorded in the status of the "+
+			"Sosreports if it is set.")
+	flag.StringVar(&artifactServerCertDir, "artifact-server-cert-dir", "",
+		"The directory with tls.crt and tls.key of the artifact server. The artifact server uses plain HTTP "+
+			"if it is not set.")
+	flag.StringVar(&readerNamespaceSelectorFlag, "artifact-server-reader-namespace-selector",
+		controllers.DEFAULT_READER_NAMESPACE_SELECTOR,
+		"The label selector of the namespaces which the NetworkPolicy of the artifact server's reader pods admits. "+
+			"The default selects the host network on OpenShift. Empty means no NetworkPolicy.")
+	flag.IntVar(&retentionPolicy.KeepLast, "retention-keep-last", 0,
+		"The number of finished Sosreports which are kept per namespace. 0 means no limit.")
+	flag.DurationVar(&retentionPolicy.MaxAge, "retention-max-age", 0,
+		"The time after their completion for which finished Sosreports are kept, e.g. 168h. 0 means no limit.")
+	flag.StringVar(&retentionMaxPVCBytes, "retention-max-pvc-bytes", "",
+		"The capacity which the PVCs of all Sosreports may use, e.g. 500Gi. The oldest finished Sosreports are "+
+			"deleted until their PVCs fit. Empty means no limit.")
+	flag.BoolVar(&retentionPolicy.RetainPVCs, "retention-retain-pvcs", false,
+		"Keep the PVCs of Sosreports which are deleted by their ttlAfterFinished or by the retention policy.")
+	flag.DurationVar(&retentionInterval, "retention-interval", controllers.DEFAULT_RETENTION_INTERVAL,
+		"The time between two runs of the garbage collector for finished Sosreports.")
 	flag.Parse()
 
 	// start at the InfoLevel - do not log debug
@@ -62,7 +109,7 @@ func main() {
 
 	// dynamically change loglevel by only printing if the level is higher than loglevel.Minlevel
 	var levelEnablerFunc = upstreamzap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= logLevel.MinLevel
+		return logLevel.Enabled(lvl)
 	})
 
 	// set logger and set dynamicc logging level function
@@ -86,15 +133,82 @@ func main() {
 		os.Exit(1)
 	}
 
+	nodeRoleConcurrency, err := controllers.ParseNodeRoleConcurrency(nodeRoleConcurrencyFlag)
+	if err != nil {
+		setupLog.Error(err, "unable to parse node-role-concurrency")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.SosreportReconciler{
-		Client:          mgr.GetClient(),
-		Log:             ctrl.Log.WithName("controllers").WithName("Sosreport"),
-		DynamicLogLevel: logLevel,
-		Scheme:          mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("Sosreport"),
+		DynamicLogLevel:         logLevel,
+		Scheme:                  mgr.GetScheme(),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		ClusterConcurrency:      clusterConcurrency,
+		NodeRoleConcurrency:     nodeRoleConcurrency,
+		ArtifactServerURL:       artifactServerURL,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Sosreport")
 		os.Exit(1)
 	}
+	if retentionMaxPVCBytes != "" {
+		maxPVCBytes, err := resource.ParseQuantity(retentionMaxPVCBytes)
+		if err != nil {
+			setupLog.Error(err, "unable to parse retention-max-pvc-bytes")
+			os.Exit(1)
+		}
+		retentionPolicy.MaxPVCBytes = &maxPVCBytes
+	}
+	if err = (&controllers.SosreportGarbageCollector{
+		Log:      ctrl.Log.WithName("retention"),
+		Policy:   retentionPolicy,
+		Interval: retentionInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create garbage collector")
+		os.Exit(1)
+	}
+	if err = (&controllers.SosreportConfigReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SosreportConfig"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SosreportConfig")
+		os.Exit(1)
+	}
+	if err = (&controllers.SosreportScheduleReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SosreportSchedule"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SosreportSchedule")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = (&controllers.SosreportValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Sosreport")
+			os.Exit(1)
+		}
+	}
+	if artifactServerAddr != "0" {
+		var readerNamespaceSelector *metav1.LabelSelector
+		if readerNamespaceSelectorFlag != "" {
+			readerNamespaceSelector, err = metav1.ParseToLabelSelector(readerNamespaceSelectorFlag)
+			if err != nil {
+				setupLog.Error(err, "unable to parse artifact-server-reader-namespace-selector")
+				os.Exit(1)
+			}
+		}
+		if err = (&controllers.ArtifactServer{
+			Log:                     ctrl.Log.WithName("artifacts"),
+			BindAddress:             artifactServerAddr,
+			CertDir:                 artifactServerCertDir,
+			ReaderNamespaceSelector: readerNamespaceSelector,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create artifact server")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
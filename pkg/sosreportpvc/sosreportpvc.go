@@ -0,0 +1,68 @@
+/*
+Copyright 2020.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sosreportpvc finds and keeps the PVCs which hold the archives of a Sosreport. It is shared by the operator
+// and the kubectl-sosreport plugin, so that both select the same PVCs.
+package sosreportpvc
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	supportv1alpha1 "github.com/andreaskaris/sosreport-operator/api/v1alpha1"
+)
+
+/*
+Labels returns the labels of the sosreport jobs of a Sosreport and of the PVCs which hold their archives
+*/
+func Labels(name string) map[string]string {
+	return map[string]string{"app": "sosreport", "sosreport-cr": name}
+}
+
+/*
+Orphan removes the Sosreport's owner reference from its PVCs, so that the garbage collector keeps them once the
+Sosreport is deleted. Returns the names of the orphaned PVCs, also if a later PVC could not be patched.
+*/
+func Orphan(ctx context.Context, c client.Client, s *supportv1alpha1.Sosreport) ([]string, error) {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := c.List(ctx, pvcList, client.InNamespace(s.Namespace), client.MatchingLabels(Labels(s.Name))); err != nil {
+		return nil, err
+	}
+
+	var pvcNames []string
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		var ownerReferences []metav1.OwnerReference
+		for _, ownerReference := range pvc.OwnerReferences {
+			if ownerReference.UID != s.UID {
+				ownerReferences = append(ownerReferences, ownerReference)
+			}
+		}
+		if len(ownerReferences) == len(pvc.OwnerReferences) {
+			continue
+		}
+		patch := client.MergeFrom(pvc.DeepCopy())
+		pvc.OwnerReferences = ownerReferences
+		if err := c.Patch(ctx, pvc, patch); err != nil {
+			return pvcNames, err
+		}
+		pvcNames = append(pvcNames, pvc.Name)
+	}
+	return pvcNames, nil
+}